@@ -8,12 +8,14 @@ import (
 	"path/filepath"
 
 	"github.com/jinzhu/gorm"
-	_ "github.com/jinzhu/gorm/dialects/sqlite"
 	"github.com/qor/admin"
 	"github.com/qor/assetfs"
 	"github.com/qor/qor/utils"
+	"github.com/spf13/pflag"
 
 	_ "github.com/x0rzkov/oniontree-backend/pkg/bindatafs"
+	"github.com/x0rzkov/oniontree-backend/pkg/config"
+	"github.com/x0rzkov/oniontree-backend/pkg/database"
 )
 
 // Define a GORM-backend model
@@ -30,8 +32,21 @@ type Product struct {
 }
 
 func main() {
+	// Load the configuration, the demo keeps its own database
+	conf := config.Default()
+	conf.Database.DSN = "demo.db"
+	conf.RegisterFlags(pflag.CommandLine)
+	conf.RegisterServerFlags(pflag.CommandLine)
+	pflag.Parse()
+	if err := conf.Load(pflag.CommandLine); err != nil {
+		log.Fatalln(err)
+	}
+
 	// Set up the database
-	DB, _ := gorm.Open("sqlite3", "demo.db")
+	DB, err := database.Open(conf.Database)
+	if err != nil {
+		log.Fatalln(err)
+	}
 	DB.AutoMigrate(&User{}, &Product{})
 
 	// Initialize AssetFS
@@ -55,9 +70,9 @@ func main() {
 	// Mount admin to the mux
 	Admin.MountTo("/admin", mux)
 
-	fmt.Println("Listening on: 9000")
+	fmt.Println("Listening on:", conf.Server.Listen)
 
-	err := http.ListenAndServe(":9000", mux)
+	err = http.ListenAndServe(conf.Server.Listen, mux)
 	if err != nil {
 		log.Fatalln(err)
 	}
@@ -0,0 +1,75 @@
+// Local receiver for developing against oniontree webhooks: it checks the
+// payload signature and prints every delivery it gets.
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"os"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/pflag"
+
+	"github.com/x0rzkov/oniontree-backend/pkg/webhook"
+)
+
+var (
+	listen   string
+	secret   string
+	failRate float64
+	help     bool
+)
+
+func main() {
+	pflag.StringVarP(&listen, "listen", "l", "127.0.0.1:9001", "address to listen on")
+	pflag.StringVarP(&secret, "secret", "s", "", "webhook secret used to verify signatures")
+	pflag.Float64VarP(&failRate, "fail-rate", "f", 0, "fraction of deliveries answered with 500, to exercise retries")
+	pflag.BoolVarP(&help, "help", "h", false, "help info")
+	pflag.Parse()
+	if help {
+		pflag.PrintDefaults()
+		os.Exit(1)
+	}
+
+	http.HandleFunc("/", receive)
+
+	log.Infof("Listening on: %s", listen)
+	log.Fatal(http.ListenAndServe(listen, nil))
+}
+
+func receive(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	event := r.Header.Get(webhook.EventHeader)
+	delivery := r.Header.Get(webhook.DeliveryHeader)
+	if !webhook.Verify(secret, body, r.Header.Get(webhook.SignatureHeader)) {
+		log.Warnf("delivery %s (%s): invalid signature", delivery, event)
+		http.Error(w, "invalid signature", http.StatusUnauthorized)
+		return
+	}
+	if rand.Float64() < failRate {
+		log.Infof("delivery %s (%s): failing on purpose", delivery, event)
+		http.Error(w, "failing on purpose", http.StatusInternalServerError)
+		return
+	}
+
+	var out bytes.Buffer
+	if err := json.Indent(&out, body, "", "  "); err != nil {
+		out.Write(body)
+	}
+	log.Infof("delivery %s (%s)", delivery, event)
+	fmt.Println(out.String())
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+
+	"github.com/x0rzkov/oniontree-backend/pkg/bindatafs"
+	"github.com/x0rzkov/oniontree-backend/pkg/server"
+)
+
+var (
+	assetsNameSpaces []string
+	assetsPrepend    []string
+	assetsAppend     []string
+	assetsShadowing  bool
+	assetsJSON       bool
+)
+
+var assetsCmd = &cobra.Command{
+	Use:   "assets [glob...]",
+	Short: "List the templates and assets and where they are resolved from",
+	Long: `List the templates and assets the server serves, the registered path each
+is resolved from and the files of other paths it shadows. Globs are matched
+against names, namespace included, or base names.
+
+Paths registered with --prepend take precedence over those of the server,
+which take precedence over those registered with --path, e.g. to check which
+templates of a theme override those of QOR admin:
+
+  oniontree assets --prepend admin=themes/dark --shadowing`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		assetFS := bindatafs.AssetFS
+		if _, err := server.RegisterAssets(assetFS, ""); err != nil {
+			return err
+		}
+		for _, p := range []struct {
+			specs   []string
+			prepend bool
+		}{{assetsPrepend, true}, {assetsAppend, false}} {
+			for _, spec := range p.specs {
+				parts := strings.SplitN(spec, "=", 2)
+				if len(parts) != 2 {
+					return fmt.Errorf("%s: expected namespace=path", spec)
+				}
+				fs := assetFS.NameSpace(parts[0])
+				register := fs.RegisterPath
+				if p.prepend {
+					register = fs.PrependPath
+				}
+				if err := register(parts[1]); err != nil {
+					return fmt.Errorf("%s: %s", parts[1], err)
+				}
+			}
+		}
+
+		resolutions, err := assetFS.Inspect(assetsNameSpaces...)
+		if err != nil {
+			return err
+		}
+		var selected []bindatafs.Resolution
+		for _, r := range resolutions {
+			if assetsShadowing && len(r.Shadows) == 0 {
+				continue
+			}
+			if len(args) > 0 && !bindatafs.MatchAny(args, r.Name) {
+				continue
+			}
+			selected = append(selected, r)
+		}
+
+		if assetsJSON {
+			out, err := json.MarshalIndent(selected, "", "  ")
+			if err != nil {
+				return err
+			}
+			fmt.Println(string(out))
+			return nil
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(w, "NAME\tPATH\tSHADOWS")
+		for _, r := range selected {
+			fmt.Fprintf(w, "%s\t%s\t%s\n", r.Name, r.Path, strings.Join(r.Shadows, ","))
+		}
+		return w.Flush()
+	},
+}
+
+func init() {
+	fs := assetsCmd.Flags()
+	fs.StringSliceVarP(&assetsNameSpaces, "namespace", "n", nil, "list only these namespaces, admin, public or file_server")
+	fs.StringArrayVar(&assetsPrepend, "prepend", nil, "register namespace=path before the paths of the server")
+	fs.StringArrayVar(&assetsAppend, "path", nil, "register namespace=path after the paths of the server")
+	fs.BoolVar(&assetsShadowing, "shadowing", false, "list only the assets shadowing others")
+	fs.BoolVar(&assetsJSON, "json", false, "print JSON")
+	rootCmd.AddCommand(assetsCmd)
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+
+	"github.com/x0rzkov/oniontree-backend/pkg/checker"
+)
+
+var checkCmd = &cobra.Command{
+	Use:   "check",
+	Short: "Check whether the URLs of services are up",
+	Long: `Request every URL of the database through the Tor SOCKS proxy and record
+whether the service answered.
+
+The url.healthy and url.unhealthy webhook deliveries of the URLs going up or
+down are logged, and sent by the server. oniontree serve --check-interval runs
+the checks itself.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		db, err := openDB()
+		if err != nil {
+			return err
+		}
+		defer db.Close()
+		registerCallbacks(db)
+
+		c, err := checker.New(db, conf.Check)
+		if err != nil {
+			return err
+		}
+		checked, healthy, err := c.Run()
+		if err != nil {
+			return err
+		}
+		fmt.Printf("%d of %d URLs are healthy\n", healthy, checked)
+		return nil
+	},
+}
+
+func init() {
+	conf.RegisterCheckFlags(checkCmd.Flags())
+	rootCmd.AddCommand(checkCmd)
+}
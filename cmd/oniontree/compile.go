@@ -0,0 +1,65 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+
+	"github.com/x0rzkov/oniontree-backend/pkg/bindatafs"
+	"github.com/x0rzkov/oniontree-backend/pkg/server"
+)
+
+var (
+	compileOptions  bindatafs.CompileOptions
+	compileManifest string
+)
+
+var compileAssetsCmd = &cobra.Command{
+	Use:   "compile-assets",
+	Short: "Compile the templates into the binary",
+	Long: `Compile the admin views and the public templates into pkg/bindatafs, to
+be built into the binary with -tags bindatafs. The admin assets are compiled
+along with their gzip and brotli variants, served to clients accepting them.
+With --fingerprint, the admin links its assets by names carrying the hash of
+their content, which browsers cache for good.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		assetFS := bindatafs.AssetFS
+
+		// Register view paths into AssetFS under their namespaces
+		if _, err := server.RegisterAssets(assetFS, ""); err != nil {
+			return err
+		}
+
+		// Compile templates under registered view paths into binary
+		manifest, err := assetFS.CompileWith(compileOptions)
+		if err != nil {
+			return err
+		}
+		for _, asset := range manifest.Assets {
+			log.Debugf("compiled %s from %s", asset.Name, asset.Source)
+		}
+		log.Infof("compiled %d assets into %s", len(manifest.Assets), manifest.Output)
+		if compileManifest == "" {
+			return nil
+		}
+		out, err := json.MarshalIndent(manifest, "", "  ")
+		if err != nil {
+			return err
+		}
+		return ioutil.WriteFile(compileManifest, out, 0644)
+	},
+}
+
+func init() {
+	fs := compileAssetsCmd.Flags()
+	fs.StringVarP(&compileOptions.Output, "output", "o", "pkg/bindatafs", "directory of the generated Go files, the one of the bindatafs package")
+	fs.StringSliceVar(&compileOptions.Include, "include", nil, "compile only the assets matching these globs")
+	fs.StringSliceVar(&compileOptions.Exclude, "exclude", nil, "leave out the assets matching these globs")
+	fs.StringSliceVarP(&compileOptions.NameSpaces, "namespace", "n", nil, "compile only these namespaces, admin or public")
+	fs.BoolVar(&compileOptions.Fingerprint, "fingerprint", false, "name the admin assets by the hash of their content too, to be cached for good")
+	fs.StringVar(&compileManifest, "manifest", "", "write the manifest of the compiled assets to this JSON file")
+	rootCmd.AddCommand(compileAssetsCmd)
+}
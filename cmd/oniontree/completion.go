@@ -0,0 +1,39 @@
+package main
+
+import (
+	"os"
+
+	"github.com/spf13/cobra"
+)
+
+var completionCmd = &cobra.Command{
+	Use:   "completion bash|zsh|fish|powershell",
+	Short: "Generate a shell completion script",
+	Long: `Generate a completion script of oniontree for the given shell, e.g.
+
+  source <(oniontree completion bash)
+  oniontree completion zsh > "${fpath[1]}/_oniontree"
+  oniontree completion fish > ~/.config/fish/completions/oniontree.fish`,
+	Args:      cobra.ExactValidArgs(1),
+	ValidArgs: []string{"bash", "zsh", "fish", "powershell"},
+	// The configuration isn't needed
+	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+		return nil
+	},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		switch args[0] {
+		case "bash":
+			return rootCmd.GenBashCompletion(os.Stdout)
+		case "zsh":
+			return rootCmd.GenZshCompletion(os.Stdout)
+		case "fish":
+			return rootCmd.GenFishCompletion(os.Stdout, true)
+		default:
+			return rootCmd.GenPowerShellCompletion(os.Stdout)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(completionCmd)
+}
@@ -0,0 +1,28 @@
+package main
+
+import (
+	"github.com/spf13/cobra"
+
+	"github.com/x0rzkov/oniontree-backend/pkg/exporter"
+)
+
+var exportCmd = &cobra.Command{
+	Use:   "export dir",
+	Short: "Export the dataset in the layout of the upstream repository",
+	Long: `Write every service of the database to dir/unsorted/<slug>.yaml, linked
+from dir/tagged/<tag>/<slug>.yaml for each of its tags. Existing files are
+overwritten.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		db, err := openDB()
+		if err != nil {
+			return err
+		}
+		defer db.Close()
+		return exporter.Export(db, args[0])
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(exportCmd)
+}
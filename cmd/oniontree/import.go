@@ -0,0 +1,132 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+
+	"github.com/jinzhu/gorm"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+
+	"github.com/x0rzkov/oniontree-backend/pkg/audit"
+	"github.com/x0rzkov/oniontree-backend/pkg/importer"
+	"github.com/x0rzkov/oniontree-backend/pkg/models"
+)
+
+var importCmd = &cobra.Command{
+	Use:   "import [dir]",
+	Short: "Import a local checkout of the dataset",
+	Long: `Import the services of a local checkout of the upstream repository, the
+configured data root by default. Services are tagged by the directory of
+tagged/ they are in. With --db-truncate, the dataset tables are emptied
+first, which is refused while abuse reports or service revisions refer to
+services. The webhook deliveries announcing the changes are logged, and sent
+by the server.`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		root := conf.Data.Root
+		if len(args) == 1 {
+			root = args[0]
+		}
+		db, err := openDB()
+		if err != nil {
+			return err
+		}
+		defer db.Close()
+		return importDirectory(db, root)
+	},
+}
+
+var syncCmd = &cobra.Command{
+	Use:   "sync [upstream]",
+	Short: "Import the dataset from the upstream repository",
+	Long: `Import the services of a revision of the upstream repository, the
+configured one by default. Local repositories, bare or not, are read in
+place, remote ones are cloned to memory. The imported commit is recorded in
+the database. With --db-truncate, the dataset tables are emptied first,
+which is refused while abuse reports or service revisions refer to services.
+The webhook deliveries announcing the changes are logged, and sent by the
+server.
+
+With --history, the changes of every service in the commit log are stored as
+its timeline too, which is kept across imports.
+
+With --verify=refuse or --verify=quarantine, the signatures of commits are
+checked against --keyring. A bad signature fails the import. Changes of
+unsigned or untrusted commits fail it too with refuse, or are left out with
+quarantine, services getting their content as of their last trusted change.`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if len(args) == 1 {
+			conf.Data.Upstream = args[0]
+		}
+		src, err := importer.NewSource(conf.Data)
+		if err != nil {
+			return err
+		}
+		v, err := importer.NewVerifier(conf.Data.Verify)
+		if err != nil {
+			return err
+		}
+		rev, err := src.Open()
+		if err != nil {
+			return err
+		}
+		if err := rev.Verify(v); err != nil {
+			return err
+		}
+		db, err := openDB()
+		if err != nil {
+			return err
+		}
+		defer db.Close()
+		registerCallbacks(db)
+		if err := truncate(db); err != nil {
+			return err
+		}
+		i := newImporter(db)
+		if err := i.Git(rev); err != nil {
+			return err
+		}
+		if conf.Data.History {
+			return i.History(rev)
+		}
+		return nil
+	},
+}
+
+func init() {
+	conf.RegisterDataFlags(importCmd.Flags())
+	conf.RegisterDataFlags(syncCmd.Flags())
+	rootCmd.AddCommand(importCmd, syncCmd)
+}
+
+// importDirectory empties the dataset tables if configured to, then imports
+// the services of root.
+func importDirectory(db *gorm.DB, root string) error {
+	if _, err := os.Stat(filepath.Join(root, "tagged")); err != nil {
+		return err
+	}
+	if conf.Data.Verify.Policy != importer.PolicyNone {
+		log.Warnf("signatures aren't verified when importing %s, use sync", root)
+	}
+	registerCallbacks(db)
+	if err := truncate(db); err != nil {
+		return err
+	}
+	return newImporter(db).Directory(root)
+}
+
+func truncate(db *gorm.DB) error {
+	if !conf.Database.Truncate {
+		return nil
+	}
+	return importer.Truncate(audit.WithOrigin(db, audit.OriginImporter), models.Tables...)
+}
+
+func newImporter(db *gorm.DB) *importer.Importer {
+	i := importer.New(audit.WithOrigin(db, audit.OriginImporter))
+	i.Debug = conf.Debug
+	i.Trace = conf.Data.Trace
+	return i
+}
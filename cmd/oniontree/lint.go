@@ -0,0 +1,40 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+
+	"github.com/x0rzkov/oniontree-backend/pkg/lint"
+)
+
+var lintCmd = &cobra.Command{
+	Use:   "lint [dir]",
+	Short: "Check the files of a checkout of the dataset",
+	Long: `Check a checkout of the upstream repository, the configured data root by
+default: every service must parse, have a name and onion URLs no other
+service has, and public keys that parse, and every entry of tagged/ must
+link to a service of unsorted/.`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		root := conf.Data.Root
+		if len(args) == 1 {
+			root = args[0]
+		}
+		problems, err := lint.Directory(root)
+		if err != nil {
+			return err
+		}
+		for _, p := range problems {
+			fmt.Println(p)
+		}
+		if len(problems) > 0 {
+			return fmt.Errorf("%d problems", len(problems))
+		}
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(lintCmd)
+}
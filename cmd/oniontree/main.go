@@ -0,0 +1,87 @@
+// Command oniontree runs the OnionTree backend: the admin server, the import
+// of the dataset and the maintenance tasks around it.
+package main
+
+import (
+	"os"
+
+	"github.com/jinzhu/gorm"
+	"github.com/qor/validations"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+
+	"github.com/x0rzkov/oniontree-backend/pkg/audit"
+	"github.com/x0rzkov/oniontree-backend/pkg/config"
+	"github.com/x0rzkov/oniontree-backend/pkg/database"
+	"github.com/x0rzkov/oniontree-backend/pkg/importer"
+	"github.com/x0rzkov/oniontree-backend/pkg/migrate"
+	"github.com/x0rzkov/oniontree-backend/pkg/webhook"
+)
+
+var conf = config.Default()
+
+var rootCmd = &cobra.Command{
+	Use:   "oniontree",
+	Short: "OnionTree backend",
+	Long: `OnionTree backend: the admin server, the import of the dataset and the
+maintenance tasks around it.
+
+The configuration is read from config/oniontree.yml, or the file given with
+--config, then from ONIONTREE_* environment variables, then from the flags.`,
+	SilenceUsage: true,
+	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+		if err := conf.Load(cmd.Flags()); err != nil {
+			return err
+		}
+		return setupLogging(conf.Log)
+	},
+}
+
+func init() {
+	conf.RegisterFlags(rootCmd.PersistentFlags())
+}
+
+func main() {
+	if err := rootCmd.Execute(); err != nil {
+		os.Exit(1)
+	}
+}
+
+// setupLogging configures the standard logger.
+func setupLogging(c config.Log) error {
+	level, err := log.ParseLevel(c.Level)
+	if err != nil {
+		return err
+	}
+	log.SetLevel(level)
+	if c.Format == "json" {
+		log.SetFormatter(&log.JSONFormatter{})
+	}
+	return nil
+}
+
+// openDB opens the configured database and migrates its schema.
+func openDB() (*gorm.DB, error) {
+	db, err := database.Open(conf.Database)
+	if err != nil {
+		return nil, err
+	}
+	db.LogMode(conf.Debug)
+	if _, err := migrate.New(db).Up(0); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return db, nil
+}
+
+// registerCallbacks validates models, records every change of db in the
+// audit log and logs the webhook deliveries announcing the changes of the
+// dataset, which the server sends.
+func registerCallbacks(db *gorm.DB) {
+	validations.RegisterCallbacks(db)
+	// Record every change but the webhook delivery log and the timelines
+	// copied from upstream in the audit log
+	audit.RegisterCallbacks(db, &webhook.Delivery{}, &importer.ServiceRevision{})
+	// Replaced by the dispatcher of the server when serving
+	webhook.New(db, webhook.Options{}).RegisterCallbacks(db)
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+
+	"github.com/x0rzkov/oniontree-backend/pkg/database"
+	"github.com/x0rzkov/oniontree-backend/pkg/migrate"
+)
+
+var (
+	migrateTo    uint
+	migrateSteps int
+)
+
+var migrateCmd = &cobra.Command{
+	Use:   "migrate",
+	Short: "Migrate the database schema",
+}
+
+var migrateUpCmd = &cobra.Command{
+	Use:   "up",
+	Short: "Apply pending migrations, up to --to if given",
+	Args:  cobra.NoArgs,
+	RunE: withMigrator(func(m *migrate.Migrator) error {
+		done, err := m.Up(migrateTo)
+		if err != nil {
+			return err
+		}
+		if len(done) == 0 {
+			fmt.Println("Nothing to migrate")
+		}
+		return nil
+	}),
+}
+
+var migrateDownCmd = &cobra.Command{
+	Use:   "down",
+	Short: "Revert the last --steps applied migrations",
+	Args:  cobra.NoArgs,
+	RunE: withMigrator(func(m *migrate.Migrator) error {
+		_, err := m.Down(migrateSteps)
+		return err
+	}),
+}
+
+var migrateStatusCmd = &cobra.Command{
+	Use:   "status",
+	Short: "List migrations and whether they are applied",
+	Args:  cobra.NoArgs,
+	RunE: withMigrator(func(m *migrate.Migrator) error {
+		statuses, err := m.Status()
+		if err != nil {
+			return err
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(w, "VERSION\tNAME\tAPPLIED AT")
+		for _, s := range statuses {
+			applied := "pending"
+			if s.Applied {
+				applied = s.AppliedAt.Format("2006-01-02 15:04:05")
+			}
+			fmt.Fprintf(w, "%d\t%s\t%s\n", s.Version, s.Name, applied)
+		}
+		return w.Flush()
+	}),
+}
+
+func init() {
+	migrateUpCmd.Flags().UintVar(&migrateTo, "to", 0, "version to migrate up to, all pending ones when 0")
+	migrateDownCmd.Flags().IntVar(&migrateSteps, "steps", 1, "number of migrations to revert")
+	migrateCmd.AddCommand(migrateUpCmd, migrateDownCmd, migrateStatusCmd)
+	rootCmd.AddCommand(migrateCmd)
+}
+
+// withMigrator runs f with a Migrator of the configured database, which is
+// left as it is rather than migrated on open.
+func withMigrator(f func(m *migrate.Migrator) error) func(*cobra.Command, []string) error {
+	return func(cmd *cobra.Command, args []string) error {
+		db, err := database.Open(conf.Database)
+		if err != nil {
+			return err
+		}
+		defer db.Close()
+		db.LogMode(conf.Debug)
+		return f(migrate.New(db))
+	}
+}
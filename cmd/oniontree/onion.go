@@ -0,0 +1,48 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+
+	"github.com/x0rzkov/oniontree-backend/pkg/onion"
+)
+
+var onionAddOnion bool
+
+var onionCmd = &cobra.Command{
+	Use:   "onion",
+	Short: "Set up the hidden service of the server and print its address",
+	Long: `Generate the v3 ed25519 key of the hidden service of the server in the
+hidden service directory given by --onion-dir, unless it is there already,
+and print its .onion address. The directory and the key are only accessible
+by their owner, as Tor requires, which must be the user running Tor.
+
+With --onion-torrc, the torrc lines publishing the hidden service on
+--onion-port and forwarding it to --onion-target are written to a file, for
+a Tor including it with %include. With --add-onion, the control port command
+publishing it on a running Tor is printed instead of the address, e.g.
+
+  oniontree onion --onion-dir /var/lib/tor/oniontree --onion-torrc /etc/tor/torrc.d/oniontree.conf
+
+The serve command does the same on start.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		id, err := onion.Setup(conf.Onion)
+		if err != nil {
+			return err
+		}
+		if onionAddOnion {
+			fmt.Println(id.AddOnion(conf.Onion.Port, conf.Onion.Target))
+			return nil
+		}
+		fmt.Println(id.Address())
+		return nil
+	},
+}
+
+func init() {
+	conf.RegisterOnionFlags(onionCmd.Flags())
+	onionCmd.Flags().BoolVar(&onionAddOnion, "add-onion", false, "print the ADD_ONION control port command, which holds the secret key")
+	rootCmd.AddCommand(onionCmd)
+}
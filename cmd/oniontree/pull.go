@@ -0,0 +1,59 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+
+	"github.com/x0rzkov/oniontree-backend/pkg/audit"
+	"github.com/x0rzkov/oniontree-backend/pkg/importer"
+)
+
+var pullCmd = &cobra.Command{
+	Use:   "pull [upstream]",
+	Short: "Pull the changes of the upstream repository since the last import",
+	Long: `Pull the upstream repository, the configured one by default, and store
+the services added, modified and deleted since the last import as a dataset
+update, which is printed. The update waits for approval in the admin unless
+--pull-apply=auto. Unlike sync, the dataset tables are kept. The webhook
+deliveries announcing the applied changes are logged, and sent by the server.`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if len(args) == 1 {
+			conf.Data.Upstream = args[0]
+		}
+		db, err := openDB()
+		if err != nil {
+			return err
+		}
+		defer db.Close()
+		registerCallbacks(db)
+		p, err := importer.NewPuller(audit.WithOrigin(db, audit.OriginImporter), conf.Data)
+		if err != nil {
+			return err
+		}
+		u, err := p.Pull()
+		if err != nil {
+			return err
+		}
+		if u == nil {
+			fmt.Println("Nothing new since the last import or pull")
+			return nil
+		}
+		changes, err := u.ChangeList()
+		if err != nil {
+			return err
+		}
+		for _, c := range changes {
+			fmt.Printf("%s %s\n%s\n", c.Action, c.Slug, c.Diff())
+		}
+		fmt.Printf("%s: %s\n", u.Status, u)
+		return nil
+	},
+}
+
+func init() {
+	conf.RegisterDataFlags(pullCmd.Flags())
+	conf.RegisterPullFlags(pullCmd.Flags())
+	rootCmd.AddCommand(pullCmd)
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+
+	"github.com/x0rzkov/oniontree-backend/pkg/search"
+)
+
+var (
+	searchSize       int
+	searchPublicKeys bool
+)
+
+var searchCmd = &cobra.Command{
+	Use:   "search query...",
+	Short: "Search the services of the local checkout",
+	Long: `Index the services of the local checkout of the upstream repository in
+memory and run a bleve query string on them, e.g. "forum", "+tags.name:market"
+or "description:bitcoin".`,
+	Args: cobra.MinimumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		services, err := search.FromDirectory(conf.Data.Root, searchPublicKeys)
+		if err != nil {
+			return err
+		}
+		index, err := search.NewMemOnly(services)
+		if err != nil {
+			return err
+		}
+		defer index.Close()
+
+		result, err := search.Query(index, strings.Join(args, " "), searchSize)
+		if err != nil {
+			return err
+		}
+		if result.Total == 0 {
+			fmt.Println("Not found")
+			return nil
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(w, "SCORE\tNAME\tTAGS\tURL")
+		for _, hit := range result.Hits {
+			s := services[hit.ID]
+			var tags []string
+			for _, tag := range s.Tags {
+				tags = append(tags, tag.Name)
+			}
+			sort.Strings(tags)
+			url := ""
+			if len(s.URLs) > 0 {
+				url = s.URLs[0].Href
+			}
+			fmt.Fprintf(w, "%.3f\t%s\t%s\t%s\n", hit.Score, s.Name, strings.Join(tags, ","), url)
+		}
+		w.Flush()
+		fmt.Printf("\n%d of %d services\n", len(result.Hits), result.Total)
+
+		for _, facet := range result.Facets {
+			fmt.Println("\nTags:")
+			for _, term := range facet.Terms {
+				fmt.Printf("\t%s (%d)\n", term.Term, term.Count)
+			}
+		}
+		return nil
+	},
+}
+
+func init() {
+	searchCmd.Flags().StringVar(&conf.Data.Root, "data-root", conf.Data.Root, "local checkout of the upstream repository")
+	searchCmd.Flags().IntVarP(&searchSize, "size", "n", 10, "number of results")
+	searchCmd.Flags().BoolVar(&searchPublicKeys, "public-keys", false, "index public keys too")
+	rootCmd.AddCommand(searchCmd)
+}
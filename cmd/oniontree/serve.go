@@ -0,0 +1,62 @@
+package main
+
+import (
+	"github.com/spf13/cobra"
+
+	"github.com/x0rzkov/oniontree-backend/pkg/server"
+)
+
+var serveImport bool
+
+var serveCmd = &cobra.Command{
+	Use:   "serve",
+	Short: "Serve the admin and the public forms",
+	Long: `Serve the admin, the login pages and the public submission and abuse
+report forms, and deliver webhooks. The schema is migrated first.
+
+With --pull-interval, the upstream repository is pulled periodically and the
+changes since the last import are applied, or wait for approval in the admin
+with --pull-apply=approval.
+
+With --check-interval, the URLs of services are checked periodically, see
+the check command.
+
+With --watch, the changes of the files of the data root are imported as they
+are made, and /search answers queries on them.
+
+With --dev-assets, the templates and assets are served from tmpl/ even in a
+build compiled with -tags bindatafs, and reloaded as they are edited.
+
+With --onion-dir, the v3 key of the hidden service of the server is
+generated there on first start, see the onion command.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		db, err := openDB()
+		if err != nil {
+			return err
+		}
+		defer db.Close()
+		if serveImport {
+			if err := importDirectory(db, conf.Data.Root); err != nil {
+				return err
+			}
+		} else {
+			registerCallbacks(db)
+		}
+
+		s, err := server.New(conf, db)
+		if err != nil {
+			return err
+		}
+		return s.ListenAndServe()
+	},
+}
+
+func init() {
+	conf.RegisterServerFlags(serveCmd.Flags())
+	conf.RegisterDataFlags(serveCmd.Flags())
+	conf.RegisterPullFlags(serveCmd.Flags())
+	conf.RegisterOnionFlags(serveCmd.Flags())
+	serveCmd.Flags().BoolVar(&serveImport, "import", false, "import the local checkout before serving")
+	rootCmd.AddCommand(serveCmd)
+}
@@ -0,0 +1,7 @@
+#!/bin/sh
+# Publish the hidden service whose torrc lines the server writes on its first
+# start, at TORRC.
+set -e
+TORRC=${TORRC:-/opt/oniontree/tor/torrc}
+until [ -f "$TORRC" ]; do sleep 1; done
+exec tor -f "$TORRC" --DataDirectory /tmp/tor "$@"
@@ -1,50 +1,115 @@
 module github.com/x0rzkov/oniontree-backend
 
-go 1.13
+go 1.19
 
 require (
+	filippo.io/edwards25519 v1.0.0
+	github.com/andybalholm/brotli v1.0.4
+	github.com/blevesearch/bleve v0.8.1
+	github.com/containous/go-bindata v1.0.0
+	github.com/dolthub/go-mysql-server v0.14.0
+	github.com/fsnotify/fsnotify v1.4.7
+	github.com/go-sql-driver/mysql v1.6.0
+	github.com/goccy/go-yaml v1.3.0
+	github.com/gorilla/sessions v1.2.0
+	github.com/gosimple/slug v1.9.0
+	github.com/iancoleman/strcase v0.0.0-20191112232945-16388991a334
+	github.com/jinzhu/configor v1.1.1
+	github.com/jinzhu/gorm v1.9.12
+	github.com/k0kubun/pp v3.0.1+incompatible
+	github.com/karrick/godirwalk v1.15.3
+	github.com/onionltd/oniontree-tools v0.0.0-20200213140902-a44de8c326f4
+	github.com/qor/admin v0.0.0-20191226032843-24c19e4f3c63
+	github.com/qor/assetfs v0.0.0-20170713023933-ff57fdc13a14
+	github.com/qor/qor v0.0.0-20191022064424-b3deff729f68
+	github.com/qor/roles v0.0.0-20171127035124-d6375609fe3e
+	github.com/qor/validations v0.0.0-20171228122639-f364bca61b46
+	github.com/sergi/go-diff v1.0.0
+	github.com/sirupsen/logrus v1.8.1
+	github.com/spf13/cobra v1.0.0
+	github.com/spf13/pflag v1.0.5
+	golang.org/x/crypto v0.0.0-20210921155107-089bfa567519
+	gopkg.in/src-d/go-billy.v4 v4.3.2
+	gopkg.in/src-d/go-git.v4 v4.13.1
+	gopkg.in/yaml.v3 v3.0.0-20200615113413-eeeca48fe776
+)
+
+require (
+	github.com/BurntSushi/toml v0.3.1 // indirect
 	github.com/RoaringBitmap/roaring v0.4.21 // indirect
 	github.com/andybalholm/cascadia v1.1.0 // indirect
 	github.com/asaskevich/govalidator v0.0.0-20200108200545-475eaeb16496 // indirect
-	github.com/aws/aws-sdk-go v1.29.3 // indirect
-	github.com/blevesearch/bleve v0.8.1 // indirect
 	github.com/blevesearch/go-porterstemmer v1.0.2 // indirect
 	github.com/blevesearch/segment v0.0.0-20160915185041-762005e7a34f // indirect
-	github.com/containous/go-bindata v1.0.0
+	github.com/cespare/xxhash v1.1.0 // indirect
 	github.com/couchbase/vellum v0.0.0-20190829182332-ef2e028c01fd // indirect
+	github.com/davecgh/go-spew v1.1.1 // indirect
 	github.com/disintegration/imaging v1.6.2 // indirect
+	github.com/dolthub/vitess v0.0.0-20221031111135-9aad77e7b39f // indirect
+	github.com/edsrzf/mmap-go v1.0.0 // indirect
+	github.com/emirpasic/gods v1.12.0 // indirect
 	github.com/etcd-io/bbolt v1.3.3 // indirect
-	github.com/goccy/go-yaml v1.3.0
+	github.com/fatih/color v1.7.0 // indirect
+	github.com/glycerine/go-unsnap-stream v0.0.0-20181221182339-f9677308dec2 // indirect
+	github.com/go-kit/kit v0.10.0 // indirect
+	github.com/gocraft/dbr/v2 v2.7.2 // indirect
+	github.com/golang/protobuf v1.5.2 // indirect
+	github.com/golang/snappy v0.0.1 // indirect
+	github.com/google/flatbuffers v2.0.6+incompatible // indirect
+	github.com/google/uuid v1.2.0 // indirect
 	github.com/gorilla/context v1.1.1 // indirect
-	github.com/gorilla/sessions v1.2.0 // indirect
-	github.com/gosimple/slug v1.9.0
-	github.com/iancoleman/strcase v0.0.0-20191112232945-16388991a334 // indirect
-	github.com/jinzhu/configor v1.1.1 // indirect
-	github.com/jinzhu/gorm v1.9.12
+	github.com/gorilla/securecookie v1.1.1 // indirect
+	github.com/hashicorp/golang-lru v0.5.4 // indirect
+	github.com/inconshreveable/mousetrap v1.0.0 // indirect
+	github.com/jbenet/go-context v0.0.0-20150711004518-d14ea06fba99 // indirect
+	github.com/jinzhu/inflection v1.0.0 // indirect
+	github.com/jinzhu/now v1.0.1 // indirect
 	github.com/k0kubun/colorstring v0.0.0-20150214042306-9440f1994b88 // indirect
-	github.com/k0kubun/pp v3.0.1+incompatible
-	github.com/karrick/godirwalk v1.15.3
-	github.com/mattn/go-sqlite3 v2.0.3+incompatible
+	github.com/kevinburke/ssh_config v0.0.0-20190725054713-01f96b0aa0cd // indirect
+	github.com/lestrrat-go/strftime v1.0.4 // indirect
+	github.com/lib/pq v1.10.0 // indirect
+	github.com/mattn/go-colorable v0.1.4 // indirect
+	github.com/mattn/go-isatty v0.0.10 // indirect
+	github.com/mattn/go-sqlite3 v2.0.3+incompatible // indirect
 	github.com/microcosm-cc/bluemonday v1.0.2 // indirect
-	github.com/onionltd/oniontree-tools v0.0.0-20200213140902-a44de8c326f4
-	github.com/qor/admin v0.0.0-20191226032843-24c19e4f3c63
-	github.com/qor/assetfs v0.0.0-20170713023933-ff57fdc13a14
+	github.com/mitchellh/go-homedir v1.1.0 // indirect
+	github.com/mitchellh/hashstructure v1.1.0 // indirect
+	github.com/mschoch/smat v0.0.0-20160514031455-90eadee771ae // indirect
+	github.com/oliveagle/jsonpath v0.0.0-20180606110733-2e52cf6e6852 // indirect
+	github.com/philhofer/fwd v1.0.0 // indirect
+	github.com/pkg/errors v0.9.1 // indirect
+	github.com/pmezard/go-difflib v1.0.0 // indirect
 	github.com/qor/media v0.0.0-20191022071353-19cf289e17d4 // indirect
 	github.com/qor/middlewares v0.0.0-20170822143614-781378b69454 // indirect
 	github.com/qor/oss v0.0.0-20191031055114-aef9ba66bf76 // indirect
-	github.com/qor/qor v0.0.0-20191022064424-b3deff729f68
 	github.com/qor/responder v0.0.0-20171031032654-b6def473574f // indirect
-	github.com/qor/roles v0.0.0-20171127035124-d6375609fe3e // indirect
 	github.com/qor/serializable_meta v0.0.0-20180510060738-5fd8542db417 // indirect
 	github.com/qor/session v0.0.0-20170907035918-8206b0adab70 // indirect
-	github.com/qor/validations v0.0.0-20171228122639-f364bca61b46 // indirect
-	github.com/sirupsen/logrus v1.4.2 // indirect
-	github.com/spf13/pflag v1.0.5 // indirect
+	github.com/rainycape/unidecode v0.0.0-20150907023854-cb7f23ec59be // indirect
+	github.com/shopspring/decimal v1.2.0 // indirect
+	github.com/src-d/gcfg v1.4.0 // indirect
 	github.com/steveyen/gtreap v0.0.0-20150807155958-0abe01ef9be2 // indirect
+	github.com/stretchr/testify v1.7.1 // indirect
 	github.com/theplant/cldr v0.0.0-20190423050709-9f76f7ce4ee8 // indirect
 	github.com/theplant/htmltestingutils v0.0.0-20190423050759-0e06de7b6967 // indirect
 	github.com/theplant/testingutils v0.0.0-20190603093022-26d8b4d95c61 // indirect
+	github.com/tinylib/msgp v1.1.0 // indirect
+	github.com/willf/bitset v1.1.10 // indirect
+	github.com/xanzy/ssh-agent v0.2.1 // indirect
 	github.com/yosssi/gohtml v0.0.0-20190915184251-7ff6f235ecaf // indirect
-	gopkg.in/src-d/go-billy.v4 v4.3.2
-	gopkg.in/src-d/go-git.v4 v4.13.1
+	go.opentelemetry.io/otel v1.7.0 // indirect
+	go.opentelemetry.io/otel/trace v1.7.0 // indirect
+	golang.org/x/mod v0.6.0-dev.0.20220106191415-9b9b3d81d5e3 // indirect
+	golang.org/x/net v0.0.0-20211015210444-4f30a5c0130f // indirect
+	golang.org/x/sync v0.0.0-20210220032951-036812b2e83c // indirect
+	golang.org/x/sys v0.0.0-20211019181941-9d821ace8654 // indirect
+	golang.org/x/text v0.3.7 // indirect
+	golang.org/x/tools v0.1.10 // indirect
+	golang.org/x/xerrors v0.0.0-20200804184101-5ec99f83aff1 // indirect
+	google.golang.org/genproto v0.0.0-20210506142907-4a47615972c2 // indirect
+	google.golang.org/grpc v1.37.0 // indirect
+	google.golang.org/protobuf v1.27.1 // indirect
+	gopkg.in/src-d/go-errors.v1 v1.0.0 // indirect
+	gopkg.in/warnings.v0 v0.1.2 // indirect
+	gopkg.in/yaml.v2 v2.2.4 // indirect
 )
@@ -0,0 +1,155 @@
+package abuse
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	"github.com/qor/validations"
+
+	"github.com/x0rzkov/oniontree-backend/pkg/models"
+)
+
+// Report states.
+const (
+	StateOpen          = "open"
+	StateInvestigating = "investigating"
+	StateActioned      = "actioned"
+	StateDismissed     = "dismissed"
+)
+
+// States lists every report state.
+var States = []string{StateOpen, StateInvestigating, StateActioned, StateDismissed}
+
+// Categories of restricted content a service can be reported for.
+var Categories = []string{"porn", "scam", "phishing", "other"}
+
+// Tables lists every model owned by this package.
+var Tables = []interface{}{
+	&AbuseReport{},
+}
+
+// AbuseReport is a complaint about a listed service.
+type AbuseReport struct {
+	gorm.Model
+	ServiceID  uint
+	Service    *models.Service `gorm:"association_autoupdate:false;association_autocreate:false"`
+	Category   string          `gorm:"size:16"`
+	Details    string          `gorm:"type:text"`
+	Contact    string
+	State      string `gorm:"size:16;index"`
+	Notes      string `gorm:"type:text"`
+	Assignee   string
+	ResolvedAt *time.Time
+}
+
+// BeforeCreate opens new reports.
+func (r *AbuseReport) BeforeCreate() {
+	if r.State == "" {
+		r.State = StateOpen
+	}
+}
+
+// Validate is called by qor/validations before the report is saved.
+func (r *AbuseReport) Validate(db *gorm.DB) {
+	if r.ServiceID == 0 || (db.NewRecord(r) && db.First(&models.Service{}, r.ServiceID).RecordNotFound()) {
+		db.AddError(validations.NewError(r, "Service", "unknown service"))
+	}
+	if strings.TrimSpace(r.Details) == "" {
+		db.AddError(validations.NewError(r, "Details", "details can't be blank"))
+	}
+	if !contains(Categories, r.Category) {
+		db.AddError(validations.NewError(r, "Category", fmt.Sprintf("category must be one of %s", strings.Join(Categories, ", "))))
+	}
+	if r.State != "" && !contains(States, r.State) {
+		db.AddError(validations.NewError(r, "State", fmt.Sprintf("state must be one of %s", strings.Join(States, ", "))))
+	}
+}
+
+// Investigate marks the report as being looked into by assignee.
+func (r *AbuseReport) Investigate(db *gorm.DB, assignee string) error {
+	r.State = StateInvestigating
+	if assignee != "" {
+		r.Assignee = assignee
+	}
+	return db.Save(r).Error
+}
+
+// Dismiss closes the report without touching the service.
+func (r *AbuseReport) Dismiss(db *gorm.DB, note string) error {
+	r.addNote(note)
+	return r.resolve(db, StateDismissed)
+}
+
+// RemoveService deletes the reported service and closes the report.
+func (r *AbuseReport) RemoveService(db *gorm.DB, note string) error {
+	tx := db.Begin()
+	svc := &models.Service{}
+	if err := tx.First(svc, r.ServiceID).Error; err != nil {
+		tx.Rollback()
+		return err
+	}
+	if err := tx.Delete(svc).Error; err != nil {
+		tx.Rollback()
+		return err
+	}
+	r.addNote(note)
+	if err := r.resolve(tx, StateActioned); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit().Error
+}
+
+// TagService tags the reported service, e.g. as "scam", and closes the
+// report.
+func (r *AbuseReport) TagService(db *gorm.DB, tagName, note string) error {
+	tx := db.Begin()
+	svc := &models.Service{}
+	if err := tx.Preload("Tags").First(svc, r.ServiceID).Error; err != nil {
+		tx.Rollback()
+		return err
+	}
+	tag, err := models.FindOrCreateTag(tx, tagName)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	svc.Tags = append(svc.Tags, tag)
+	if err := tx.Save(svc).Error; err != nil {
+		tx.Rollback()
+		return err
+	}
+	r.addNote(note)
+	if err := r.resolve(tx, StateActioned); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit().Error
+}
+
+func (r *AbuseReport) resolve(db *gorm.DB, state string) error {
+	now := time.Now()
+	r.State, r.ResolvedAt = state, &now
+	return db.Save(r).Error
+}
+
+func (r *AbuseReport) addNote(note string) {
+	if note = strings.TrimSpace(note); note == "" {
+		return
+	}
+	if r.Notes != "" {
+		r.Notes += "\n"
+	}
+	r.Notes += fmt.Sprintf("[%s] %s", time.Now().UTC().Format("2006-01-02 15:04"), note)
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
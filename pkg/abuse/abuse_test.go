@@ -0,0 +1,187 @@
+package abuse
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/jinzhu/gorm"
+	_ "github.com/jinzhu/gorm/dialects/sqlite"
+	"github.com/qor/assetfs"
+	"github.com/qor/validations"
+
+	"github.com/x0rzkov/oniontree-backend/pkg/models"
+)
+
+// openDB returns an in-memory database with the dataset and the reports,
+// validated like the application does, and the service dread.
+func openDB(t *testing.T) (*gorm.DB, *models.Service) {
+	db, err := gorm.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.DB().SetMaxOpenConns(1)
+	if err := db.AutoMigrate(append(append([]interface{}{}, models.Tables...), Tables...)...).Error; err != nil {
+		t.Fatal(err)
+	}
+	validations.RegisterCallbacks(db)
+	tag, err := models.FindOrCreateTag(db, "forum")
+	if err != nil {
+		t.Fatal(err)
+	}
+	svc := &models.Service{Name: "Dread", Slug: "dread", Tags: []*models.Tag{tag}}
+	if err := db.Create(svc).Error; err != nil {
+		t.Fatal(err)
+	}
+	return db, svc
+}
+
+func newReport(t *testing.T, db *gorm.DB, svc *models.Service) *AbuseReport {
+	r := &AbuseReport{ServiceID: svc.ID, Category: "scam", Details: "steals coins"}
+	if err := db.Create(r).Error; err != nil {
+		t.Fatal(err)
+	}
+	return r
+}
+
+func TestValidate(t *testing.T) {
+	db, svc := openDB(t)
+	defer db.Close()
+
+	for _, test := range []struct {
+		report AbuseReport
+		field  string
+	}{
+		{AbuseReport{ServiceID: svc.ID, Category: "scam", Details: "steals coins"}, ""},
+		{AbuseReport{ServiceID: svc.ID + 1, Category: "scam", Details: "steals coins"}, "Service"},
+		{AbuseReport{Category: "scam", Details: "steals coins"}, "Service"},
+		{AbuseReport{ServiceID: svc.ID, Category: "scam", Details: "  "}, "Details"},
+		{AbuseReport{ServiceID: svc.ID, Category: "spam", Details: "steals coins"}, "Category"},
+		{AbuseReport{ServiceID: svc.ID, Category: "scam", Details: "steals coins", State: "closed"}, "State"},
+	} {
+		r := test.report
+		errs := db.Create(&r).GetErrors()
+		if test.field == "" {
+			if len(errs) > 0 {
+				t.Errorf("%+v: %v", test.report, errs)
+			} else if r.State != StateOpen {
+				t.Errorf("new report is %s, want %s", r.State, StateOpen)
+			}
+			continue
+		}
+		if len(errs) != 1 {
+			t.Errorf("%+v: errors %v, want one on %s", test.report, errs, test.field)
+			continue
+		}
+		if err, ok := errs[0].(*validations.Error); !ok || err.Column != test.field {
+			t.Errorf("%+v: error %v, want one on %s", test.report, errs[0], test.field)
+		}
+	}
+}
+
+func TestRemoveService(t *testing.T) {
+	db, svc := openDB(t)
+	defer db.Close()
+	r, other := newReport(t, db, svc), newReport(t, db, svc)
+
+	if err := r.RemoveService(db, "confirmed scam"); err != nil {
+		t.Fatal(err)
+	}
+	if !db.First(&models.Service{}, svc.ID).RecordNotFound() {
+		t.Error("the reported service is still listed")
+	}
+	var stored AbuseReport
+	if err := db.First(&stored, r.ID).Error; err != nil {
+		t.Fatal(err)
+	}
+	if stored.State != StateActioned || stored.ResolvedAt == nil || !strings.HasSuffix(stored.Notes, "] confirmed scam") {
+		t.Errorf("report is %s resolved at %v with notes %q", stored.State, stored.ResolvedAt, stored.Notes)
+	}
+
+	// a service already gone fails the action and leaves the report open
+	if err := other.RemoveService(db, ""); err == nil {
+		t.Error("removing a deleted service succeeded")
+	}
+	var unresolved AbuseReport
+	db.First(&unresolved, other.ID)
+	if unresolved.State != StateOpen || unresolved.ResolvedAt != nil {
+		t.Errorf("report is %s after a failed removal, want %s", unresolved.State, StateOpen)
+	}
+}
+
+func TestTagService(t *testing.T) {
+	db, svc := openDB(t)
+	defer db.Close()
+	r := newReport(t, db, svc)
+
+	if err := r.TagService(db, "scam", ""); err != nil {
+		t.Fatal(err)
+	}
+	var stored models.Service
+	if err := db.Preload("Tags").First(&stored, svc.ID).Error; err != nil {
+		t.Fatal(err)
+	}
+	var tags []string
+	for _, tag := range stored.Tags {
+		tags = append(tags, tag.Name)
+	}
+	if strings.Join(tags, ",") != "forum,scam" {
+		t.Errorf("tags of the service = %v, want forum and scam", tags)
+	}
+	var report AbuseReport
+	db.First(&report, r.ID)
+	if report.State != StateActioned || report.ResolvedAt == nil || report.Notes != "" {
+		t.Errorf("report is %s resolved at %v with notes %q", report.State, report.ResolvedAt, report.Notes)
+	}
+}
+
+func TestHandler(t *testing.T) {
+	db, svc := openDB(t)
+	defer db.Close()
+	fs := &assetfs.AssetFileSystem{}
+	if err := fs.RegisterPath("../../tmpl/public"); err != nil {
+		t.Fatal(err)
+	}
+	h := &Handler{DB: db, AssetFS: fs}
+
+	serve := func(method, target string, form url.Values) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, target, strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+		return w
+	}
+
+	w := serve(http.MethodGet, "/report?service=dread", nil)
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `value="dread"`) {
+		t.Errorf("GET = %d, want the form for dread: %s", w.Code, w.Body)
+	}
+
+	w = serve(http.MethodPost, "/report", url.Values{"service": {"dread"}, "category": {"phishing"}, "details": {"fake login"}, "contact": {"me@example.com"}})
+	if w.Code != http.StatusCreated || !strings.Contains(w.Body.String(), "Thank you!") {
+		t.Errorf("POST = %d, want the report created: %s", w.Code, w.Body)
+	}
+	var r AbuseReport
+	if err := db.Last(&r).Error; err != nil {
+		t.Fatal(err)
+	}
+	if r.ServiceID != svc.ID || r.Category != "phishing" || r.Details != "fake login" || r.Contact != "me@example.com" || r.State != StateOpen {
+		t.Errorf("stored report = %+v", r)
+	}
+
+	// the form is shown again with the errors and what was entered
+	w = serve(http.MethodPost, "/report", url.Values{"service": {"nowhere"}, "category": {"scam"}, "details": {"fake login"}})
+	if w.Code != http.StatusUnprocessableEntity || !strings.Contains(w.Body.String(), "unknown service") || !strings.Contains(w.Body.String(), `value="nowhere"`) {
+		t.Errorf("POST of an unknown service = %d: %s", w.Code, w.Body)
+	}
+	var count int
+	if db.Model(&AbuseReport{}).Count(&count); count != 1 {
+		t.Errorf("%d reports stored, want 1", count)
+	}
+
+	if w := serve(http.MethodDelete, "/report", nil); w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("DELETE = %d, want %d", w.Code, http.StatusMethodNotAllowed)
+	}
+}
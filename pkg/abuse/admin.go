@@ -0,0 +1,143 @@
+package abuse
+
+import (
+	"errors"
+
+	"github.com/jinzhu/gorm"
+	"github.com/qor/admin"
+	"github.com/qor/qor"
+
+	"github.com/x0rzkov/oniontree-backend/pkg/auth"
+)
+
+type investigateArgument struct {
+	Assignee string
+}
+
+type resolveArgument struct {
+	Note string
+}
+
+type tagArgument struct {
+	Tag  string
+	Note string
+}
+
+// ConfigureAdmin adds the abuse report triage queue to Admin.
+func ConfigureAdmin(Admin *admin.Admin) {
+	res := Admin.AddResource(&AbuseReport{}, &admin.Config{
+		Menu:       []string{"Moderation"},
+		Permission: auth.Permission(auth.RoleModerator, auth.RoleModerator),
+	})
+	res.IndexAttrs("ID", "CreatedAt", "Service", "Category", "State", "Assignee")
+	res.ShowAttrs("Service", "Category", "Details", "Contact", "State", "Assignee", "Notes", "ResolvedAt")
+	// the state only changes through the actions, which act on the service
+	res.EditAttrs("Service", "Category", "Details", "Contact", "Assignee", "Notes")
+	res.NewAttrs(res.EditAttrs())
+	res.Meta(&admin.Meta{Name: "Category", Config: &admin.SelectOneConfig{Collection: Categories}})
+	res.Meta(&admin.Meta{Name: "Details", Type: "text"})
+	res.Meta(&admin.Meta{Name: "Notes", Type: "text"})
+
+	res.Scope(&admin.Scope{
+		Name:    "unresolved",
+		Group:   "State",
+		Default: true,
+		Handler: func(db *gorm.DB, context *qor.Context) *gorm.DB {
+			return db.Where("state IN (?)", []string{StateOpen, StateInvestigating})
+		},
+	})
+	for _, state := range States {
+		state := state
+		res.Scope(&admin.Scope{
+			Name:  state,
+			Group: "State",
+			Handler: func(db *gorm.DB, context *qor.Context) *gorm.DB {
+				return db.Where("state = ?", state)
+			},
+		})
+	}
+	res.Filter(&admin.Filter{Name: "Category", Config: &admin.SelectOneConfig{Collection: Categories}})
+
+	isUnresolved := func(record interface{}, context *admin.Context) bool {
+		r, ok := record.(*AbuseReport)
+		return !ok || r.State == StateOpen || r.State == StateInvestigating
+	}
+
+	res.Action(&admin.Action{
+		Name:     "Investigate",
+		Visible:  isUnresolved,
+		Resource: Admin.NewResource(&investigateArgument{}),
+		Handler: func(argument *admin.ActionArgument) error {
+			arg := argument.Argument.(*investigateArgument)
+			if arg.Assignee == "" && argument.Context.CurrentUser != nil {
+				arg.Assignee = argument.Context.CurrentUser.DisplayName()
+			}
+			db := argument.Context.GetDB()
+			for _, record := range argument.FindSelectedRecords() {
+				if err := record.(*AbuseReport).Investigate(db, arg.Assignee); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+		Modes:      []string{"show", "menu_item", "batch"},
+		Permission: auth.ActionPermission(auth.RoleModerator),
+	})
+
+	res.Action(&admin.Action{
+		Name:     "Dismiss",
+		Visible:  isUnresolved,
+		Resource: Admin.NewResource(&resolveArgument{}),
+		Handler: func(argument *admin.ActionArgument) error {
+			arg := argument.Argument.(*resolveArgument)
+			db := argument.Context.GetDB()
+			for _, record := range argument.FindSelectedRecords() {
+				if err := record.(*AbuseReport).Dismiss(db, arg.Note); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+		Modes:      []string{"show", "menu_item", "batch"},
+		Permission: auth.ActionPermission(auth.RoleModerator),
+	})
+
+	res.Action(&admin.Action{
+		Name:     "Remove Service",
+		Visible:  isUnresolved,
+		Resource: Admin.NewResource(&resolveArgument{}),
+		Handler: func(argument *admin.ActionArgument) error {
+			arg := argument.Argument.(*resolveArgument)
+			db := argument.Context.GetDB()
+			for _, record := range argument.FindSelectedRecords() {
+				if err := record.(*AbuseReport).RemoveService(db, arg.Note); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+		Modes:      []string{"show", "menu_item"},
+		Permission: auth.ActionPermission(auth.RoleModerator),
+	})
+
+	res.Action(&admin.Action{
+		Name:     "Tag Service",
+		Visible:  isUnresolved,
+		Resource: Admin.NewResource(&tagArgument{}),
+		Handler: func(argument *admin.ActionArgument) error {
+			arg := argument.Argument.(*tagArgument)
+			if arg.Tag == "" {
+				return errors.New("a tag is required")
+			}
+			db := argument.Context.GetDB()
+			for _, record := range argument.FindSelectedRecords() {
+				if err := record.(*AbuseReport).TagService(db, arg.Tag, arg.Note); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+		Modes:      []string{"show", "menu_item"},
+		Permission: auth.ActionPermission(auth.RoleModerator),
+	})
+}
@@ -0,0 +1,63 @@
+package abuse
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/jinzhu/gorm"
+	"github.com/qor/assetfs"
+
+	"github.com/x0rzkov/oniontree-backend/pkg/audit"
+	"github.com/x0rzkov/oniontree-backend/pkg/bindatafs"
+	"github.com/x0rzkov/oniontree-backend/pkg/models"
+)
+
+// Handler serves the public abuse report form. The reported service is
+// picked by slug, e.g. /report?service=dread.
+type Handler struct {
+	DB *gorm.DB
+	// AssetFS resolves report.tmpl.
+	AssetFS assetfs.Interface
+}
+
+type formData struct {
+	Report     *AbuseReport
+	Slug       string
+	Categories []string
+	Errors     []error
+	Submitted  bool
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	data := formData{Report: &AbuseReport{}, Categories: Categories}
+
+	switch r.Method {
+	case http.MethodGet:
+		data.Slug = r.URL.Query().Get("service")
+		h.render(w, http.StatusOK, data)
+	case http.MethodPost:
+		data.Slug = strings.TrimSpace(r.PostFormValue("service"))
+		data.Report = &AbuseReport{
+			Category: r.PostFormValue("category"),
+			Details:  r.PostFormValue("details"),
+			Contact:  r.PostFormValue("contact"),
+		}
+		var svc models.Service
+		if data.Slug != "" && !h.DB.Where("slug = ?", data.Slug).First(&svc).RecordNotFound() {
+			data.Report.ServiceID = svc.ID
+		}
+		if errs := audit.WithOrigin(h.DB, audit.OriginSubmission).Create(data.Report).GetErrors(); len(errs) > 0 {
+			data.Errors = errs
+			h.render(w, http.StatusUnprocessableEntity, data)
+			return
+		}
+		data.Submitted = true
+		h.render(w, http.StatusCreated, data)
+	default:
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+	}
+}
+
+func (h *Handler) render(w http.ResponseWriter, status int, data formData) {
+	bindatafs.Render(w, h.AssetFS, "report.tmpl", status, data)
+}
@@ -0,0 +1,60 @@
+package audit
+
+import (
+	"strings"
+
+	"github.com/jinzhu/gorm"
+	"github.com/qor/admin"
+	"github.com/qor/qor"
+	"github.com/qor/roles"
+
+	"github.com/x0rzkov/oniontree-backend/pkg/auth"
+)
+
+// ConfigureAdmin adds the read-only audit log to Admin, along with its CSV
+// and JSON export at /audit_events/export.
+func ConfigureAdmin(Admin *admin.Admin) {
+	res := Admin.AddResource(&AuditEvent{}, &admin.Config{
+		Menu:       []string{"Audit"},
+		Permission: auth.ReadOnly(auth.RoleMaintainer),
+	})
+	res.IndexAttrs("ID", "CreatedAt", "Actor", "Origin", "Action", "Resource", "ResourceID")
+	res.ShowAttrs("CreatedAt", "Actor", "Origin", "Action", "Resource", "ResourceID", "Conditions", "RowsAffected", "Diff", "Before", "After")
+	res.Meta(&admin.Meta{Name: "Conditions", Type: "text"})
+	res.Meta(&admin.Meta{Name: "Diff", Type: "text"})
+	res.Meta(&admin.Meta{Name: "Before", Type: "text"})
+	res.Meta(&admin.Meta{Name: "After", Type: "text"})
+
+	for _, action := range Actions {
+		action := action
+		res.Scope(&admin.Scope{
+			Name:  action,
+			Group: "Action",
+			Handler: func(db *gorm.DB, context *qor.Context) *gorm.DB {
+				return db.Where("action = ?", action)
+			},
+		})
+	}
+	res.Filter(&admin.Filter{Name: "Origin", Config: &admin.SelectOneConfig{Collection: Origins}})
+	res.Filter(&admin.Filter{Name: "Resource"})
+	res.Filter(&admin.Filter{Name: "ResourceID"})
+	res.Filter(&admin.Filter{Name: "Actor"})
+	res.Filter(&admin.Filter{Name: "CreatedAt"})
+
+	res.RegisterRoute("GET", "/export", func(context *admin.Context) {
+		(&ExportHandler{DB: context.GetDB()}).ServeHTTP(context.Writer, context.Request)
+	}, &admin.RouteConfig{PermissionMode: roles.Read})
+
+	for _, format := range []string{"csv", "json"} {
+		format := format
+		res.Action(&admin.Action{
+			Name:  "Export " + format,
+			Label: "Export " + strings.ToUpper(format),
+			URL: func(record interface{}, context *admin.Context) string {
+				return context.URLFor(res) + "/export?format=" + format
+			},
+			Modes:      []string{"collection"},
+			Permission: auth.ReadOnly(auth.RoleMaintainer),
+		})
+	}
+}
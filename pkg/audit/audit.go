@@ -0,0 +1,91 @@
+package audit
+
+import (
+	"errors"
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+// Actions recorded by the audit log.
+const (
+	ActionCreate = "create"
+	ActionUpdate = "update"
+	ActionDelete = "delete"
+)
+
+// Actions lists every action.
+var Actions = []string{ActionCreate, ActionUpdate, ActionDelete}
+
+// Origins tell which part of the application made a change.
+const (
+	// OriginImporter is the import of the upstream dataset.
+	OriginImporter = "importer"
+	// OriginAdmin is the admin interface.
+	OriginAdmin = "admin"
+	// OriginAPI is the HTTP API.
+	OriginAPI = "api"
+	// OriginSubmission is the public submission and report forms.
+	OriginSubmission = "submission"
+	// OriginSystem is everything else, such as background jobs.
+	OriginSystem = "system"
+)
+
+// Origins lists every origin.
+var Origins = []string{OriginImporter, OriginAdmin, OriginAPI, OriginSubmission, OriginSystem}
+
+// Tables lists every model owned by this package.
+var Tables = []interface{}{
+	&AuditEvent{},
+}
+
+// ErrAppendOnly is returned when trying to change a recorded event.
+var ErrAppendOnly = errors.New("audit: events are append-only")
+
+// AuditEvent records a single create, update or delete of a record, or a
+// bulk update or delete of the records matching some conditions.
+type AuditEvent struct {
+	ID        uint      `gorm:"primary_key"`
+	CreatedAt time.Time `gorm:"index"`
+	// Actor is the name of the admin user who made the change, empty for
+	// anonymous changes.
+	Actor  string `gorm:"size:64;index"`
+	Origin string `gorm:"size:16;index"`
+	// Resource is the table name of the changed record.
+	Resource   string `gorm:"size:64;index:idx_audit_events_resource"`
+	ResourceID string `gorm:"size:64;index:idx_audit_events_resource"`
+	Action     string `gorm:"size:16;index"`
+	// Before and After are the JSON encoding of the record, Before is
+	// empty on create and After on delete.
+	Before string `gorm:"type:text"`
+	After  string `gorm:"type:text"`
+	// Diff is a JSON object mapping every changed field to its before and
+	// after value. That of a bulk update maps the changed columns to the
+	// value they were set to.
+	Diff string `gorm:"type:text"`
+	// Conditions is the WHERE clause of a bulk update or delete, which
+	// changed RowsAffected rows rather than the single record ResourceID.
+	Conditions   string `gorm:"type:text"`
+	RowsAffected int64
+}
+
+// BeforeUpdate keeps recorded events from being changed.
+func (e *AuditEvent) BeforeUpdate() error {
+	return ErrAppendOnly
+}
+
+// BeforeDelete keeps recorded events from being deleted.
+func (e *AuditEvent) BeforeDelete() error {
+	return ErrAppendOnly
+}
+
+// WithOrigin returns db recording origin as the origin of its changes.
+func WithOrigin(db *gorm.DB, origin string) *gorm.DB {
+	return db.Set(originKey, origin)
+}
+
+// WithActor returns db recording actor as the author of its changes, for
+// changes not made through the admin interface.
+func WithActor(db *gorm.DB, actor string) *gorm.DB {
+	return db.Set(actorKey, actor)
+}
@@ -0,0 +1,285 @@
+package audit
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/jinzhu/gorm"
+	"github.com/qor/qor"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	originKey      = "audit:origin"
+	actorKey       = "audit:actor"
+	currentUserKey = "qor:current_user"
+	snapshotKey    = "audit:before"
+)
+
+// ignoredFields are left out of diffs, they change on every save or check.
+var ignoredFields = map[string]bool{"UpdatedAt": true, "CheckedAt": true}
+
+type recorder struct {
+	ignore map[reflect.Type]bool
+}
+
+// RegisterCallbacks records an AuditEvent for every record created, updated
+// or deleted through db, except for the models listed in ignore. Events are
+// written in the transaction of the change, so they are rolled back with it.
+// Updates which change nothing but the timestamp aren't recorded. Bulk
+// updates and deletes, which don't point to a single record, are recorded as
+// one event with their conditions and the number of rows they changed.
+func RegisterCallbacks(db *gorm.DB, ignore ...interface{}) {
+	r := &recorder{ignore: map[reflect.Type]bool{
+		reflect.TypeOf(AuditEvent{}): true,
+	}}
+	for _, model := range ignore {
+		r.ignore[reflect.Indirect(reflect.ValueOf(model)).Type()] = true
+	}
+
+	db.Callback().Create().Before("gorm:commit_or_rollback_transaction").Register("audit:after_create", r.afterCreate)
+	db.Callback().Update().Before("gorm:before_update").Register("audit:before_update", r.before)
+	db.Callback().Update().Before("gorm:commit_or_rollback_transaction").Register("audit:after_update", r.afterUpdate)
+	db.Callback().Delete().Before("gorm:before_delete").Register("audit:before_delete", r.before)
+	db.Callback().Delete().Before("gorm:commit_or_rollback_transaction").Register("audit:after_delete", r.afterDelete)
+}
+
+// audited reports whether changes to the model of scope are recorded.
+func (r *recorder) audited(scope *gorm.Scope) bool {
+	value := scope.IndirectValue()
+	return value.Kind() == reflect.Struct && !r.ignore[value.Type()]
+}
+
+// bulk reports whether scope changes every row matching its conditions
+// rather than a single record.
+func bulk(scope *gorm.Scope) bool {
+	return scope.PrimaryKeyZero()
+}
+
+func (r *recorder) before(scope *gorm.Scope) {
+	if scope.HasError() || !r.audited(scope) || bulk(scope) {
+		return
+	}
+	if before, err := snapshot(scope); err == nil {
+		scope.InstanceSet(snapshotKey, before)
+	}
+}
+
+func (r *recorder) afterCreate(scope *gorm.Scope) {
+	if scope.HasError() || !r.audited(scope) || bulk(scope) {
+		return
+	}
+	after, err := snapshot(scope)
+	if err != nil {
+		log.Errorf("audit: loading %s %v: %s", scope.TableName(), scope.PrimaryKeyValue(), err)
+		return
+	}
+	r.record(scope, ActionCreate, nil, after)
+}
+
+func (r *recorder) afterUpdate(scope *gorm.Scope) {
+	if scope.HasError() || !r.audited(scope) {
+		return
+	}
+	if bulk(scope) {
+		r.recordBulk(scope, ActionUpdate)
+		return
+	}
+	after, err := snapshot(scope)
+	if err != nil {
+		log.Errorf("audit: loading %s %v: %s", scope.TableName(), scope.PrimaryKeyValue(), err)
+		return
+	}
+	before, _ := scope.InstanceGet(snapshotKey)
+	r.record(scope, ActionUpdate, before, after)
+}
+
+func (r *recorder) afterDelete(scope *gorm.Scope) {
+	if scope.HasError() || !r.audited(scope) {
+		return
+	}
+	if bulk(scope) {
+		r.recordBulk(scope, ActionDelete)
+		return
+	}
+	before, _ := scope.InstanceGet(snapshotKey)
+	r.record(scope, ActionDelete, before, nil)
+}
+
+func (r *recorder) record(scope *gorm.Scope, action string, before, after interface{}) {
+	event := &AuditEvent{
+		Actor:      actor(scope),
+		Origin:     origin(scope),
+		Resource:   scope.TableName(),
+		ResourceID: fmt.Sprint(scope.PrimaryKeyValue()),
+		Action:     action,
+	}
+
+	beforeJSON, beforeFields, err := encode(before)
+	if err != nil {
+		scope.Err(err)
+		return
+	}
+	afterJSON, afterFields, err := encode(after)
+	if err != nil {
+		scope.Err(err)
+		return
+	}
+	changes := diff(beforeFields, afterFields)
+	if action == ActionUpdate && len(changes) == 0 {
+		return
+	}
+	diffJSON, err := json.Marshal(changes)
+	if err != nil {
+		scope.Err(err)
+		return
+	}
+	event.Before, event.After, event.Diff = beforeJSON, afterJSON, string(diffJSON)
+
+	// Written through the connection of the change, which may be in a
+	// transaction.
+	if err := scope.NewDB().Create(event).Error; err != nil {
+		scope.Err(fmt.Errorf("audit: %s", err))
+	}
+}
+
+// recordBulk records a bulk update or delete of scope, unless it changed no
+// row. The diff of an update holds the values the rows were set to.
+func (r *recorder) recordBulk(scope *gorm.Scope, action string) {
+	rows := scope.DB().RowsAffected
+	if rows == 0 {
+		return
+	}
+	changes := map[string]Change{}
+	if attrs, ok := scope.InstanceGet("gorm:update_attrs"); ok {
+		for column, value := range attrs.(map[string]interface{}) {
+			field, ok := scope.FieldByName(column)
+			if ok && ignoredFields[field.Name] {
+				continue
+			}
+			if expr, ok := value.(*gorm.SqlExpr); ok {
+				// the SQL of expressions such as gorm.Expr("updated_at")
+				value = reflect.ValueOf(expr).Elem().FieldByName("expr").String()
+			}
+			changes[column] = Change{After: value}
+		}
+		if len(changes) == 0 {
+			return
+		}
+	}
+	diffJSON, err := json.Marshal(changes)
+	if err != nil {
+		scope.Err(err)
+		return
+	}
+	event := &AuditEvent{
+		Actor:        actor(scope),
+		Origin:       origin(scope),
+		Resource:     scope.TableName(),
+		Action:       action,
+		Diff:         string(diffJSON),
+		Conditions:   conditions(scope),
+		RowsAffected: rows,
+	}
+	if err := scope.NewDB().Create(event).Error; err != nil {
+		scope.Err(fmt.Errorf("audit: %s", err))
+	}
+}
+
+// conditions returns the WHERE clause of scope, with its values inlined as
+// JSON.
+func conditions(scope *gorm.Scope) string {
+	// a fresh scope, building the clause adds its values to the variables
+	where := scope.DB().NewScope(scope.Value)
+	sql := strings.TrimSpace(where.CombinedConditionSql())
+	for i, v := range where.SQLVars {
+		value, err := json.Marshal(v)
+		if err != nil {
+			value = []byte(fmt.Sprint(v))
+		}
+		sql = strings.Replace(sql, where.Dialect().BindVar(i+1), string(value), 1)
+	}
+	return sql
+}
+
+// snapshot loads the stored state of the record of scope, along with its
+// many to many associations, such as the tags of a service.
+func snapshot(scope *gorm.Scope) (interface{}, error) {
+	modelStruct := scope.GetModelStruct()
+	record := reflect.New(modelStruct.ModelType).Interface()
+	db := scope.NewDB().Unscoped()
+	for _, field := range modelStruct.StructFields {
+		if field.Relationship != nil && field.Relationship.Kind == "many_to_many" {
+			db = db.Preload(field.Name)
+		}
+	}
+	query := fmt.Sprintf("%s.%s = ?", scope.QuotedTableName(), scope.Quote(scope.PrimaryKey()))
+	if err := db.Where(query, scope.PrimaryKeyValue()).First(record).Error; err != nil {
+		return nil, err
+	}
+	return record, nil
+}
+
+func actor(scope *gorm.Scope) string {
+	if v, ok := scope.Get(actorKey); ok {
+		if name, ok := v.(string); ok {
+			return name
+		}
+	}
+	if v, ok := scope.Get(currentUserKey); ok {
+		if user, ok := v.(qor.CurrentUser); ok && user != nil {
+			return user.DisplayName()
+		}
+	}
+	return ""
+}
+
+func origin(scope *gorm.Scope) string {
+	if v, ok := scope.Get(originKey); ok {
+		if name, ok := v.(string); ok && name != "" {
+			return name
+		}
+	}
+	if v, ok := scope.Get(currentUserKey); ok && v != nil {
+		return OriginAdmin
+	}
+	return OriginSystem
+}
+
+func encode(record interface{}) (string, map[string]interface{}, error) {
+	if record == nil {
+		return "", nil, nil
+	}
+	b, err := json.Marshal(record)
+	if err != nil {
+		return "", nil, err
+	}
+	var fields map[string]interface{}
+	if err := json.Unmarshal(b, &fields); err != nil {
+		return "", nil, err
+	}
+	return string(b), fields, nil
+}
+
+// Change is the before and after value of a changed field.
+type Change struct {
+	Before interface{} `json:"before"`
+	After  interface{} `json:"after"`
+}
+
+func diff(before, after map[string]interface{}) map[string]Change {
+	changes := map[string]Change{}
+	for name, value := range after {
+		if !ignoredFields[name] && !reflect.DeepEqual(before[name], value) {
+			changes[name] = Change{Before: before[name], After: value}
+		}
+	}
+	for name, value := range before {
+		if _, ok := after[name]; !ok && value != nil && !ignoredFields[name] {
+			changes[name] = Change{Before: value}
+		}
+	}
+	return changes
+}
@@ -0,0 +1,232 @@
+package audit
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/jinzhu/gorm"
+	_ "github.com/jinzhu/gorm/dialects/sqlite"
+)
+
+type widget struct {
+	gorm.Model
+	Name  string
+	Color string
+}
+
+// note is left out of the audit log.
+type note struct {
+	ID   uint `gorm:"primary_key"`
+	Text string
+}
+
+type user string
+
+func (u user) DisplayName() string { return string(u) }
+
+// openDB returns an in-memory database recording the changes of widgets.
+func openDB(t *testing.T) *gorm.DB {
+	db, err := gorm.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.DB().SetMaxOpenConns(1)
+	if err := db.AutoMigrate(&AuditEvent{}, &widget{}, &note{}).Error; err != nil {
+		t.Fatal(err)
+	}
+	RegisterCallbacks(db, &note{})
+	return db
+}
+
+func events(t *testing.T, db *gorm.DB) []AuditEvent {
+	var events []AuditEvent
+	if err := db.Order("id").Find(&events).Error; err != nil {
+		t.Fatal(err)
+	}
+	return events
+}
+
+func changes(t *testing.T, e AuditEvent) map[string]Change {
+	var changes map[string]Change
+	if err := json.Unmarshal([]byte(e.Diff), &changes); err != nil {
+		t.Fatalf("diff %q: %s", e.Diff, err)
+	}
+	return changes
+}
+
+func TestRecord(t *testing.T) {
+	db := openDB(t)
+	defer db.Close()
+	tx := WithActor(WithOrigin(db, OriginAPI), "alice")
+
+	w := &widget{Name: "a", Color: "blue"}
+	if err := tx.Create(w).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := tx.Model(w).Update("name", "b").Error; err != nil {
+		t.Fatal(err)
+	}
+	// only the timestamp changes
+	if err := tx.Save(w).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := tx.Delete(w).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := tx.Create(&note{Text: "ignored"}).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	got := events(t, db)
+	if len(got) != 3 {
+		t.Fatalf("%d events, want 3: %+v", len(got), got)
+	}
+	for i, action := range []string{ActionCreate, ActionUpdate, ActionDelete} {
+		e := got[i]
+		if e.Action != action || e.Resource != "widgets" || e.ResourceID != "1" || e.Actor != "alice" || e.Origin != OriginAPI {
+			t.Errorf("event %d = %s %s %s by %q from %s", i, e.Action, e.Resource, e.ResourceID, e.Actor, e.Origin)
+		}
+	}
+	if got[0].Before != "" || got[0].After == "" || got[2].Before == "" {
+		t.Errorf("before and after of the create = %q, %q", got[0].Before, got[0].After)
+	}
+	if c := changes(t, got[0]); c["Name"].After != "a" || c["Color"].After != "blue" || c["Name"].Before != nil {
+		t.Errorf("diff of the create = %v", c)
+	}
+	if c := changes(t, got[1]); len(c) != 1 || c["Name"] != (Change{Before: "a", After: "b"}) {
+		t.Errorf("diff of the update = %v, want only the name", c)
+	}
+	if c := changes(t, got[2]); c["Name"].Before != "b" || c["Name"].After != nil {
+		t.Errorf("diff of the delete = %v", c)
+	}
+}
+
+func TestActorAndOrigin(t *testing.T) {
+	db := openDB(t)
+	defer db.Close()
+
+	for _, test := range []struct {
+		db            *gorm.DB
+		actor, origin string
+	}{
+		{db, "", OriginSystem},
+		{WithOrigin(db, OriginImporter), "", OriginImporter},
+		// the admin sets the current user
+		{db.Set(currentUserKey, user("bob")), "bob", OriginAdmin},
+		{WithOrigin(db.Set(currentUserKey, user("bob")), OriginSubmission), "bob", OriginSubmission},
+		// an explicit actor wins over the current user
+		{WithActor(db.Set(currentUserKey, user("bob")), "carol"), "carol", OriginAdmin},
+	} {
+		if err := test.db.Create(&widget{Name: "w"}).Error; err != nil {
+			t.Fatal(err)
+		}
+		var e AuditEvent
+		db.Last(&e)
+		if e.Actor != test.actor || e.Origin != test.origin {
+			t.Errorf("event by %q from %s, want %q from %s", e.Actor, e.Origin, test.actor, test.origin)
+		}
+	}
+}
+
+func TestRecordBulk(t *testing.T) {
+	db := openDB(t)
+	defer db.Close()
+	for _, name := range []string{"a1", "a2", "b1"} {
+		if err := db.Create(&widget{Name: name}).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	start := len(events(t, db))
+	tx := WithActor(db, "alice")
+
+	if err := tx.Model(&widget{}).Where("name LIKE ?", "a%").Update("color", "red").Error; err != nil {
+		t.Fatal(err)
+	}
+	// no row matches
+	if err := tx.Model(&widget{}).Where("name = ?", "z").Update("color", "red").Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := tx.Where("color = ?", "red").Delete(&widget{}).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := tx.Model(&note{}).Where("id > 0").Update("text", "ignored").Error; err != nil {
+		t.Fatal(err)
+	}
+
+	got := events(t, db)[start:]
+	if len(got) != 2 {
+		t.Fatalf("%d bulk events, want 2: %+v", len(got), got)
+	}
+	update, del := got[0], got[1]
+	if update.Action != ActionUpdate || update.Resource != "widgets" || update.ResourceID != "" || update.Actor != "alice" || update.RowsAffected != 2 {
+		t.Errorf("bulk update = %+v", update)
+	}
+	if !strings.Contains(update.Conditions, `name LIKE "a%"`) {
+		t.Errorf("conditions of the bulk update = %q", update.Conditions)
+	}
+	if c := changes(t, update); len(c) != 1 || c["color"].After != "red" {
+		t.Errorf("diff of the bulk update = %v, want the color without the timestamp", c)
+	}
+	if del.Action != ActionDelete || del.RowsAffected != 2 || !strings.Contains(del.Conditions, `color = "red"`) {
+		t.Errorf("bulk delete = %+v", del)
+	}
+}
+
+func TestExportHandler(t *testing.T) {
+	db := openDB(t)
+	defer db.Close()
+	w := &widget{Name: "a"}
+	db.Create(w)
+	db.Model(w).Update("name", "b")
+	db.Model(&widget{}).Where("name = ?", "b").Update("color", "red")
+	h := &ExportHandler{DB: db}
+
+	get := func(query string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/export"+query, nil))
+		return rec
+	}
+
+	rec := get("")
+	if ct := rec.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/csv") {
+		t.Errorf("Content-Type = %q, want CSV", ct)
+	}
+	records, err := csv.NewReader(rec.Body).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 4 || records[0][0] != "id" || records[0][len(records[0])-1] != "rows_affected" {
+		t.Fatalf("CSV = %v, want a header and 3 events", records)
+	}
+	if bulk := records[3]; bulk[6] != ActionUpdate || bulk[5] != "" || !strings.Contains(bulk[10], `name = "b"`) || bulk[11] != "1" {
+		t.Errorf("CSV of the bulk update = %v", bulk)
+	}
+
+	rec = get("?format=json&action=update")
+	if ct := rec.Header().Get("Content-Type"); ct != "application/x-ndjson" {
+		t.Errorf("Content-Type = %q, want JSON lines", ct)
+	}
+	var exported []AuditEvent
+	scanner := bufio.NewScanner(rec.Body)
+	for scanner.Scan() {
+		var e AuditEvent
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			t.Fatal(err)
+		}
+		exported = append(exported, e)
+	}
+	if len(exported) != 2 || exported[0].ResourceID != "1" || exported[1].RowsAffected != 1 {
+		t.Errorf("JSON of the updates = %+v", exported)
+	}
+
+	for _, query := range []string{"?format=xml", "?since=yesterday"} {
+		if rec := get(query); rec.Code != http.StatusBadRequest {
+			t.Errorf("%s: status %d, want %d", query, rec.Code, http.StatusBadRequest)
+		}
+	}
+}
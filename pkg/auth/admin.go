@@ -0,0 +1,38 @@
+package auth
+
+import (
+	"github.com/qor/admin"
+	"github.com/qor/qor"
+	"github.com/qor/qor/resource"
+	"github.com/qor/qor/utils"
+)
+
+// ConfigureAdmin adds user management to Admin and makes a bare Admin
+// require logging in.
+func (a *Auth) ConfigureAdmin(Admin *admin.Admin) {
+	Admin.SetAuth(a)
+
+	res := Admin.AddResource(&User{}, &admin.Config{
+		Menu:       []string{"Access"},
+		Permission: Permission(RoleAdmin, RoleAdmin),
+	})
+	res.IndexAttrs("ID", "Name", "Role", "Disabled", "CreatedAt")
+	res.EditAttrs("Name", "Password", "Role", "Disabled")
+	res.NewAttrs(res.EditAttrs())
+	res.ShowAttrs("Name", "Role", "Disabled", "CreatedAt", "UpdatedAt")
+	res.Meta(&admin.Meta{Name: "Role", Config: &admin.SelectOneConfig{Collection: Roles}})
+	res.Meta(&admin.Meta{
+		Name: "Password",
+		Type: "password",
+		Valuer: func(record interface{}, context *qor.Context) interface{} {
+			return ""
+		},
+		Setter: func(record interface{}, metaValue *resource.MetaValue, context *qor.Context) {
+			if password := utils.ToString(metaValue.Value); password != "" {
+				if err := record.(*User).SetPassword(password); err != nil {
+					context.AddError(err)
+				}
+			}
+		},
+	})
+}
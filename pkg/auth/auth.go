@@ -0,0 +1,146 @@
+package auth
+
+import (
+	"crypto/sha256"
+	"io"
+	"net/http"
+
+	"github.com/gorilla/sessions"
+	"github.com/jinzhu/gorm"
+	"github.com/qor/admin"
+	"github.com/qor/assetfs"
+	"github.com/qor/qor"
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/crypto/hkdf"
+
+	"github.com/x0rzkov/oniontree-backend/pkg/bindatafs"
+)
+
+const (
+	sessionName = "oniontree_session"
+	userIDKey   = "user_id"
+)
+
+// Auth authenticates admin users against the users table and keeps them
+// logged in with a cookie session. It implements admin.Auth.
+type Auth struct {
+	DB *gorm.DB
+	// AssetFS resolves login.tmpl.
+	AssetFS assetfs.Interface
+	// Prefix is where the login and logout handlers are mounted.
+	Prefix string
+	// AfterLoginURL is where users land after logging in.
+	AfterLoginURL string
+
+	store *sessions.CookieStore
+}
+
+// New returns an Auth signing and encrypting its session cookie with keys
+// derived from sessionKey, which must be at least 32 bytes long.
+func New(db *gorm.DB, fs assetfs.Interface, sessionKey []byte) *Auth {
+	store := sessions.NewCookieStore(sessionKeys(sessionKey))
+	store.Options = &sessions.Options{
+		Path:     "/",
+		MaxAge:   12 * 60 * 60,
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	}
+	return &Auth{
+		DB:            db,
+		AssetFS:       fs,
+		Prefix:        "/auth",
+		AfterLoginURL: "/admin",
+		store:         store,
+	}
+}
+
+// sessionKeys derives independent keys from sessionKey with HKDF: one to
+// authenticate the session cookie with HMAC-SHA256 and one to encrypt it
+// with AES-256.
+func sessionKeys(sessionKey []byte) (hashKey, blockKey []byte) {
+	derive := func(info string, size int) []byte {
+		key := make([]byte, size)
+		// can't fail, HKDF-SHA256 reads up to 8160 bytes
+		io.ReadFull(hkdf.New(sha256.New, sessionKey, nil, []byte(info)), key)
+		return key
+	}
+	return derive("oniontree session authentication", 32), derive("oniontree session encryption", 32)
+}
+
+// GetCurrentUser implements admin.Auth.
+func (a *Auth) GetCurrentUser(context *admin.Context) qor.CurrentUser {
+	if u := a.CurrentUser(context.Request); u != nil {
+		return u
+	}
+	return nil
+}
+
+// LoginURL implements admin.Auth.
+func (a *Auth) LoginURL(context *admin.Context) string {
+	return a.Prefix + "/login"
+}
+
+// LogoutURL implements admin.Auth.
+func (a *Auth) LogoutURL(context *admin.Context) string {
+	return a.Prefix + "/logout"
+}
+
+// CurrentUser returns the enabled user logged in on req, if any.
+func (a *Auth) CurrentUser(req *http.Request) *User {
+	session, err := a.store.Get(req, sessionName)
+	if err != nil {
+		return nil
+	}
+	id, ok := session.Values[userIDKey].(uint)
+	if !ok {
+		return nil
+	}
+	var u User
+	if a.DB.First(&u, id).RecordNotFound() || u.Disabled {
+		return nil
+	}
+	return &u
+}
+
+// MountTo mounts the login and logout handlers to mux.
+func (a *Auth) MountTo(mux *http.ServeMux) {
+	mux.HandleFunc(a.Prefix+"/login", a.login)
+	mux.HandleFunc(a.Prefix+"/logout", a.logout)
+}
+
+func (a *Auth) login(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		a.render(w, http.StatusOK, "")
+	case http.MethodPost:
+		var u User
+		name, password := r.PostFormValue("name"), r.PostFormValue("password")
+		if a.DB.Where("name = ?", name).First(&u).RecordNotFound() || u.Disabled || !u.CheckPassword(password) {
+			log.Warnf("auth: failed login for %q from %s", name, r.RemoteAddr)
+			a.render(w, http.StatusUnauthorized, "Invalid name or password.")
+			return
+		}
+		session, _ := a.store.Get(r, sessionName)
+		session.Values[userIDKey] = u.ID
+		if err := session.Save(r, w); err != nil {
+			log.Errorf("auth: saving session: %s", err)
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+		http.Redirect(w, r, a.AfterLoginURL, http.StatusSeeOther)
+	default:
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+	}
+}
+
+func (a *Auth) logout(w http.ResponseWriter, r *http.Request) {
+	session, _ := a.store.Get(r, sessionName)
+	session.Options.MaxAge = -1
+	delete(session.Values, userIDKey)
+	session.Save(r, w)
+	http.Redirect(w, r, a.Prefix+"/login", http.StatusSeeOther)
+}
+
+func (a *Auth) render(w http.ResponseWriter, status int, message string) {
+	bindatafs.Render(w, a.AssetFS, "login.tmpl", status, struct{ Error string }{message})
+}
@@ -0,0 +1,192 @@
+package auth
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/jinzhu/gorm"
+	_ "github.com/jinzhu/gorm/dialects/sqlite"
+	"github.com/qor/assetfs"
+	"github.com/qor/roles"
+)
+
+func TestRoles(t *testing.T) {
+	for _, test := range []struct {
+		user User
+		held []string
+	}{
+		{User{Role: RoleViewer}, []string{RoleViewer}},
+		{User{Role: RoleModerator}, []string{RoleViewer, RoleModerator}},
+		{User{Role: RoleMaintainer}, []string{RoleViewer, RoleModerator, RoleMaintainer}},
+		{User{Role: RoleAdmin}, Roles},
+		{User{Role: RoleAdmin, Disabled: true}, nil},
+		{User{Role: "root"}, nil},
+	} {
+		req := httptest.NewRequest(http.MethodGet, "/admin", nil)
+		// matched in no particular order
+		held, want := roles.MatchedRoles(req, &test.user), append([]string{}, test.held...)
+		sort.Strings(held)
+		sort.Strings(want)
+		if strings.Join(held, ",") != strings.Join(want, ",") {
+			t.Errorf("%s (disabled %v) holds %v, want %v", test.user.Role, test.user.Disabled, held, test.held)
+		}
+	}
+	if (User{Role: RoleAdmin}).HasRole("root") {
+		t.Error("an admin holds an unknown role")
+	}
+}
+
+func TestPermissions(t *testing.T) {
+	has := func(p *roles.Permission, mode roles.PermissionMode, role string) bool {
+		req := httptest.NewRequest(http.MethodGet, "/admin", nil)
+		var held []interface{}
+		for _, r := range roles.MatchedRoles(req, &User{Role: role}) {
+			held = append(held, r)
+		}
+		return p.HasPermission(mode, held...)
+	}
+
+	readOnly := ReadOnly(RoleMaintainer)
+	for _, mode := range []roles.PermissionMode{roles.Create, roles.Update, roles.Delete} {
+		if has(readOnly, mode, RoleAdmin) {
+			t.Errorf("ReadOnly grants %s to an admin", mode)
+		}
+	}
+	if !has(readOnly, roles.Read, RoleMaintainer) || !has(readOnly, roles.Read, RoleAdmin) || has(readOnly, roles.Read, RoleModerator) {
+		t.Error("ReadOnly(maintainer) doesn't grant read to maintainers and admins only")
+	}
+
+	p := Permission(RoleViewer, RoleMaintainer)
+	if !has(p, roles.Read, RoleViewer) || has(p, roles.Update, RoleModerator) || !has(p, roles.Delete, RoleAdmin) {
+		t.Error("Permission(viewer, maintainer) doesn't grant changes to maintainers and admins only")
+	}
+	if a := ActionPermission(RoleModerator); !has(a, roles.Update, RoleModerator) || has(a, roles.Update, RoleViewer) {
+		t.Error("ActionPermission(moderator) doesn't restrict the action to moderators")
+	}
+}
+
+func TestSessionKeys(t *testing.T) {
+	key := bytes.Repeat([]byte("k"), 32)
+	hashKey, blockKey := sessionKeys(key)
+	if len(hashKey) != 32 || len(blockKey) != 32 {
+		t.Fatalf("keys of %d and %d bytes, want 32", len(hashKey), len(blockKey))
+	}
+	if bytes.Equal(hashKey, blockKey) || bytes.Contains(key, blockKey) || bytes.Contains(key, hashKey) {
+		t.Error("the session keys aren't independent")
+	}
+	if h, b := sessionKeys(key); !bytes.Equal(h, hashKey) || !bytes.Equal(b, blockKey) {
+		t.Error("the session keys change across restarts")
+	}
+}
+
+// newAuth returns an Auth of an in-memory database with the enabled user
+// alice and the disabled user bob, both of password "secret".
+func newAuth(t *testing.T) (*Auth, *http.ServeMux) {
+	db, err := gorm.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.DB().SetMaxOpenConns(1)
+	t.Cleanup(func() { db.Close() })
+	if err := db.AutoMigrate(Tables...).Error; err != nil {
+		t.Fatal(err)
+	}
+	for _, u := range []*User{{Name: "alice", Role: RoleModerator}, {Name: "bob", Role: RoleAdmin, Disabled: true}} {
+		if err := u.SetPassword("secret"); err != nil {
+			t.Fatal(err)
+		}
+		if err := db.Create(u).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	fs := &assetfs.AssetFileSystem{}
+	if err := fs.RegisterPath("../../tmpl/public"); err != nil {
+		t.Fatal(err)
+	}
+	a := New(db, fs, bytes.Repeat([]byte("k"), 32))
+	mux := http.NewServeMux()
+	a.MountTo(mux)
+	return a, mux
+}
+
+func login(mux *http.ServeMux, name, password string) *httptest.ResponseRecorder {
+	form := url.Values{"name": {name}, "password": {password}}
+	req := httptest.NewRequest(http.MethodPost, "/auth/login", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, req)
+	return w
+}
+
+// withCookies returns a request carrying the cookies set by w.
+func withCookies(w *httptest.ResponseRecorder, target string) *http.Request {
+	req := httptest.NewRequest(http.MethodGet, target, nil)
+	for _, c := range w.Result().Cookies() {
+		req.AddCookie(c)
+	}
+	return req
+}
+
+func TestLogin(t *testing.T) {
+	a, mux := newAuth(t)
+
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/auth/login", nil))
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `name="password"`) {
+		t.Errorf("GET /auth/login = %d, want the form", w.Code)
+	}
+
+	for _, test := range []struct{ name, password string }{
+		{"alice", "wrong"},
+		{"alice", ""},
+		{"carol", "secret"},
+		// disabled
+		{"bob", "secret"},
+	} {
+		w := login(mux, test.name, test.password)
+		if w.Code != http.StatusUnauthorized || !strings.Contains(w.Body.String(), "Invalid name or password.") {
+			t.Errorf("login of %s with %q = %d, want %d", test.name, test.password, w.Code, http.StatusUnauthorized)
+		}
+		if a.CurrentUser(withCookies(w, "/admin")) != nil {
+			t.Errorf("login of %s with %q opened a session", test.name, test.password)
+		}
+	}
+
+	w = login(mux, "alice", "secret")
+	if w.Code != http.StatusSeeOther || w.Header().Get("Location") != "/admin" {
+		t.Fatalf("login of alice = %d to %q, want a redirection to /admin", w.Code, w.Header().Get("Location"))
+	}
+	if u := a.CurrentUser(withCookies(w, "/admin")); u == nil || u.Name != "alice" {
+		t.Fatalf("current user after the login of alice = %v", u)
+	}
+
+	// a session cookie isn't accepted once the user is disabled
+	a.DB.Model(&User{}).Where("name = ?", "alice").Update("disabled", true)
+	if u := a.CurrentUser(withCookies(w, "/admin")); u != nil {
+		t.Errorf("disabled user %s still logged in", u.Name)
+	}
+}
+
+func TestLogout(t *testing.T) {
+	a, mux := newAuth(t)
+	session := login(mux, "alice", "secret")
+
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, withCookies(session, "/auth/logout"))
+	if w.Code != http.StatusSeeOther || w.Header().Get("Location") != "/auth/login" {
+		t.Errorf("logout = %d to %q, want a redirection to the login", w.Code, w.Header().Get("Location"))
+	}
+	cookies := w.Result().Cookies()
+	if len(cookies) != 1 || cookies[0].Name != sessionName || cookies[0].MaxAge >= 0 {
+		t.Fatalf("logout set the cookies %v, want the session deleted", cookies)
+	}
+	if u := a.CurrentUser(withCookies(w, "/admin")); u != nil {
+		t.Errorf("%s still logged in after logging out", u.Name)
+	}
+}
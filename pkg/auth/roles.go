@@ -0,0 +1,61 @@
+package auth
+
+import (
+	"net/http"
+
+	"github.com/qor/roles"
+)
+
+// Roles, from the least to the most privileged. A user holding a role also
+// holds every less privileged one.
+const (
+	// RoleViewer can browse everything but secrets and personal data.
+	RoleViewer = "viewer"
+	// RoleModerator triages submissions and abuse reports.
+	RoleModerator = "moderator"
+	// RoleMaintainer edits the dataset and integrations.
+	RoleMaintainer = "maintainer"
+	// RoleAdmin manages users.
+	RoleAdmin = "admin"
+)
+
+// Roles lists every role, from the least to the most privileged.
+var Roles = []string{RoleViewer, RoleModerator, RoleMaintainer, RoleAdmin}
+
+func init() {
+	for _, role := range Roles {
+		role := role
+		roles.Register(role, func(req *http.Request, user interface{}) bool {
+			u, ok := user.(*User)
+			return ok && u.HasRole(role)
+		})
+	}
+}
+
+func level(role string) int {
+	for i, r := range Roles {
+		if r == role {
+			return i + 1
+		}
+	}
+	return 0
+}
+
+// Permission grants read access to the read role and create, update and
+// delete access to the write role, or to more privileged roles.
+func Permission(read, write string) *roles.Permission {
+	return roles.Allow(roles.Read, read).
+		Allow(roles.Create, write).
+		Allow(roles.Update, write).
+		Allow(roles.Delete, write)
+}
+
+// ReadOnly grants read access to the read role and denies any change.
+func ReadOnly(read string) *roles.Permission {
+	return roles.Allow(roles.Read, read)
+}
+
+// ActionPermission restricts an admin action to role.
+func ActionPermission(role string) *roles.Permission {
+	return roles.Allow(roles.Update, role)
+}
@@ -0,0 +1,89 @@
+package auth
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+
+	"github.com/jinzhu/gorm"
+	"github.com/qor/validations"
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Tables lists every model owned by this package.
+var Tables = []interface{}{
+	&User{},
+}
+
+// User is a local account of the admin interface.
+type User struct {
+	gorm.Model
+	Name         string `gorm:"size:64;unique_index"`
+	PasswordHash string `json:"-"`
+	Role         string `gorm:"size:16"`
+	Disabled     bool
+}
+
+// DisplayName implements qor.CurrentUser.
+func (u User) DisplayName() string {
+	return u.Name
+}
+
+// Validate is called by qor/validations before the user is saved.
+func (u *User) Validate(db *gorm.DB) {
+	if u.Name == "" {
+		db.AddError(validations.NewError(u, "Name", "name can't be blank"))
+	}
+	if level(u.Role) == 0 {
+		db.AddError(validations.NewError(u, "Role", fmt.Sprintf("unknown role %q", u.Role)))
+	}
+}
+
+// SetPassword stores the bcrypt hash of password.
+func (u *User) SetPassword(password string) error {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return err
+	}
+	u.PasswordHash = string(hash)
+	return nil
+}
+
+// CheckPassword reports whether password matches the stored hash.
+func (u User) CheckPassword(password string) bool {
+	return u.PasswordHash != "" && bcrypt.CompareHashAndPassword([]byte(u.PasswordHash), []byte(password)) == nil
+}
+
+// HasRole reports whether the user's role is role or a more privileged one.
+func (u User) HasRole(role string) bool {
+	return !u.Disabled && level(u.Role) >= level(role) && level(role) > 0
+}
+
+// Bootstrap creates an "admin" account with a random password when there
+// are no users yet, so that a fresh install can be logged into.
+func Bootstrap(db *gorm.DB) error {
+	var count int
+	if err := db.Model(&User{}).Count(&count).Error; err != nil {
+		return err
+	}
+	if count > 0 {
+		return nil
+	}
+
+	secret := make([]byte, 12)
+	if _, err := rand.Read(secret); err != nil {
+		return err
+	}
+	password := base64.RawURLEncoding.EncodeToString(secret)
+
+	u := &User{Name: "admin", Role: RoleAdmin}
+	if err := u.SetPassword(password); err != nil {
+		return err
+	}
+	if err := db.Create(u).Error; err != nil {
+		return err
+	}
+	log.Warnf("auth: created user %q with password %q, change it after logging in", u.Name, password)
+	return nil
+}
@@ -1,13 +1,18 @@
 package bindatafs
 
 import (
-	"crypto/md5"
+	"bytes"
+	"errors"
 	"fmt"
+	"io"
+	"io/fs"
 	"io/ioutil"
 	"mime"
 	"net/http"
 	"os"
+	pathpkg "path"
 	"path/filepath"
+	"sort"
 	"strings"
 	"time"
 
@@ -17,10 +22,14 @@ import (
 
 type AssetFSInterface interface {
 	assetfs.Interface
+	CompileWith(opts CompileOptions) (*Manifest, error)
 	FileServer(dir http.Dir, assetPaths ...string) http.Handler
+	Dev() (io.Closer, error)
+	Inspect(nameSpaces ...string) ([]Resolution, error)
+	FS() fs.FS
 }
 
-var AssetFS AssetFSInterface = &bindataFS{AssetFileSystem: &assetfs.AssetFileSystem{}, Path: "config/bindatafs"}
+var AssetFS AssetFSInterface = &bindataFS{AssetFileSystem: &assetfs.AssetFileSystem{}, Path: "pkg/bindatafs"}
 
 func init() {
 	assetfs.SetAssetFS(AssetFS)
@@ -32,10 +41,14 @@ type viewPath struct {
 }
 
 type bindataFS struct {
+	// Path is the directory of this package from the root of the module,
+	// where the assets are compiled by default
 	Path            string
 	viewPaths       []viewPath
 	AssetFileSystem assetfs.Interface
 	nameSpacedFS    []*nameSpacedBindataFS
+	// dev serves the assets of the registered paths when set, see Dev
+	dev *devFS
 }
 
 type nameSpacedBindataFS struct {
@@ -45,7 +58,14 @@ type nameSpacedBindataFS struct {
 	AssetFileSystem assetfs.Interface
 }
 
+// NameSpace returns the namespace called nameSpace, the same one every time
+// so that the paths registered to it are looked up in order.
 func (assetFS *bindataFS) NameSpace(nameSpace string) assetfs.Interface {
+	for _, fs := range assetFS.nameSpacedFS {
+		if fs.nameSpace == nameSpace {
+			return fs
+		}
+	}
 	nameSpacedFS := &nameSpacedBindataFS{bindataFS: assetFS, nameSpace: nameSpace, AssetFileSystem: &assetfs.AssetFileSystem{}}
 	assetFS.nameSpacedFS = append(assetFS.nameSpacedFS, nameSpacedFS)
 	return nameSpacedFS
@@ -59,12 +79,34 @@ func (assetFS *bindataFS) registerPath(path interface{}, prepend bool) error {
 		viewPth = viewPath{Dir: fmt.Sprint(path)}
 	}
 
-	assetFS.viewPaths = append(assetFS.viewPaths, viewPth)
+	var err error
+	if prepend {
+		err = assetFS.AssetFileSystem.PrependPath(viewPth.Dir)
+	} else {
+		err = assetFS.AssetFileSystem.RegisterPath(viewPth.Dir)
+	}
+	if err != nil {
+		return err
+	}
+	assetFS.viewPaths = addViewPath(assetFS.viewPaths, viewPth, prepend)
+	if assetFS.dev != nil {
+		assetFS.dev.watch(viewPth.Dir)
+	}
+	return nil
+}
 
+// addViewPath adds pth to viewPaths, first if prepend is set, unless it
+// is there already, in the order the registered paths are looked up.
+func addViewPath(viewPaths []viewPath, pth viewPath, prepend bool) []viewPath {
+	for _, existing := range viewPaths {
+		if existing.Dir == pth.Dir {
+			return viewPaths
+		}
+	}
 	if prepend {
-		return assetFS.AssetFileSystem.PrependPath(viewPth.Dir)
+		return append([]viewPath{pth}, viewPaths...)
 	}
-	return assetFS.AssetFileSystem.RegisterPath(viewPth.Dir)
+	return append(viewPaths, pth)
 }
 
 func (assetFS *bindataFS) RegisterPath(path string) error {
@@ -76,55 +118,225 @@ func (assetFS *bindataFS) PrependPath(path string) error {
 }
 
 func (assetFS *bindataFS) Asset(name string) ([]byte, error) {
+	return assetFS.asset("", assetFS.viewPaths, name)
+}
+
+// Glob returns the names of the assets matching pattern, relative to the
+// registered paths and sorted, compiled or not.
+func (assetFS *bindataFS) Glob(pattern string) (matches []string, err error) {
+	return assetFS.glob("", assetFS.viewPaths, pattern)
+}
+
+// asset returns the content of the asset at name of nameSpace, whose paths
+// are viewPaths.
+func (assetFS *bindataFS) asset(nameSpace string, viewPaths []viewPath, name string) ([]byte, error) {
 	name = strings.TrimPrefix(name, "/")
-	if len(_bindata) > 0 {
-		return Asset(name)
+	if assetFS.dev != nil {
+		return assetFS.dev.asset(pathpkg.Join(nameSpace, name), name, viewPaths)
+	}
+	if compiled.Len() > 0 {
+		key, ok := compiledName(nameSpace, name)
+		if !ok || !compiled.Has(key) {
+			return nil, fmt.Errorf("%v not found", name)
+		}
+		return compiled.Asset(key)
 	}
-	return assetFS.AssetFileSystem.Asset(name)
+	content, _, err := readAsset(viewPaths, name)
+	return content, err
 }
 
-func (assetFS *bindataFS) Glob(pattern string) (matches []string, err error) {
-	if len(_bindata) > 0 {
-		for key, _ := range _bindata {
-			if ok, err := filepath.Match(pattern, key); ok && err == nil {
-				matches = append(matches, key)
+// readAsset returns the content of the asset at name of the first of
+// viewPaths which has it, and that path.
+func readAsset(viewPaths []viewPath, name string) ([]byte, string, error) {
+	for _, pth := range viewPaths {
+		file := filepath.Join(pth.Dir, filepath.FromSlash(name))
+		if info, err := os.Stat(file); err != nil || !info.Mode().IsRegular() || !pth.includes(name) {
+			continue
+		}
+		content, err := ioutil.ReadFile(file)
+		return content, pth.Dir, err
+	}
+	return nil, "", fmt.Errorf("%v not found", name)
+}
+
+// glob returns the names of the assets of nameSpace, whose paths are
+// viewPaths, matching pattern. Names are relative to the namespace, without
+// a leading slash, and sorted.
+func (assetFS *bindataFS) glob(nameSpace string, viewPaths []viewPath, pattern string) ([]string, error) {
+	pattern = strings.TrimPrefix(filepath.ToSlash(pattern), "/")
+	if _, err := pathpkg.Match(pattern, ""); err != nil {
+		return nil, err
+	}
+	var matches []string
+	if compiled.Len() > 0 && assetFS.dev == nil {
+		for _, key := range compiled.Names() {
+			name, ok := nameInNameSpace(nameSpace, key)
+			if !ok {
+				continue
+			}
+			if ok, _ := pathpkg.Match(pattern, name); ok {
+				matches = append(matches, name)
 			}
 		}
+		sort.Strings(matches)
 		return matches, nil
 	}
 
-	return assetFS.AssetFileSystem.Glob(pattern)
+	seen := map[string]bool{}
+	for _, pth := range viewPaths {
+		results, err := filepath.Glob(filepath.Join(pth.Dir, filepath.FromSlash(pattern)))
+		if err != nil {
+			return nil, err
+		}
+		for _, result := range results {
+			rel, err := filepath.Rel(pth.Dir, result)
+			if err != nil {
+				continue
+			}
+			name := filepath.ToSlash(rel)
+			if info, err := os.Stat(result); err != nil || !info.Mode().IsRegular() || !pth.includes(name) || seen[name] {
+				continue
+			}
+			seen[name] = true
+			matches = append(matches, name)
+		}
+	}
+	sort.Strings(matches)
+	return matches, nil
+}
+
+// CompileOptions configures CompileWith.
+type CompileOptions struct {
+	// Output is the directory of the generated Go files, Path by default.
+	// They replace the assets of this package when it is built with the
+	// bindatafs tag, so they belong in its directory.
+	Output string
+	// Include and Exclude are globs matched against the names of assets,
+	// namespace included, or their base names. Assets are compiled if they
+	// match an Include glob, or if there are none, and no Exclude glob.
+	Include []string
+	Exclude []string
+	// NameSpaces restricts the compilation to these namespaces, every path
+	// is compiled when empty.
+	NameSpaces []string
+	// Fingerprint names the assets of file servers by the hash of their
+	// content too, see AssetPath.
+	Fingerprint bool
+}
+
+// Manifest lists the compiled assets.
+type Manifest struct {
+	// Output is the generated Go file of the assets, their precompressed
+	// variants are next to it.
+	Output string
+	Assets []ManifestAsset
 }
 
+// ManifestAsset is a compiled asset.
+type ManifestAsset struct {
+	// Name is the name of the asset, prefixed by its namespace.
+	Name string
+	// Source is the file it was compiled from.
+	Source  string
+	Size    int64
+	ModTime time.Time
+	// GzipSize and BrotliSize are the sizes of the precompressed variants,
+	// 0 when compressing doesn't make the asset smaller.
+	GzipSize   int64
+	BrotliSize int64
+	// Fingerprinted is the fingerprinted name of the asset, prefixed by its
+	// namespace, if it was fingerprinted.
+	Fingerprinted string `json:",omitempty"`
+	// Shadows are the files of the asset which Source takes precedence
+	// over, see Resolution.
+	Shadows []string `json:",omitempty"`
+}
+
+// Compile compiles the assets of the registered paths into Path.
 func (assetFS *bindataFS) Compile() error {
-	fmt.Println("Compiling templates...")
-	os.RemoveAll(filepath.Join(assetFS.Path, "templates"))
-	copyFiles(filepath.Join(assetFS.Path, "templates"), assetFS.viewPaths)
-	for _, fs := range assetFS.nameSpacedFS {
-		copyFiles(filepath.Join(assetFS.Path, "templates", fs.nameSpace), fs.viewPaths)
+	_, err := assetFS.CompileWith(CompileOptions{})
+	return err
+}
+
+// CompileWith compiles the assets of the registered paths as configured by
+// opts into Go files of this package, built instead of the file system with
+// the bindatafs tag.
+func (assetFS *bindataFS) CompileWith(opts CompileOptions) (*Manifest, error) {
+	if opts.Output == "" {
+		opts.Output = assetFS.Path
+	}
+	for _, glob := range append(opts.Include, opts.Exclude...) {
+		if _, err := filepath.Match(glob, ""); err != nil {
+			return nil, fmt.Errorf("bindatafs: %s: %s", glob, err)
+		}
 	}
 
+	staging, err := ioutil.TempDir("", "bindatafs")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(staging)
+
+	resolutions, err := assetFS.Inspect(opts.NameSpaces...)
+	if err != nil {
+		return nil, err
+	}
+	assets := map[string]ManifestAsset{}
+	if err := copyFiles(staging, resolutions, opts, assets); err != nil {
+		return nil, err
+	}
+	if len(assets) == 0 {
+		return nil, errors.New("bindatafs: no assets to compile")
+	}
+
+	if err := os.MkdirAll(opts.Output, os.ModePerm); err != nil {
+		return nil, err
+	}
 	config := bindata.NewConfig()
 	config.Input = []bindata.InputConfig{
 		{
-			Path:      filepath.Join(assetFS.Path, "templates"),
+			Path:      staging,
 			Recursive: true,
 		},
 	}
 	config.Package = "bindatafs"
 	config.Tags = "bindatafs"
-	config.Output = filepath.Join(assetFS.Path, "templates_bindatafs.go")
-	config.Prefix = filepath.Join(assetFS.Path, "templates")
-	config.NoMetadata = true
+	config.Output = filepath.Join(opts.Output, "templates_bindatafs.go")
+	config.Prefix = staging
+	if err := bindata.Translate(config); err != nil {
+		return nil, fmt.Errorf("bindatafs: %s", err)
+	}
+	// the namespaces tell the assets outside of a namespace apart
+	var nameSpaces []string
+	for _, r := range resolutions {
+		if r.NameSpace != "" && !contains(nameSpaces, r.NameSpace) {
+			nameSpaces = append(nameSpaces, r.NameSpace)
+		}
+	}
+	// precompressed variants, served by FileServer to clients accepting them
+	if err := writeEncoded(filepath.Join(opts.Output, "templates_bindatafs_encoded.go"), staging, opts, nameSpaces, assets); err != nil {
+		return nil, fmt.Errorf("bindatafs: %s", err)
+	}
 
-	defer os.Exit(0)
-	return bindata.Translate(config)
+	manifest := &Manifest{Output: config.Output}
+	for _, asset := range assets {
+		manifest.Assets = append(manifest.Assets, asset)
+	}
+	sort.Slice(manifest.Assets, func(i, j int) bool { return manifest.Assets[i].Name < manifest.Assets[j].Name })
+	return manifest, nil
 }
 
-var cacheSince = time.Now().Format(http.TimeFormat)
+// fileServerNameSpace is the namespace of the paths of file servers.
+const fileServerNameSpace = "file_server"
 
+// FileServer serves the assets of dir with http.ServeContent, which handles
+// conditional, range and HEAD requests. Compiled assets are served with the
+// ETags and modification times recorded when they were compiled, and their
+// precompressed variants to clients accepting them. Assets requested by
+// the fingerprinted names they were compiled with are cached for good,
+// unless in dev mode.
 func (assetFS *bindataFS) FileServer(dir http.Dir, assetPaths ...string) http.Handler {
-	fileServer := assetFS.NameSpace("file_server")
+	fileServer := assetFS.NameSpace(fileServerNameSpace)
 	if fs, ok := fileServer.(*nameSpacedBindataFS); ok {
 		fs.registerPath(viewPath{Dir: string(dir), AssetPaths: assetPaths}, false)
 	} else {
@@ -132,67 +344,142 @@ func (assetFS *bindataFS) FileServer(dir http.Dir, assetPaths ...string) http.Ha
 	}
 
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		if r.Header.Get("If-Modified-Since") == cacheSince {
-			w.WriteHeader(http.StatusNotModified)
-			return
+		// fingerprinted names of compiled assets never change content
+		requestPath, immutable := r.URL.Path, false
+		if name, ok := _unfingerprinted[strings.TrimPrefix(requestPath, "/")]; ok && !devMode() {
+			requestPath, immutable = "/"+name, true
 		}
-		w.Header().Set("Last-Modified", cacheSince)
-
-		requestPath := r.URL.Path
-		if content, err := fileServer.Asset(requestPath); err == nil {
-			etag := fmt.Sprintf("%x", md5.Sum(content))
-			if r.Header.Get("If-None-Match") == etag {
-				w.WriteHeader(http.StatusNotModified)
+		asset, ok := encoded(fileServer, requestPath)
+		var content []byte
+		if !ok {
+			var err error
+			if content, err = fileServer.Asset(requestPath); err != nil {
+				http.NotFound(w, r)
 				return
 			}
-
-			if ctype := mime.TypeByExtension(filepath.Ext(requestPath)); ctype != "" {
-				w.Header().Set("Content-Type", ctype)
+			asset.ETag = etag(content)
+			asset.ModTime = modTime(fileServer, requestPath).Unix()
+		}
+		encoding := negotiateEncoding(r.Header.Get("Accept-Encoding"), asset)
+		body, tag := asset.variant(encoding)
+		if encoding == "" && content == nil {
+			var err error
+			if content, err = fileServer.Asset(requestPath); err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
 			}
+		}
 
-			w.Header().Set("Cache-control", "private, must-revalidate, max-age=300")
-			w.Header().Set("ETag", etag)
-			w.Write(content)
-			return
+		// ServeContent would sniff the type of compressed content
+		ctype := mime.TypeByExtension(filepath.Ext(requestPath))
+		if ctype == "" && content != nil {
+			ctype = http.DetectContentType(content)
+		}
+		if ctype == "" {
+			ctype = "application/octet-stream"
+		}
+		w.Header().Set("Content-Type", ctype)
+		w.Header().Set("Vary", "Accept-Encoding")
+		w.Header().Set("ETag", tag)
+		if immutable {
+			w.Header().Set("Cache-Control", "public, max-age=31536000, immutable")
+		} else {
+			w.Header().Set("Cache-Control", "private, must-revalidate, max-age=300")
 		}
 
-		http.NotFound(w, r)
+		var modified time.Time
+		if asset.ModTime > 0 {
+			modified = time.Unix(asset.ModTime, 0)
+		}
+		if encoding != "" {
+			w.Header().Set("Content-Encoding", encoding)
+			http.ServeContent(w, r, requestPath, modified, strings.NewReader(body))
+			return
+		}
+		http.ServeContent(w, r, requestPath, modified, bytes.NewReader(content))
 	})
 }
 
-func copyFiles(templatesPath string, viewPaths []viewPath) {
-	for i := len(viewPaths) - 1; i >= 0; i-- {
-		pth := viewPaths[i]
-		filepath.Walk(pth.Dir, func(path string, info os.FileInfo, err error) error {
-			if err == nil {
-				var relativePath = strings.TrimPrefix(strings.TrimPrefix(path, pth.Dir), "/")
-
-				if len(pth.AssetPaths) > 0 {
-					included := false
-					for _, assetPath := range pth.AssetPaths {
-						if strings.HasPrefix(relativePath, strings.Trim(assetPath, "/")+"/") || relativePath == strings.Trim(assetPath, "/") {
-							included = true
-							break
-						}
-					}
-					if !included {
-						return nil
-					}
-				}
-
-				if info.IsDir() {
-					err = os.MkdirAll(filepath.Join(templatesPath, relativePath), os.ModePerm)
-				} else if info.Mode().IsRegular() {
-					if source, err := ioutil.ReadFile(path); err == nil {
-						if err = ioutil.WriteFile(filepath.Join(templatesPath, relativePath), source, os.ModePerm); err != nil {
-							fmt.Println(err)
-						}
-					}
-				}
-			}
+// encoded returns the compiled asset of fs at name, if fs was compiled and
+// isn't in dev mode.
+func encoded(fs assetfs.Interface, name string) (encodedAsset, bool) {
+	nameSpace := ""
+	if fs, ok := fs.(*nameSpacedBindataFS); ok {
+		if fs.dev != nil {
+			return encodedAsset{}, false
+		}
+		nameSpace = fs.nameSpace
+	}
+	asset, ok := _encoded[pathpkg.Join(nameSpace, strings.TrimPrefix(name, "/"))]
+	return asset, ok
+}
+
+// modTime returns the modification time of the file of the asset of fs at
+// name, the zero time if it isn't found.
+func modTime(fs assetfs.Interface, name string) time.Time {
+	nameSpacedFS, ok := fs.(*nameSpacedBindataFS)
+	if !ok {
+		return time.Time{}
+	}
+	for _, pth := range nameSpacedFS.viewPaths {
+		if info, err := os.Stat(filepath.Join(pth.Dir, filepath.FromSlash(strings.TrimPrefix(name, "/")))); err == nil {
+			return info.ModTime()
+		}
+	}
+	return time.Time{}
+}
+
+// copyFiles copies the files the assets of resolutions selected by opts are
+// resolved from to staging, and adds them to assets.
+func copyFiles(staging string, resolutions []Resolution, opts CompileOptions, assets map[string]ManifestAsset) error {
+	for _, r := range resolutions {
+		if (len(opts.Include) > 0 && !MatchAny(opts.Include, r.Name)) || MatchAny(opts.Exclude, r.Name) {
+			continue
+		}
+		target := filepath.Join(staging, filepath.FromSlash(r.Name))
+		if err := os.MkdirAll(filepath.Dir(target), os.ModePerm); err != nil {
+			return err
+		}
+		source, err := ioutil.ReadFile(r.Source)
+		if err != nil {
 			return err
-		})
+		}
+		if err := ioutil.WriteFile(target, source, 0644); err != nil {
+			return err
+		}
+		// the metadata of the staged files is compiled
+		if err := os.Chmod(target, r.info.Mode().Perm()); err != nil {
+			return err
+		}
+		if err := os.Chtimes(target, r.info.ModTime(), r.info.ModTime()); err != nil {
+			return err
+		}
+		assets[r.Name] = ManifestAsset{Name: r.Name, Source: r.Source, Size: r.info.Size(), ModTime: r.info.ModTime(), Shadows: r.Shadows}
+	}
+	return nil
+}
+
+// MatchAny reports whether name, or its base name, matches one of globs,
+// the way CompileOptions.Include and Exclude are matched.
+func MatchAny(globs []string, name string) bool {
+	for _, glob := range globs {
+		if ok, _ := pathpkg.Match(glob, name); ok {
+			return true
+		}
+		if ok, _ := pathpkg.Match(glob, pathpkg.Base(name)); ok {
+			return true
+		}
+	}
+	return false
+}
+
+func contains(names []string, name string) bool {
+	for _, n := range names {
+		if n == name {
+			return true
+		}
 	}
+	return false
 }
 
 func (assetFS *nameSpacedBindataFS) registerPath(path interface{}, prepend bool) error {
@@ -203,12 +490,20 @@ func (assetFS *nameSpacedBindataFS) registerPath(path interface{}, prepend bool)
 		viewPth = viewPath{Dir: fmt.Sprint(path)}
 	}
 
-	assetFS.viewPaths = append(assetFS.viewPaths, viewPth)
-
+	var err error
 	if prepend {
-		return assetFS.AssetFileSystem.PrependPath(viewPth.Dir)
+		err = assetFS.AssetFileSystem.PrependPath(viewPth.Dir)
+	} else {
+		err = assetFS.AssetFileSystem.RegisterPath(viewPth.Dir)
+	}
+	if err != nil {
+		return err
+	}
+	assetFS.viewPaths = addViewPath(assetFS.viewPaths, viewPth, prepend)
+	if assetFS.dev != nil {
+		assetFS.dev.watch(viewPth.Dir)
 	}
-	return assetFS.AssetFileSystem.RegisterPath(viewPth.Dir)
+	return nil
 }
 
 func (assetFS *nameSpacedBindataFS) RegisterPath(path string) error {
@@ -220,23 +515,24 @@ func (assetFS *nameSpacedBindataFS) PrependPath(path string) error {
 }
 
 func (assetFS *nameSpacedBindataFS) Asset(name string) ([]byte, error) {
-	name = strings.TrimPrefix(name, "/")
-	if len(_bindata) > 0 {
-		return Asset(filepath.Join(assetFS.nameSpace, name))
-	}
-	return assetFS.AssetFileSystem.Asset(name)
+	return assetFS.asset(assetFS.nameSpace, assetFS.viewPaths, name)
 }
 
+// Glob returns the names of the assets of the namespace matching pattern,
+// see bindataFS.Glob.
 func (assetFS *nameSpacedBindataFS) Glob(pattern string) (matches []string, err error) {
-	if len(_bindata) > 0 {
-		nameSpacedPattern := filepath.Join(assetFS.nameSpace, pattern)
-		for key := range _bindata {
-			if ok, err := filepath.Match(nameSpacedPattern, key); ok && err == nil {
-				matches = append(matches, strings.TrimPrefix(key, assetFS.nameSpace))
-			}
-		}
-		return matches, nil
-	}
+	return assetFS.glob(assetFS.nameSpace, assetFS.viewPaths, pattern)
+}
+
+// Compile compiles the assets of the namespace into Path.
+func (assetFS *nameSpacedBindataFS) Compile() error {
+	_, err := assetFS.CompileWith(CompileOptions{})
+	return err
+}
 
-	return assetFS.AssetFileSystem.Glob(pattern)
+// CompileWith compiles the assets of the namespace alone, see
+// bindataFS.CompileWith.
+func (assetFS *nameSpacedBindataFS) CompileWith(opts CompileOptions) (*Manifest, error) {
+	opts.NameSpaces = []string{assetFS.nameSpace}
+	return assetFS.bindataFS.CompileWith(opts)
 }
@@ -0,0 +1,438 @@
+package bindatafs
+
+import (
+	"fmt"
+	"go/parser"
+	"go/token"
+	"io/fs"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/qor/assetfs"
+)
+
+// files are the files of the registered paths of newFS, by path.
+var files = map[string]string{
+	"theme/admin/layout.tmpl":        "theme layout",
+	"theme/admin/shared/header.tmpl": "theme header",
+	"views/admin/layout.tmpl":        "layout",
+	"views/admin/index.tmpl":         "index",
+	"views/admin/shared/header.tmpl": "header",
+	"views/admin/shared/footer.tmpl": "footer",
+	"views/admin/shared/style.css":   "style",
+	"views/public/home.tmpl":         "home",
+	"views/public/assets/app.js":     "app",
+	"views/root/root.tmpl":           "root",
+	"views/root/shared/root.tmpl":    "shared root",
+	"views/public/scripts/vendor.js": "vendor",
+}
+
+// newFS returns a bindataFS of the files, in dir, with the theme path of the
+// admin namespace shadowing its views path.
+func newFS(t *testing.T, dir string) *bindataFS {
+	for name, content := range files {
+		file := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(file), os.ModePerm); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(file, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	assetFS := &bindataFS{AssetFileSystem: &assetfs.AssetFileSystem{}}
+	for _, p := range []struct {
+		nameSpace, path string
+		prepend         bool
+	}{
+		{"", "views/root", false},
+		{"admin", "views/admin", false},
+		{"admin", "theme/admin", true},
+		{"public", "views/public", false},
+	} {
+		var nameSpacedFS assetfs.Interface = assetFS
+		if p.nameSpace != "" {
+			nameSpacedFS = assetFS.NameSpace(p.nameSpace)
+		}
+		register := nameSpacedFS.RegisterPath
+		if p.prepend {
+			register = nameSpacedFS.PrependPath
+		}
+		if err := register(filepath.Join(dir, p.path)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return assetFS
+}
+
+// mapStore is an assetStore of files, as compiled by CompileWith.
+type mapStore struct {
+	files      fstest.MapFS
+	nameSpaces []string
+}
+
+func (s mapStore) Len() int { return len(s.files) }
+
+func (s mapStore) Names() []string {
+	var names []string
+	for name := range s.files {
+		names = append(names, name)
+	}
+	return names
+}
+
+func (s mapStore) Has(name string) bool {
+	_, ok := s.files[name]
+	return ok
+}
+
+func (s mapStore) Asset(name string) ([]byte, error)          { return s.files.ReadFile(name) }
+func (s mapStore) AssetInfo(name string) (os.FileInfo, error) { return s.files.Stat(name) }
+func (s mapStore) NameSpaces() []string                       { return s.nameSpaces }
+
+// compile returns the assets of assetFS the way CompileWith compiles them.
+func compile(t *testing.T, assetFS *bindataFS) mapStore {
+	resolutions, err := assetFS.Inspect()
+	if err != nil {
+		t.Fatal(err)
+	}
+	store := mapStore{files: fstest.MapFS{}}
+	for _, r := range resolutions {
+		content, err := ioutil.ReadFile(r.Source)
+		if err != nil {
+			t.Fatal(err)
+		}
+		store.files[r.Name] = &fstest.MapFile{Data: content, Mode: r.info.Mode(), ModTime: r.info.ModTime()}
+		if r.NameSpace != "" && !contains(store.nameSpaces, r.NameSpace) {
+			store.nameSpaces = append(store.nameSpaces, r.NameSpace)
+		}
+	}
+	return store
+}
+
+// forEachMode runs test against the files of the registered paths and
+// against the assets compiled from them.
+func forEachMode(t *testing.T, test func(t *testing.T, assetFS *bindataFS)) {
+	dir, err := ioutil.TempDir("", "bindatafs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	assetFS := newFS(t, dir)
+
+	t.Run("filesystem", func(t *testing.T) {
+		test(t, assetFS)
+	})
+	t.Run("compiled", func(t *testing.T) {
+		defer func(store assetStore) { compiled = store }(compiled)
+		compiled = compile(t, assetFS)
+		test(t, assetFS)
+	})
+}
+
+func TestAsset(t *testing.T) {
+	forEachMode(t, func(t *testing.T, assetFS *bindataFS) {
+		for _, c := range []struct {
+			fs      assetfs.Interface
+			name    string
+			content string
+		}{
+			{assetFS, "root.tmpl", "root"},
+			{assetFS, "/root.tmpl", "root"},
+			{assetFS, "shared/root.tmpl", "shared root"},
+			{assetFS, "admin/index.tmpl", ""},
+			{assetFS.NameSpace("admin"), "index.tmpl", "index"},
+			{assetFS.NameSpace("admin"), "/index.tmpl", "index"},
+			{assetFS.NameSpace("admin"), "layout.tmpl", "theme layout"},
+			{assetFS.NameSpace("admin"), "shared/header.tmpl", "theme header"},
+			{assetFS.NameSpace("admin"), "/shared/footer.tmpl", "footer"},
+			{assetFS.NameSpace("admin"), "missing.tmpl", ""},
+			{assetFS.NameSpace("admin"), "home.tmpl", ""},
+			{assetFS.NameSpace("public"), "assets/app.js", "app"},
+		} {
+			content, err := c.fs.Asset(c.name)
+			if c.content == "" {
+				if err == nil {
+					t.Errorf("Asset(%q): expected an error, got %q", c.name, content)
+				}
+				continue
+			}
+			if err != nil {
+				t.Errorf("Asset(%q): %s", c.name, err)
+			} else if string(content) != c.content {
+				t.Errorf("Asset(%q) = %q, expected %q", c.name, content, c.content)
+			}
+		}
+	})
+}
+
+func TestGlob(t *testing.T) {
+	forEachMode(t, func(t *testing.T, assetFS *bindataFS) {
+		for _, c := range []struct {
+			fs      assetfs.Interface
+			pattern string
+			matches []string
+		}{
+			{assetFS, "*.tmpl", []string{"root.tmpl"}},
+			{assetFS, "*/*", []string{"shared/root.tmpl"}},
+			{assetFS, "/shared/*.tmpl", []string{"shared/root.tmpl"}},
+			{assetFS.NameSpace("admin"), "*.tmpl", []string{"index.tmpl", "layout.tmpl"}},
+			{assetFS.NameSpace("admin"), "shared/*.tmpl", []string{"shared/footer.tmpl", "shared/header.tmpl"}},
+			{assetFS.NameSpace("admin"), "/shared/*", []string{"shared/footer.tmpl", "shared/header.tmpl", "shared/style.css"}},
+			{assetFS.NameSpace("admin"), "*", []string{"index.tmpl", "layout.tmpl"}},
+			{assetFS.NameSpace("admin"), "*.js", nil},
+			{assetFS.NameSpace("public"), "*/*.js", []string{"assets/app.js", "scripts/vendor.js"}},
+		} {
+			matches, err := c.fs.Glob(c.pattern)
+			if err != nil {
+				t.Errorf("Glob(%q): %s", c.pattern, err)
+			} else if !reflect.DeepEqual(matches, c.matches) {
+				t.Errorf("Glob(%q) = %q, expected %q", c.pattern, matches, c.matches)
+			}
+		}
+
+		for _, nameSpacedFS := range []assetfs.Interface{assetFS, assetFS.NameSpace("admin")} {
+			if _, err := nameSpacedFS.Glob("["); err == nil {
+				t.Errorf("Glob(%q): expected an error", "[")
+			}
+		}
+	})
+}
+
+func TestFS(t *testing.T) {
+	forEachMode(t, func(t *testing.T, assetFS *bindataFS) {
+		if err := fstest.TestFS(assetFS.FS(), "root.tmpl", "shared/root.tmpl"); err != nil {
+			t.Error(err)
+		}
+		admin := assetFS.NameSpace("admin").(*nameSpacedBindataFS)
+		if err := fstest.TestFS(admin.FS(), "index.tmpl", "layout.tmpl", "shared/header.tmpl", "shared/style.css"); err != nil {
+			t.Error(err)
+		}
+
+		// the io/fs view and Glob agree
+		matches, err := admin.Glob("shared/*")
+		if err != nil {
+			t.Fatal(err)
+		}
+		fsMatches, err := fs.Glob(admin.FS(), "shared/*")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(matches, fsMatches) {
+			t.Errorf("Glob = %q, io/fs Glob = %q", matches, fsMatches)
+		}
+	})
+}
+
+func TestCompileWith(t *testing.T) {
+	dir, err := ioutil.TempDir("", "bindatafs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	assetFS := newFS(t, dir)
+	assetFS.FileServer(http.Dir(filepath.Join(dir, "views/public")))
+	output := filepath.Join(dir, "output")
+
+	manifest, err := assetFS.CompileWith(CompileOptions{
+		Output:      output,
+		Include:     []string{"admin/*", "admin/shared/*", "file_server/*/*.js"},
+		Exclude:     []string{"*.css", "index.tmpl"},
+		Fingerprint: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if manifest.Output != filepath.Join(output, "templates_bindatafs.go") {
+		t.Errorf("Output = %q", manifest.Output)
+	}
+	var names []string
+	assets := map[string]ManifestAsset{}
+	for _, asset := range manifest.Assets {
+		names = append(names, asset.Name)
+		assets[asset.Name] = asset
+	}
+	expected := []string{
+		"admin/layout.tmpl",
+		"admin/shared/footer.tmpl",
+		"admin/shared/header.tmpl",
+		"file_server/assets/app.js",
+		"file_server/scripts/vendor.js",
+	}
+	if !reflect.DeepEqual(names, expected) {
+		t.Fatalf("assets = %q, expected %q", names, expected)
+	}
+	layout := assets["admin/layout.tmpl"]
+	if layout.Source != filepath.Join(dir, "theme/admin/layout.tmpl") || layout.Size != int64(len("theme layout")) ||
+		!reflect.DeepEqual(layout.Shadows, []string{filepath.Join(dir, "views/admin/layout.tmpl")}) {
+		t.Errorf("admin/layout.tmpl = %+v, expected the theme layout shadowing the views one", layout)
+	}
+	if layout.Fingerprinted != "" {
+		t.Errorf("admin/layout.tmpl was fingerprinted as %q, only the assets of file servers are", layout.Fingerprinted)
+	}
+	app := assets["file_server/assets/app.js"]
+	if fingerprinted := fingerprint(app.Name, []byte("app")); app.Fingerprinted != fingerprinted {
+		t.Errorf("file_server/assets/app.js was fingerprinted as %q, expected %q", app.Fingerprinted, fingerprinted)
+	}
+
+	// the generated files build in this package with the bindatafs tag
+	for _, name := range []string{"templates_bindatafs.go", "templates_bindatafs_encoded.go"} {
+		file, err := parser.ParseFile(token.NewFileSet(), filepath.Join(output, name), nil, parser.ParseComments)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if file.Name.Name != "bindatafs" {
+			t.Errorf("%s is in package %s", name, file.Name.Name)
+		}
+		tagged := false
+		for _, comment := range file.Comments {
+			tagged = tagged || strings.Contains(comment.Text(), "+build bindatafs")
+		}
+		if !tagged {
+			t.Errorf("%s isn't built with the bindatafs tag", name)
+		}
+	}
+
+	if _, err := assetFS.CompileWith(CompileOptions{Output: output, Include: []string{"missing"}}); err == nil {
+		t.Error("compiling no assets: expected an error")
+	}
+	if _, err := assetFS.CompileWith(CompileOptions{Output: output, Exclude: []string{"["}}); err == nil {
+		t.Error("compiling with a malformed glob: expected an error")
+	}
+}
+
+func TestFileServerImmutable(t *testing.T) {
+	dir, err := ioutil.TempDir("", "bindatafs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	assetFS := newFS(t, dir)
+	// named like a fingerprinted asset, but not compiled as one
+	if err := ioutil.WriteFile(filepath.Join(dir, "views/public/assets/lib.0123abcd.js"), []byte("lib"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	handler := assetFS.FileServer(http.Dir(filepath.Join(dir, "views/public")))
+	defer func(unfingerprinted map[string]string) { _unfingerprinted = unfingerprinted }(_unfingerprinted)
+	_unfingerprinted = map[string]string{"assets/app.89abcdef.js": "assets/app.js"}
+
+	for _, c := range []struct {
+		path, body string
+		immutable  bool
+	}{
+		{"/assets/app.89abcdef.js", "app", true},
+		{"/assets/app.js", "app", false},
+		{"/assets/lib.0123abcd.js", "lib", false},
+	} {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest("GET", c.path, nil))
+		if w.Code != http.StatusOK || w.Body.String() != c.body {
+			t.Errorf("GET %s = %d %q, expected %q", c.path, w.Code, w.Body, c.body)
+		}
+		if immutable := strings.Contains(w.Header().Get("Cache-Control"), "immutable"); immutable != c.immutable {
+			t.Errorf("GET %s: Cache-Control %q", c.path, w.Header().Get("Cache-Control"))
+		}
+	}
+}
+
+func TestFileServerConditional(t *testing.T) {
+	handler, big := encodedFileServer(t)
+	tags := map[string]string{"": big.ETag}
+	for _, encoding := range []string{EncodingGzip, EncodingBrotli} {
+		_, tags[encoding] = big.variant(encoding)
+	}
+	serve := func(method, path, acceptEncoding string, header http.Header) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(method, path, nil)
+		for name, values := range header {
+			r.Header[name] = values
+		}
+		if acceptEncoding != "" {
+			r.Header.Set("Accept-Encoding", acceptEncoding)
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		return w
+	}
+
+	// every variant is revalidated by its own ETag only
+	for encoding, tag := range tags {
+		for other, otherTag := range tags {
+			w := serve("GET", "/assets/big.js", encoding, http.Header{"If-None-Match": {otherTag}})
+			if other == encoding {
+				if w.Code != http.StatusNotModified || w.Body.Len() != 0 || w.Header().Get("ETag") != tag {
+					t.Errorf("GET of the %q variant if none matches %s = %d, ETag %s, expected %d", encoding, otherTag, w.Code, w.Header().Get("ETag"), http.StatusNotModified)
+				}
+			} else if w.Code != http.StatusOK {
+				t.Errorf("GET of the %q variant if none matches %s = %d, expected %d", encoding, otherTag, w.Code, http.StatusOK)
+			}
+		}
+	}
+
+	// compiled assets were last modified when compiled, not when their
+	// files were
+	for _, c := range []struct {
+		path  string
+		since time.Time
+		code  int
+	}{
+		{"/assets/big.js", compiledAt, http.StatusNotModified},
+		{"/assets/big.js", compiledAt.Add(time.Hour), http.StatusNotModified},
+		{"/assets/big.js", compiledAt.Add(-time.Second), http.StatusOK},
+		{"/home.tmpl", compiledAt, http.StatusOK},
+		{"/home.tmpl", time.Now().Add(time.Hour), http.StatusNotModified},
+	} {
+		w := serve("GET", c.path, "", http.Header{"If-Modified-Since": {c.since.UTC().Format(http.TimeFormat)}})
+		if w.Code != c.code {
+			t.Errorf("GET %s if modified since %s = %d, expected %d", c.path, c.since, w.Code, c.code)
+		}
+	}
+	if w := serve("GET", "/assets/big.js", "br", nil); w.Header().Get("Last-Modified") != compiledAt.Format(http.TimeFormat) {
+		t.Errorf("Last-Modified = %q, expected %q", w.Header().Get("Last-Modified"), compiledAt.Format(http.TimeFormat))
+	}
+
+	// ranges are of the variant served
+	for _, c := range []struct {
+		acceptEncoding, body string
+	}{
+		{"", bigJS},
+		{"gzip", big.Gzip},
+		{"br", big.Brotli},
+	} {
+		w := serve("GET", "/assets/big.js", c.acceptEncoding, http.Header{"Range": {"bytes=2-9"}})
+		if w.Code != http.StatusPartialContent || w.Body.String() != c.body[2:10] ||
+			w.Header().Get("Content-Range") != fmt.Sprintf("bytes 2-9/%d", len(c.body)) {
+			t.Errorf("GET of bytes 2-9 of the %q variant = %d %q, Content-Range %q", c.acceptEncoding, w.Code, w.Body, w.Header().Get("Content-Range"))
+		}
+		w = serve("GET", "/assets/big.js", c.acceptEncoding, http.Header{"Range": {fmt.Sprintf("bytes=%d-", len(c.body))}})
+		if w.Code != http.StatusRequestedRangeNotSatisfiable {
+			t.Errorf("GET past the end of the %q variant = %d, expected %d", c.acceptEncoding, w.Code, http.StatusRequestedRangeNotSatisfiable)
+		}
+		// a range of another variant is served in full
+		w = serve("GET", "/assets/big.js", c.acceptEncoding, http.Header{"Range": {"bytes=2-9"}, "If-Range": {`"other"`}})
+		if w.Code != http.StatusOK || w.Body.String() != c.body {
+			t.Errorf("GET of bytes 2-9 of another version of the %q variant = %d", c.acceptEncoding, w.Code)
+		}
+
+		// ServeContent leaves out the length of encoded content
+		length := ""
+		if c.acceptEncoding == "" {
+			length = strconv.Itoa(len(c.body))
+		}
+		w = serve("HEAD", "/assets/big.js", c.acceptEncoding, nil)
+		if w.Code != http.StatusOK || w.Body.Len() != 0 || w.Header().Get("Content-Length") != length ||
+			w.Header().Get("ETag") != tags[c.acceptEncoding] || w.Header().Get("Content-Encoding") != c.acceptEncoding {
+			t.Errorf("HEAD of the %q variant = %d, %d bytes, headers %v", c.acceptEncoding, w.Code, w.Body.Len(), w.Header())
+		}
+	}
+	if w := serve("HEAD", "/missing.js", "", nil); w.Code != http.StatusNotFound {
+		t.Errorf("HEAD /missing.js = %d, expected %d", w.Code, http.StatusNotFound)
+	}
+}
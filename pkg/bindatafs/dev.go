@@ -0,0 +1,131 @@
+package bindatafs
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/fsnotify/fsnotify"
+	log "github.com/sirupsen/logrus"
+)
+
+// devFS caches the assets of the registered paths until they change on
+// disk, see bindataFS.Dev.
+type devFS struct {
+	mu sync.RWMutex
+	// cache is the content of the assets by name, prefixed by their
+	// namespace, nil once closed
+	cache   map[string][]byte
+	watcher *fsnotify.Watcher
+}
+
+// Dev serves the assets of the registered paths rather than the compiled
+// ones. Assets are cached until a file of the registered paths changes, and
+// the path each asset is resolved from is logged. Closing the returned
+// closer stops watching the registered paths, assets are then read from
+// them on every request.
+func (assetFS *bindataFS) Dev() (io.Closer, error) {
+	if assetFS.dev != nil {
+		return assetFS.dev, nil
+	}
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, err
+	}
+	dev := &devFS{cache: map[string][]byte{}, watcher: watcher}
+	for _, pth := range assetFS.viewPaths {
+		dev.watch(pth.Dir)
+	}
+	for _, fs := range assetFS.nameSpacedFS {
+		for _, pth := range fs.viewPaths {
+			dev.watch(pth.Dir)
+		}
+	}
+	go dev.loop()
+	assetFS.dev = dev
+	log.Info("bindatafs: serving assets from their registered paths")
+	return dev, nil
+}
+
+// Close stops watching the registered paths and caching assets.
+func (d *devFS) Close() error {
+	d.mu.Lock()
+	d.cache = nil
+	d.mu.Unlock()
+	return d.watcher.Close()
+}
+
+// devMode reports whether AssetFS serves the assets of the registered paths.
+func devMode() bool {
+	fs, ok := AssetFS.(*bindataFS)
+	return ok && fs.dev != nil
+}
+
+// watch watches dir and its subdirectories, unless d is closed.
+func (d *devFS) watch(dir string) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	if d.cache == nil {
+		return
+	}
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil || !info.IsDir() {
+			return err
+		}
+		return d.watcher.Add(path)
+	})
+	if err != nil {
+		log.Errorf("bindatafs: watching %s: %s", dir, err)
+	}
+}
+
+func (d *devFS) loop() {
+	for {
+		select {
+		case event, ok := <-d.watcher.Events:
+			if !ok {
+				return
+			}
+			if event.Op&fsnotify.Create != 0 {
+				if info, err := os.Stat(event.Name); err == nil && info.IsDir() {
+					d.watch(event.Name)
+				}
+			}
+			// an asset may shadow another one, start over
+			d.mu.Lock()
+			if len(d.cache) > 0 {
+				log.Infof("bindatafs: %s changed, reloading assets", event.Name)
+				d.cache = map[string][]byte{}
+			}
+			d.mu.Unlock()
+		case err, ok := <-d.watcher.Errors:
+			if !ok {
+				return
+			}
+			log.Errorf("bindatafs: watching: %s", err)
+		}
+	}
+}
+
+// asset returns the content of the asset at name of the first of viewPaths
+// which has it, key being its cache key.
+func (d *devFS) asset(key, name string, viewPaths []viewPath) ([]byte, error) {
+	d.mu.RLock()
+	content, ok := d.cache[key]
+	d.mu.RUnlock()
+	if ok {
+		return content, nil
+	}
+	content, dir, err := readAsset(viewPaths, name)
+	if err != nil {
+		return nil, err
+	}
+	log.Infof("bindatafs: %s resolved from %s", key, dir)
+	d.mu.Lock()
+	if d.cache != nil {
+		d.cache[key] = content
+	}
+	d.mu.Unlock()
+	return content, nil
+}
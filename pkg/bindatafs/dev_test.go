@@ -0,0 +1,91 @@
+package bindatafs
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/qor/assetfs"
+)
+
+// reloaded writes content to the file at name, until fs serves it as the
+// asset at asset. Directories created are watched once their creation is
+// noticed, writing to them before that is lost.
+func reloaded(t *testing.T, fs assetfs.Interface, asset, name, content string) bool {
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		if err := ioutil.WriteFile(name, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		time.Sleep(20 * time.Millisecond)
+		if b, err := fs.Asset(asset); err == nil && string(b) == content {
+			return true
+		}
+	}
+	return false
+}
+
+func TestDev(t *testing.T) {
+	dir, err := ioutil.TempDir("", "bindatafs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	assetFS := newFS(t, dir)
+	dev, err := assetFS.Dev()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dev.Close()
+	if again, err := assetFS.Dev(); err != nil || again != dev {
+		t.Errorf("Dev again = %v, %v, expected the same closer", again, err)
+	}
+	admin := assetFS.NameSpace("admin")
+
+	// cached until edited
+	if b, err := admin.Asset("shared/footer.tmpl"); err != nil || string(b) != "footer" {
+		t.Fatalf("shared/footer.tmpl = %q, %v", b, err)
+	}
+	if !reloaded(t, admin, "shared/footer.tmpl", filepath.Join(dir, "views/admin/shared/footer.tmpl"), "edited footer") {
+		t.Error("the edited shared/footer.tmpl wasn't reloaded")
+	}
+
+	// a file shadowing another one
+	if b, err := admin.Asset("index.tmpl"); err != nil || string(b) != "index" {
+		t.Fatalf("index.tmpl = %q, %v", b, err)
+	}
+	if !reloaded(t, admin, "index.tmpl", filepath.Join(dir, "theme/admin/index.tmpl"), "theme index") {
+		t.Error("the theme index.tmpl doesn't shadow the views one")
+	}
+
+	// in a directory created since
+	sub := filepath.Join(dir, "views/admin/widgets")
+	if err := os.Mkdir(sub, os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(sub, "chart.tmpl"), []byte("chart"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if b, err := admin.Asset("widgets/chart.tmpl"); err != nil || string(b) != "chart" {
+		t.Fatalf("widgets/chart.tmpl = %q, %v", b, err)
+	}
+	if !reloaded(t, admin, "widgets/chart.tmpl", filepath.Join(sub, "chart.tmpl"), "edited chart") {
+		t.Error("the edited widgets/chart.tmpl of a new directory wasn't reloaded")
+	}
+
+	// assets are read on every request once closed
+	if err := dev.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(sub, "chart.tmpl"), []byte("closed chart"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if b, err := admin.Asset("widgets/chart.tmpl"); err != nil || string(b) != "closed chart" {
+		t.Errorf("widgets/chart.tmpl once closed = %q, %v, expected the file", b, err)
+	}
+	if err := admin.RegisterPath(filepath.Join(dir, "views/public")); err != nil {
+		t.Errorf("registering a path once closed: %s", err)
+	}
+}
@@ -0,0 +1,196 @@
+package bindatafs
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/md5"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/andybalholm/brotli"
+)
+
+// Content codings of the precompressed variants of compiled assets.
+const (
+	EncodingGzip   = "gzip"
+	EncodingBrotli = "br"
+)
+
+// encodedAsset is the ETag and the modification time, in seconds since the
+// epoch, of a compiled asset along with its gzip and brotli variants, empty
+// when compressing doesn't make the asset smaller.
+type encodedAsset struct {
+	ETag    string
+	ModTime int64
+	Gzip    string
+	Brotli  string
+}
+
+// variant returns the content of the variant of a in encoding, and its ETag.
+func (a encodedAsset) variant(encoding string) (string, string) {
+	switch encoding {
+	case EncodingGzip:
+		return a.Gzip, strings.TrimSuffix(a.ETag, `"`) + `-gz"`
+	case EncodingBrotli:
+		return a.Brotli, strings.TrimSuffix(a.ETag, `"`) + `-br"`
+	}
+	return "", a.ETag
+}
+
+// etag returns the strong ETag of content.
+func etag(content []byte) string {
+	return fmt.Sprintf(`"%x"`, md5.Sum(content))
+}
+
+// writeEncoded compresses the assets of file servers staged in staging and
+// writes them along with their ETags and modification times to the Go file
+// output, next to the bindata, along with their fingerprinted names
+// if opts.Fingerprint is set, and nameSpaces. The sizes of the variants and
+// the fingerprinted names are added to assets.
+func writeEncoded(output, staging string, opts CompileOptions, nameSpaces []string, assets map[string]ManifestAsset) error {
+	var names []string
+	for name := range assets {
+		if strings.HasPrefix(name, fileServerNameSpace+"/") {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	var b bytes.Buffer
+	b.WriteString("// Code generated by bindatafs. DO NOT EDIT.\n\n// +build bindatafs\n\npackage bindatafs\n\n")
+	b.WriteString("var _encoded = map[string]encodedAsset{\n")
+	for _, name := range names {
+		content, err := ioutil.ReadFile(filepath.Join(staging, filepath.FromSlash(name)))
+		if err != nil {
+			return err
+		}
+		asset := assets[name]
+		encoded, err := encode(content, asset.ModTime)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(&b, "\t%q: {\n\t\tETag: %s,\n\t\tModTime: %d,\n", name, strconv.Quote(encoded.ETag), encoded.ModTime)
+		if encoded.Gzip != "" {
+			fmt.Fprintf(&b, "\t\tGzip: %q,\n", encoded.Gzip)
+			asset.GzipSize = int64(len(encoded.Gzip))
+		}
+		if encoded.Brotli != "" {
+			fmt.Fprintf(&b, "\t\tBrotli: %q,\n", encoded.Brotli)
+			asset.BrotliSize = int64(len(encoded.Brotli))
+		}
+		b.WriteString("\t},\n")
+		if opts.Fingerprint {
+			asset.Fingerprinted = fingerprint(name, content)
+		}
+		assets[name] = asset
+	}
+
+	// file servers serve fingerprinted names the assets they stand for
+	b.WriteString("}\n\nvar _fingerprints = map[string]string{\n")
+	for _, name := range names {
+		if fingerprinted := assets[name].Fingerprinted; fingerprinted != "" {
+			fmt.Fprintf(&b, "\t%q: %q,\n", strings.TrimPrefix(name, fileServerNameSpace+"/"), strings.TrimPrefix(fingerprinted, fileServerNameSpace+"/"))
+		}
+	}
+	b.WriteString("}\n\nvar _nameSpaces = []string{\n")
+	for _, nameSpace := range nameSpaces {
+		fmt.Fprintf(&b, "\t%q,\n", nameSpace)
+	}
+	b.WriteString("}\n")
+	return ioutil.WriteFile(output, b.Bytes(), os.FileMode(0644))
+}
+
+// encode returns the compiled asset of content modified at modTime, with
+// the variants which are smaller than content.
+func encode(content []byte, modTime time.Time) (encodedAsset, error) {
+	asset := encodedAsset{ETag: etag(content), ModTime: modTime.Unix()}
+	gz, err := compressGzip(content)
+	if err != nil {
+		return asset, err
+	}
+	if len(gz) < len(content) {
+		asset.Gzip = string(gz)
+	}
+	br, err := compressBrotli(content)
+	if err != nil {
+		return asset, err
+	}
+	if len(br) < len(content) {
+		asset.Brotli = string(br)
+	}
+	return asset, nil
+}
+
+func compressGzip(content []byte) ([]byte, error) {
+	var b bytes.Buffer
+	w, err := gzip.NewWriterLevel(&b, gzip.BestCompression)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := w.Write(content); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
+
+func compressBrotli(content []byte) ([]byte, error) {
+	var b bytes.Buffer
+	w := brotli.NewWriterLevel(&b, brotli.BestCompression)
+	if _, err := w.Write(content); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
+
+// negotiateEncoding returns the content coding of asset preferred by the
+// Accept-Encoding header, brotli over gzip when the client accepts both
+// alike, or "" for none.
+func negotiateEncoding(header string, asset encodedAsset) string {
+	accepted := map[string]float64{}
+	for _, part := range strings.Split(header, ",") {
+		fields := strings.Split(part, ";")
+		coding := strings.ToLower(strings.TrimSpace(fields[0]))
+		if coding == "" {
+			continue
+		}
+		q := 1.0
+		for _, param := range fields[1:] {
+			param = strings.TrimSpace(param)
+			if strings.HasPrefix(param, "q=") {
+				if v, err := strconv.ParseFloat(strings.TrimPrefix(param, "q="), 64); err == nil {
+					q = v
+				}
+			}
+		}
+		accepted[coding] = q
+	}
+	quality := func(coding string) float64 {
+		if q, ok := accepted[coding]; ok {
+			return q
+		}
+		return accepted["*"]
+	}
+
+	best, bestQ := "", 0.0
+	for _, coding := range []string{EncodingBrotli, EncodingGzip} {
+		if content, _ := asset.variant(coding); content == "" {
+			continue
+		}
+		if q := quality(coding); q > bestQ {
+			best, bestQ = coding, q
+		}
+	}
+	return best
+}
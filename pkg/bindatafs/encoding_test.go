@@ -0,0 +1,159 @@
+package bindatafs
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/andybalholm/brotli"
+)
+
+// bigJS is an asset compressing well, unlike the files of newFS.
+var bigJS = strings.Repeat("console.log('oniontree');\n", 100)
+
+// compiledAt is the modification time the assets of encodedFileServer were
+// compiled with, unlike the one of their files.
+var compiledAt = time.Date(2020, time.January, 2, 3, 4, 5, 0, time.UTC)
+
+// encodedFileServer returns a file server of the public views of newFS,
+// along with assets/big.js, whose assets/app.js and assets/big.js are
+// compiled, and the compiled assets/big.js.
+func encodedFileServer(t *testing.T) (http.Handler, encodedAsset) {
+	dir, err := ioutil.TempDir("", "bindatafs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	assetFS := newFS(t, dir)
+	if err := ioutil.WriteFile(filepath.Join(dir, "views/public/assets/big.js"), []byte(bigJS), 0644); err != nil {
+		t.Fatal(err)
+	}
+	handler := assetFS.FileServer(http.Dir(filepath.Join(dir, "views/public")))
+
+	encoded := _encoded
+	t.Cleanup(func() { _encoded = encoded })
+	_encoded = map[string]encodedAsset{}
+	for name, content := range map[string]string{"assets/app.js": files["views/public/assets/app.js"], "assets/big.js": bigJS} {
+		asset, err := encode([]byte(content), compiledAt)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_encoded[fileServerNameSpace+"/"+name] = asset
+	}
+	return handler, _encoded[fileServerNameSpace+"/assets/big.js"]
+}
+
+func TestEncode(t *testing.T) {
+	asset, err := encode([]byte(bigJS), compiledAt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if asset.ETag != etag([]byte(bigJS)) || asset.ModTime != compiledAt.Unix() {
+		t.Errorf("ETag %s modified at %d, expected %s at %d", asset.ETag, asset.ModTime, etag([]byte(bigJS)), compiledAt.Unix())
+	}
+	gz, err := gzip.NewReader(strings.NewReader(asset.Gzip))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if content, err := ioutil.ReadAll(gz); err != nil || string(content) != bigJS {
+		t.Errorf("gzip variant = %q, %v", content, err)
+	}
+	if content, err := ioutil.ReadAll(brotli.NewReader(strings.NewReader(asset.Brotli))); err != nil || string(content) != bigJS {
+		t.Errorf("brotli variant = %q, %v", content, err)
+	}
+
+	// compressing a few bytes makes them bigger
+	small, err := encode([]byte("app"), compiledAt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if small.Gzip != "" || small.Brotli != "" {
+		t.Errorf("variants of a small asset = %q, %q, expected none", small.Gzip, small.Brotli)
+	}
+	if content, tag := small.variant(""); content != "" || tag != small.ETag {
+		t.Errorf("identity variant = %q, %s, expected the ETag of the asset", content, tag)
+	}
+}
+
+func TestNegotiateEncoding(t *testing.T) {
+	both := encodedAsset{ETag: `"a"`, Gzip: "gz", Brotli: "br"}
+	gzipOnly := encodedAsset{ETag: `"a"`, Gzip: "gz"}
+	brotliOnly := encodedAsset{ETag: `"a"`, Brotli: "br"}
+	for _, c := range []struct {
+		header   string
+		asset    encodedAsset
+		encoding string
+	}{
+		{"", both, ""},
+		{"gzip, deflate, br", both, EncodingBrotli},
+		{"br, gzip", both, EncodingBrotli},
+		{"gzip;q=1.0, br;q=0.5", both, EncodingGzip},
+		{"GZIP", both, EncodingGzip},
+		{"gzip;q=0", both, ""},
+		{"gzip;q=0, br", both, EncodingBrotli},
+		{"identity", both, ""},
+		{"*", both, EncodingBrotli},
+		{"*;q=0", both, ""},
+		{"*, br;q=0", both, EncodingGzip},
+		{"gzip;q=0.8, *;q=0.9", both, EncodingBrotli},
+		{"deflate", both, ""},
+		// variants which didn't make the asset smaller are missing
+		{"gzip, br", gzipOnly, EncodingGzip},
+		{"br", gzipOnly, ""},
+		{"gzip, br", brotliOnly, EncodingBrotli},
+		{"gzip, br", encodedAsset{ETag: `"a"`}, ""},
+	} {
+		if encoding := negotiateEncoding(c.header, c.asset); encoding != c.encoding {
+			t.Errorf("negotiateEncoding(%q) of gzip %v and brotli %v = %q, expected %q",
+				c.header, c.asset.Gzip != "", c.asset.Brotli != "", encoding, c.encoding)
+		}
+	}
+}
+
+func TestFileServerEncoding(t *testing.T) {
+	handler, big := encodedFileServer(t)
+
+	for _, c := range []struct {
+		path, acceptEncoding string
+		encoding             string
+		etag                 string
+		body                 string
+	}{
+		{"/assets/big.js", "gzip, deflate, br", EncodingBrotli, strings.TrimSuffix(big.ETag, `"`) + `-br"`, big.Brotli},
+		{"/assets/big.js", "gzip", EncodingGzip, strings.TrimSuffix(big.ETag, `"`) + `-gz"`, big.Gzip},
+		{"/assets/big.js", "br;q=0, gzip", EncodingGzip, strings.TrimSuffix(big.ETag, `"`) + `-gz"`, big.Gzip},
+		{"/assets/big.js", "*", EncodingBrotli, strings.TrimSuffix(big.ETag, `"`) + `-br"`, big.Brotli},
+		{"/assets/big.js", "gzip;q=0", "", big.ETag, bigJS},
+		{"/assets/big.js", "", "", big.ETag, bigJS},
+		// compiled without variants, compressing it didn't pay
+		{"/assets/app.js", "gzip, br", "", etag([]byte("app")), "app"},
+		// not compiled
+		{"/home.tmpl", "gzip, br", "", etag([]byte("home")), "home"},
+	} {
+		r := httptest.NewRequest(http.MethodGet, c.path, nil)
+		if c.acceptEncoding != "" {
+			r.Header.Set("Accept-Encoding", c.acceptEncoding)
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		if w.Code != http.StatusOK || !bytes.Equal(w.Body.Bytes(), []byte(c.body)) {
+			t.Errorf("GET %s with %q = %d, expected the %q variant", c.path, c.acceptEncoding, w.Code, c.encoding)
+		}
+		h := w.Header()
+		if h.Get("Content-Encoding") != c.encoding || h.Get("ETag") != c.etag || h.Get("Vary") != "Accept-Encoding" {
+			t.Errorf("GET %s with %q: Content-Encoding %q, ETag %s, Vary %q, expected %q, %s, Accept-Encoding",
+				c.path, c.acceptEncoding, h.Get("Content-Encoding"), h.Get("ETag"), h.Get("Vary"), c.encoding, c.etag)
+		}
+		// the type of the asset, not the one sniffed from compressed content
+		if ctype := h.Get("Content-Type"); !strings.HasPrefix(ctype, "text/javascript") && !strings.HasPrefix(ctype, "application/javascript") && strings.HasSuffix(c.path, ".js") {
+			t.Errorf("GET %s with %q: Content-Type %q", c.path, c.acceptEncoding, ctype)
+		}
+	}
+}
@@ -0,0 +1,75 @@
+package bindatafs
+
+import (
+	"crypto/md5"
+	"fmt"
+	"html/template"
+	pathpkg "path"
+	"strings"
+)
+
+// fingerprintLength is how many hexadecimal digits of the hash of their
+// content fingerprinted names carry.
+const fingerprintLength = 8
+
+// _unfingerprinted are the names of the assets of file servers by their
+// fingerprinted names.
+var _unfingerprinted = map[string]string{}
+
+func init() {
+	for name, fingerprinted := range _fingerprints {
+		_unfingerprinted[fingerprinted] = name
+	}
+}
+
+// fingerprint returns name with the hash of content before its extension,
+// like app.3f2a9c1b.js, or "" if name has no extension.
+func fingerprint(name string, content []byte) string {
+	ext := pathpkg.Ext(name)
+	if ext == "" || ext == pathpkg.Base(name) {
+		return ""
+	}
+	hash := fmt.Sprintf("%x", md5.Sum(content))[:fingerprintLength]
+	return strings.TrimSuffix(name, ext) + "." + hash + ext
+}
+
+// AssetPath returns the fingerprinted name of the asset of a file server at
+// name, relative to the directory of the file server, if assets were
+// compiled with fingerprints and aren't in dev mode, or name.
+// Fingerprinted names are cached for good, their content never changes.
+func AssetPath(name string) string {
+	fingerprinted, ok := _fingerprints[strings.TrimPrefix(name, "/")]
+	if !ok || devMode() {
+		return name
+	}
+	if strings.HasPrefix(name, "/") {
+		return "/" + fingerprinted
+	}
+	return fingerprinted
+}
+
+// FuncMap returns template helpers linking the assets of a file server
+// mounted at prefix by their fingerprinted names: asset_path, along with
+// javascript_tag and stylesheet_tag which replace those of QOR admin.
+func FuncMap(prefix string) template.FuncMap {
+	assetPath := func(name string) string {
+		return pathpkg.Join(prefix, AssetPath(name))
+	}
+	return template.FuncMap{
+		"asset_path": assetPath,
+		"javascript_tag": func(names ...string) template.HTML {
+			var tags []string
+			for _, name := range names {
+				tags = append(tags, fmt.Sprintf(`<script src="%s"></script>`, assetPath(pathpkg.Join("assets", "javascripts", name+".js"))))
+			}
+			return template.HTML(strings.Join(tags, ""))
+		},
+		"stylesheet_tag": func(names ...string) template.HTML {
+			var tags []string
+			for _, name := range names {
+				tags = append(tags, fmt.Sprintf(`<link type="text/css" rel="stylesheet" href="%s">`, assetPath(pathpkg.Join("assets", "stylesheets", name+".css"))))
+			}
+			return template.HTML(strings.Join(tags, ""))
+		},
+	}
+}
@@ -0,0 +1,96 @@
+package bindatafs
+
+import (
+	"bytes"
+	"html/template"
+	"testing"
+)
+
+// withFingerprints runs test with the assets of file servers compiled with
+// fingerprints, in dev mode if dev is set.
+func withFingerprints(t *testing.T, dev bool, test func(t *testing.T)) {
+	defer func(fingerprints map[string]string, assetFS AssetFSInterface) {
+		_fingerprints, AssetFS = fingerprints, assetFS
+	}(_fingerprints, AssetFS)
+	_fingerprints = map[string]string{
+		"assets/javascripts/app.js":  "assets/javascripts/app.0123abcd.js",
+		"assets/stylesheets/app.css": "assets/stylesheets/app.89abcdef.css",
+		"assets/images/logo.png":     "assets/images/logo.4567cdef.png",
+	}
+	if dev {
+		AssetFS = &bindataFS{dev: &devFS{}}
+	}
+	test(t)
+}
+
+func TestFingerprint(t *testing.T) {
+	for name, fingerprinted := range map[string]string{
+		"app.js":              "app.d2a57dc1.js",
+		"assets/app.js":       "assets/app.d2a57dc1.js",
+		"assets/app.min.js":   "assets/app.min.d2a57dc1.js",
+		"assets/LICENSE":      "",
+		"assets/.gitkeep":     "",
+		"assets.d/javascript": "",
+	} {
+		if f := fingerprint(name, []byte("app")); f != fingerprinted {
+			t.Errorf("fingerprint(%q) = %q, expected %q", name, f, fingerprinted)
+		}
+	}
+}
+
+func TestAssetPath(t *testing.T) {
+	for _, dev := range []bool{false, true} {
+		withFingerprints(t, dev, func(t *testing.T) {
+			for name, fingerprinted := range map[string]string{
+				"assets/images/logo.png":  "assets/images/logo.4567cdef.png",
+				"/assets/images/logo.png": "/assets/images/logo.4567cdef.png",
+				// not compiled, or without fingerprint
+				"assets/images/missing.png": "assets/images/missing.png",
+				"/assets/fonts/icons.woff":  "/assets/fonts/icons.woff",
+				"":                          "",
+			} {
+				expected := fingerprinted
+				if dev {
+					expected = name
+				}
+				if p := AssetPath(name); p != expected {
+					t.Errorf("AssetPath(%q) in dev mode %v = %q, expected %q", name, dev, p, expected)
+				}
+			}
+		})
+	}
+}
+
+func TestFuncMap(t *testing.T) {
+	tmpl := `{{asset_path "assets/images/logo.png"}} {{asset_path "assets/images/missing.png"}} ` +
+		`{{javascript_tag "app" "vendor"}} {{stylesheet_tag "app"}}`
+	for _, c := range []struct {
+		prefix   string
+		dev      bool
+		expected string
+	}{
+		{"/admin", false, `/admin/assets/images/logo.4567cdef.png /admin/assets/images/missing.png ` +
+			`<script src="/admin/assets/javascripts/app.0123abcd.js"></script><script src="/admin/assets/javascripts/vendor.js"></script> ` +
+			`<link type="text/css" rel="stylesheet" href="/admin/assets/stylesheets/app.89abcdef.css">`},
+		{"/", false, `/assets/images/logo.4567cdef.png /assets/images/missing.png ` +
+			`<script src="/assets/javascripts/app.0123abcd.js"></script><script src="/assets/javascripts/vendor.js"></script> ` +
+			`<link type="text/css" rel="stylesheet" href="/assets/stylesheets/app.89abcdef.css">`},
+		{"/admin", true, `/admin/assets/images/logo.png /admin/assets/images/missing.png ` +
+			`<script src="/admin/assets/javascripts/app.js"></script><script src="/admin/assets/javascripts/vendor.js"></script> ` +
+			`<link type="text/css" rel="stylesheet" href="/admin/assets/stylesheets/app.css">`},
+	} {
+		withFingerprints(t, c.dev, func(t *testing.T) {
+			parsed, err := template.New("").Funcs(FuncMap(c.prefix)).Parse(tmpl)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var b bytes.Buffer
+			if err := parsed.Execute(&b, nil); err != nil {
+				t.Fatal(err)
+			}
+			if b.String() != c.expected {
+				t.Errorf("FuncMap(%q) in dev mode %v:\n%s\nexpected\n%s", c.prefix, c.dev, b.String(), c.expected)
+			}
+		})
+	}
+}
@@ -0,0 +1,129 @@
+package bindatafs
+
+import (
+	"fmt"
+	"os"
+	pathpkg "path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Resolution is the file an asset is resolved from among the registered
+// paths of its namespace, and the files it shadows.
+type Resolution struct {
+	NameSpace string
+	// Name is the name of the asset, prefixed by its namespace.
+	Name string
+	// Path is the registered path the asset is resolved from, and Source
+	// its file there.
+	Path   string
+	Source string
+	// Shadows are the files of the asset in the registered paths of lower
+	// precedence, which are never served, in the order they are looked up.
+	Shadows []string `json:",omitempty"`
+
+	info os.FileInfo
+}
+
+// Inspect returns how the assets of the registered paths of nameSpaces, or
+// of every namespace, resolve, sorted by name. Paths registered with
+// PrependPath take precedence over those registered before them, other
+// paths over those registered after them.
+func (assetFS *bindataFS) Inspect(nameSpaces ...string) ([]Resolution, error) {
+	var resolutions []Resolution
+	for _, nameSpace := range assetFS.nameSpaces(nameSpaces) {
+		r, err := resolve(nameSpace, assetFS.paths(nameSpace))
+		if err != nil {
+			return nil, err
+		}
+		resolutions = append(resolutions, r...)
+	}
+	sort.Slice(resolutions, func(i, j int) bool { return resolutions[i].Name < resolutions[j].Name })
+	return resolutions, nil
+}
+
+// Inspect returns how the assets of the namespace resolve, see
+// bindataFS.Inspect.
+func (assetFS *nameSpacedBindataFS) Inspect(nameSpaces ...string) ([]Resolution, error) {
+	return assetFS.bindataFS.Inspect(assetFS.nameSpace)
+}
+
+// nameSpaces returns the namespaces with registered paths among only, or
+// every one, "" standing for the paths registered outside of a namespace.
+func (assetFS *bindataFS) nameSpaces(only []string) []string {
+	var names []string
+	if len(assetFS.viewPaths) > 0 && (len(only) == 0 || contains(only, "")) {
+		names = append(names, "")
+	}
+	for _, fs := range assetFS.nameSpacedFS {
+		if len(only) > 0 && !contains(only, fs.nameSpace) {
+			continue
+		}
+		names = append(names, fs.nameSpace)
+	}
+	return names
+}
+
+// paths returns the registered paths of nameSpace in the order they are
+// looked up.
+func (assetFS *bindataFS) paths(nameSpace string) []viewPath {
+	if nameSpace == "" {
+		return assetFS.viewPaths
+	}
+	for _, fs := range assetFS.nameSpacedFS {
+		if fs.nameSpace == nameSpace {
+			return fs.viewPaths
+		}
+	}
+	return nil
+}
+
+// resolve returns the assets of viewPaths, each from the first path which
+// has it.
+func resolve(nameSpace string, viewPaths []viewPath) ([]Resolution, error) {
+	resolutions := map[string]*Resolution{}
+	var names []string
+	for _, pth := range viewPaths {
+		err := filepath.Walk(pth.Dir, func(path string, info os.FileInfo, err error) error {
+			if err != nil || !info.Mode().IsRegular() {
+				return err
+			}
+			relativePath := strings.TrimPrefix(filepath.ToSlash(strings.TrimPrefix(path, pth.Dir)), "/")
+			if !pth.includes(relativePath) {
+				return nil
+			}
+
+			name := pathpkg.Join(nameSpace, relativePath)
+			if r, ok := resolutions[name]; ok {
+				r.Shadows = append(r.Shadows, path)
+				return nil
+			}
+			resolutions[name] = &Resolution{NameSpace: nameSpace, Name: name, Path: pth.Dir, Source: path, info: info}
+			names = append(names, name)
+			return nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("bindatafs: %s", err)
+		}
+	}
+	out := make([]Resolution, 0, len(names))
+	for _, name := range names {
+		out = append(out, *resolutions[name])
+	}
+	return out, nil
+}
+
+// includes reports whether the asset at relativePath of pth is served, as
+// restricted by its asset paths.
+func (pth viewPath) includes(relativePath string) bool {
+	if len(pth.AssetPaths) == 0 {
+		return true
+	}
+	for _, assetPath := range pth.AssetPaths {
+		if strings.HasPrefix(relativePath, strings.Trim(assetPath, "/")+"/") || relativePath == strings.Trim(assetPath, "/") {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,244 @@
+package bindatafs
+
+import (
+	"bytes"
+	"io"
+	"io/fs"
+	"os"
+	pathpkg "path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// FS returns a read-only io/fs view of the assets, for html/template.ParseFS,
+// http.FS and the like. Compiled assets keep the size, mode and
+// modification time of their files.
+func (assetFS *bindataFS) FS() fs.FS {
+	return &assetsFS{root: assetFS, paths: func() []viewPath { return assetFS.viewPaths }}
+}
+
+// FS returns a read-only io/fs view of the assets of the namespace, see
+// bindataFS.FS.
+func (assetFS *nameSpacedBindataFS) FS() fs.FS {
+	return &assetsFS{
+		root:      assetFS.bindataFS,
+		nameSpace: assetFS.nameSpace,
+		paths:     func() []viewPath { return assetFS.viewPaths },
+	}
+}
+
+// assetsFS is the io/fs view of the assets of a namespace: the compiled ones,
+// or the files of its registered paths, merged, in dev mode or if there are
+// none.
+type assetsFS struct {
+	// root isn't embedded, its Glob doesn't follow io/fs
+	root      *bindataFS
+	nameSpace string
+	// paths returns the registered paths, which may change
+	paths func() []viewPath
+}
+
+var (
+	_ fs.ReadDirFS = &assetsFS{}
+	_ fs.StatFS    = &assetsFS{}
+)
+
+func (f *assetsFS) compiled() bool {
+	return compiled.Len() > 0 && f.root.dev == nil
+}
+
+// Open opens the asset or directory at name.
+func (f *assetsFS) Open(name string) (fs.File, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrInvalid}
+	}
+	if f.compiled() {
+		if key, ok := compiledName(f.nameSpace, name); ok && compiled.Has(key) {
+			content, err := compiled.Asset(key)
+			if err != nil {
+				return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+			}
+			info, err := compiled.AssetInfo(key)
+			if err != nil {
+				return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+			}
+			return &assetFile{Reader: bytes.NewReader(content), info: fileInfo{FileInfo: info, name: pathpkg.Base(name)}}, nil
+		}
+	} else {
+		for _, pth := range f.paths() {
+			full := filepath.Join(pth.Dir, filepath.FromSlash(name))
+			if info, err := os.Stat(full); err == nil && info.Mode().IsRegular() && pth.includes(name) {
+				return os.Open(full)
+			}
+		}
+	}
+	entries, err := f.ReadDir(name)
+	if err != nil {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+	}
+	return &dirFile{info: dirInfo(pathpkg.Base(name)), entries: entries}, nil
+}
+
+// Stat returns the file info of the asset or directory at name.
+func (f *assetsFS) Stat(name string) (fs.FileInfo, error) {
+	file, err := f.Open(name)
+	if err != nil {
+		return nil, &fs.PathError{Op: "stat", Path: name, Err: fs.ErrNotExist}
+	}
+	defer file.Close()
+	return file.Stat()
+}
+
+// ReadDir returns the assets and directories of the directory at name,
+// sorted by name.
+func (f *assetsFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: fs.ErrInvalid}
+	}
+	entries := map[string]fs.DirEntry{}
+	found := name == "."
+	if f.compiled() {
+		prefix := name + "/"
+		if name == "." {
+			prefix = ""
+		}
+		for _, key := range compiled.Names() {
+			assetName, ok := nameInNameSpace(f.nameSpace, key)
+			if !ok || !strings.HasPrefix(assetName, prefix) {
+				continue
+			}
+			found = true
+			rest := strings.TrimPrefix(assetName, prefix)
+			if i := strings.Index(rest, "/"); i >= 0 {
+				entries[rest[:i]] = dirInfo(rest[:i])
+			} else {
+				entries[rest] = &assetEntry{name: rest, key: key}
+			}
+		}
+	} else {
+		for _, pth := range f.paths() {
+			infos, err := os.ReadDir(filepath.Join(pth.Dir, filepath.FromSlash(name)))
+			if err != nil {
+				continue
+			}
+			found = true
+			for _, info := range infos {
+				rel := pathpkg.Join(name, info.Name())
+				if _, ok := entries[info.Name()]; ok || !pth.visible(rel, info.IsDir()) {
+					continue
+				}
+				// directories are merged across the registered paths
+				if info.IsDir() {
+					entries[info.Name()] = dirInfo(info.Name())
+					continue
+				}
+				entries[info.Name()] = info
+			}
+		}
+	}
+	if !found {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: fs.ErrNotExist}
+	}
+	list := make([]fs.DirEntry, 0, len(entries))
+	for _, entry := range entries {
+		list = append(list, entry)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name() < list[j].Name() })
+	return list, nil
+}
+
+// visible reports whether the file or directory at relativePath of pth
+// holds assets, as restricted by its asset paths.
+func (pth viewPath) visible(relativePath string, dir bool) bool {
+	if pth.includes(relativePath) {
+		return true
+	}
+	if dir {
+		for _, assetPath := range pth.AssetPaths {
+			if strings.HasPrefix(strings.Trim(assetPath, "/"), relativePath+"/") {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// assetFile is an open compiled asset.
+type assetFile struct {
+	*bytes.Reader
+	info fs.FileInfo
+}
+
+func (f *assetFile) Stat() (fs.FileInfo, error) { return f.info, nil }
+func (f *assetFile) Close() error               { return nil }
+
+// assetEntry is a compiled asset listed in a directory, its info is read on
+// demand.
+type assetEntry struct {
+	name, key string
+}
+
+func (e *assetEntry) Name() string      { return e.name }
+func (e *assetEntry) IsDir() bool       { return false }
+func (e *assetEntry) Type() fs.FileMode { return 0 }
+func (e *assetEntry) Info() (fs.FileInfo, error) {
+	info, err := compiled.AssetInfo(e.key)
+	if err != nil {
+		return nil, err
+	}
+	return fileInfo{FileInfo: info, name: e.name}, nil
+}
+
+// fileInfo is the info of a compiled asset, named by its base name.
+type fileInfo struct {
+	fs.FileInfo
+	name string
+}
+
+func (i fileInfo) Name() string { return i.name }
+
+// dirInfo is the info of a directory of assets, it is also its entry in
+// the listing of the parent directory.
+type dirInfo string
+
+func (d dirInfo) Name() string       { return string(d) }
+func (d dirInfo) Size() int64        { return 0 }
+func (d dirInfo) Mode() fs.FileMode  { return fs.ModeDir | 0555 }
+func (d dirInfo) ModTime() time.Time { return time.Time{} }
+func (d dirInfo) IsDir() bool        { return true }
+func (d dirInfo) Sys() interface{}   { return nil }
+
+func (d dirInfo) Type() fs.FileMode          { return fs.ModeDir }
+func (d dirInfo) Info() (fs.FileInfo, error) { return d, nil }
+
+// dirFile is an open directory of assets.
+type dirFile struct {
+	info    fs.FileInfo
+	entries []fs.DirEntry
+	offset  int
+}
+
+func (d *dirFile) Stat() (fs.FileInfo, error) { return d.info, nil }
+func (d *dirFile) Close() error               { return nil }
+func (d *dirFile) Read([]byte) (int, error) {
+	return 0, &fs.PathError{Op: "read", Path: d.info.Name(), Err: fs.ErrInvalid}
+}
+
+// ReadDir returns the next n entries of d, every remaining one if n <= 0.
+func (d *dirFile) ReadDir(n int) ([]fs.DirEntry, error) {
+	rest := d.entries[d.offset:]
+	if n <= 0 {
+		d.offset = len(d.entries)
+		return rest, nil
+	}
+	if len(rest) == 0 {
+		return nil, io.EOF
+	}
+	if n > len(rest) {
+		n = len(rest)
+	}
+	d.offset += n
+	return rest[:n], nil
+}
@@ -0,0 +1,89 @@
+package bindatafs
+
+import (
+	"bytes"
+	"errors"
+	"html/template"
+	"io/fs"
+	"reflect"
+	"testing"
+)
+
+// names returns the names of entries.
+func names(entries []fs.DirEntry) []string {
+	var names []string
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+	return names
+}
+
+func TestFSReadDir(t *testing.T) {
+	forEachMode(t, func(t *testing.T, assetFS *bindataFS) {
+		admin := assetFS.NameSpace("admin").(*nameSpacedBindataFS).FS()
+		for _, c := range []struct {
+			fsys    fs.FS
+			dir     string
+			entries []string
+		}{
+			{assetFS.FS(), ".", []string{"root.tmpl", "shared"}},
+			{assetFS.FS(), "shared", []string{"root.tmpl"}},
+			// the directories of the theme and the views are merged
+			{admin, ".", []string{"index.tmpl", "layout.tmpl", "shared"}},
+			{admin, "shared", []string{"footer.tmpl", "header.tmpl", "style.css"}},
+			{assetFS.NameSpace("public").(*nameSpacedBindataFS).FS(), ".", []string{"assets", "home.tmpl", "scripts"}},
+		} {
+			entries, err := fs.ReadDir(c.fsys, c.dir)
+			if err != nil {
+				t.Errorf("ReadDir(%s): %s", c.dir, err)
+			} else if !reflect.DeepEqual(names(entries), c.entries) {
+				t.Errorf("ReadDir(%s) = %q, expected %q", c.dir, names(entries), c.entries)
+			}
+		}
+
+		if info, err := fs.Stat(admin, "shared"); err != nil || !info.IsDir() || info.Name() != "shared" {
+			t.Errorf("Stat(shared) = %v, %v, expected a directory", info, err)
+		}
+		if info, err := fs.Stat(admin, "shared/header.tmpl"); err != nil || info.IsDir() || info.Size() != int64(len("theme header")) {
+			t.Errorf("Stat(shared/header.tmpl) = %v, %v, expected the theme header", info, err)
+		}
+	})
+}
+
+func TestFSOpen(t *testing.T) {
+	forEachMode(t, func(t *testing.T, assetFS *bindataFS) {
+		admin := assetFS.NameSpace("admin").(*nameSpacedBindataFS).FS()
+		for name, content := range map[string]string{
+			"index.tmpl":         "index",
+			"layout.tmpl":        "theme layout",
+			"shared/footer.tmpl": "footer",
+		} {
+			if b, err := fs.ReadFile(admin, name); err != nil || string(b) != content {
+				t.Errorf("ReadFile(%s) = %q, %v, expected %q", name, b, err, content)
+			}
+		}
+		for name, expected := range map[string]error{
+			"missing.tmpl":     fs.ErrNotExist,
+			"home.tmpl":        fs.ErrNotExist,
+			"/index.tmpl":      fs.ErrInvalid,
+			"shared/../x.tmpl": fs.ErrInvalid,
+		} {
+			if _, err := admin.Open(name); !errors.Is(err, expected) {
+				t.Errorf("Open(%s): %v, expected %v", name, err, expected)
+			}
+		}
+
+		shared, err := fs.Sub(admin, "shared")
+		if err != nil {
+			t.Fatal(err)
+		}
+		tmpl, err := template.ParseFS(shared, "*.tmpl")
+		if err != nil {
+			t.Fatal(err)
+		}
+		var b bytes.Buffer
+		if err := tmpl.ExecuteTemplate(&b, "header.tmpl", nil); err != nil || b.String() != "theme header" {
+			t.Errorf("header.tmpl = %q, %v, expected the theme header", b.String(), err)
+		}
+	})
+}
@@ -0,0 +1,32 @@
+package bindatafs
+
+import (
+	"html/template"
+	"net/http"
+
+	"github.com/qor/assetfs"
+	log "github.com/sirupsen/logrus"
+)
+
+// Render responds with status and the HTML template name of fs executed
+// with data. Templates which can't be loaded or parsed are logged and
+// reported as internal server errors.
+func Render(w http.ResponseWriter, fs assetfs.Interface, name string, status int, data interface{}) {
+	content, err := fs.Asset(name)
+	if err != nil {
+		log.Errorf("bindatafs: %s", err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	tmpl, err := template.New(name).Parse(string(content))
+	if err != nil {
+		log.Errorf("bindatafs: parsing %s: %s", name, err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(status)
+	if err := tmpl.Execute(w, data); err != nil {
+		log.Errorf("bindatafs: rendering %s: %s", name, err)
+	}
+}
@@ -0,0 +1,24 @@
+package bindatafs
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRender(t *testing.T) {
+	forEachMode(t, func(t *testing.T, assetFS *bindataFS) {
+		public := assetFS.NameSpace("public")
+		w := httptest.NewRecorder()
+		Render(w, public, "home.tmpl", http.StatusCreated, nil)
+		if w.Code != http.StatusCreated || w.Body.String() != "home" || w.Header().Get("Content-Type") != "text/html; charset=utf-8" {
+			t.Errorf("home.tmpl = %d %q %q", w.Code, w.Header().Get("Content-Type"), w.Body)
+		}
+
+		w = httptest.NewRecorder()
+		Render(w, public, "missing.tmpl", http.StatusOK, nil)
+		if w.Code != http.StatusInternalServerError {
+			t.Errorf("missing.tmpl = %d, expected %d", w.Code, http.StatusInternalServerError)
+		}
+	})
+}
@@ -0,0 +1,77 @@
+package bindatafs
+
+import (
+	"os"
+	pathpkg "path"
+	"strings"
+)
+
+// assetStore holds compiled assets by name, prefixed by their namespace.
+type assetStore interface {
+	Len() int
+	Names() []string
+	Has(name string) bool
+	Asset(name string) ([]byte, error)
+	AssetInfo(name string) (os.FileInfo, error)
+	// NameSpaces are the namespaces compiled.
+	NameSpaces() []string
+}
+
+// compiled are the assets built into the binary with the bindatafs tag, none
+// otherwise.
+var compiled assetStore = bindataStore{}
+
+// bindataStore is the assets generated by CompileWith.
+type bindataStore struct{}
+
+func (bindataStore) Len() int { return len(_bindata) }
+
+func (bindataStore) Names() []string {
+	names := make([]string, 0, len(_bindata))
+	for name := range _bindata {
+		names = append(names, name)
+	}
+	return names
+}
+
+func (bindataStore) Has(name string) bool {
+	_, ok := _bindata[name]
+	return ok
+}
+
+func (bindataStore) Asset(name string) ([]byte, error)          { return Asset(name) }
+func (bindataStore) AssetInfo(name string) (os.FileInfo, error) { return AssetInfo(name) }
+func (bindataStore) NameSpaces() []string                       { return _nameSpaces }
+
+// compiledName returns the name of the compiled asset at name of nameSpace.
+// Assets outside of a namespace can't be under a compiled namespace.
+func compiledName(nameSpace, name string) (string, bool) {
+	name = strings.TrimPrefix(name, "/")
+	if nameSpace != "" {
+		return pathpkg.Join(nameSpace, name), true
+	}
+	return name, !underNameSpace(name)
+}
+
+// nameInNameSpace returns the name of the compiled asset key relative to
+// nameSpace, if it belongs to it.
+func nameInNameSpace(nameSpace, key string) (string, bool) {
+	if nameSpace == "" {
+		return key, !underNameSpace(key)
+	}
+	if !strings.HasPrefix(key, nameSpace+"/") {
+		return "", false
+	}
+	return strings.TrimPrefix(key, nameSpace+"/"), true
+}
+
+// underNameSpace reports whether the compiled asset key belongs to a
+// namespace.
+func underNameSpace(key string) bool {
+	for _, nameSpace := range compiled.NameSpaces() {
+		if strings.HasPrefix(key, nameSpace+"/") {
+			return true
+		}
+	}
+	return false
+}
@@ -2,10 +2,23 @@
 
 package bindatafs
 
-import "fmt"
+import (
+	"fmt"
+	"os"
+)
 
 var _bindata = map[string]interface{}{}
 
+var _encoded = map[string]encodedAsset{}
+
+var _fingerprints = map[string]string{}
+
+var _nameSpaces = []string{}
+
 func Asset(name string) ([]byte, error) {
 	return nil, fmt.Errorf("Asset %s not found", name)
 }
+
+func AssetInfo(name string) (os.FileInfo, error) {
+	return nil, fmt.Errorf("AssetInfo %s not found", name)
+}
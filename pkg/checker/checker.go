@@ -0,0 +1,138 @@
+package checker
+
+import (
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/x0rzkov/oniontree-backend/pkg/config"
+	"github.com/x0rzkov/oniontree-backend/pkg/models"
+)
+
+// Checker checks whether the URLs of services are up, through Tor.
+type Checker struct {
+	DB          *gorm.DB
+	Client      *http.Client
+	Concurrency int
+}
+
+// New returns a Checker of the URLs of db going through the SOCKS proxy of
+// conf.
+func New(db *gorm.DB, conf config.Check) (*Checker, error) {
+	proxy, err := url.Parse(conf.Proxy)
+	if err != nil {
+		return nil, err
+	}
+	return &Checker{
+		DB: db,
+		Client: &http.Client{
+			Timeout:   conf.Timeout,
+			Transport: &http.Transport{Proxy: http.ProxyURL(proxy)},
+			// A redirect is an answer, the service is up
+			CheckRedirect: func(*http.Request, []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		},
+		Concurrency: conf.Concurrency,
+	}, nil
+}
+
+// Healthy reports whether the service at rawurl answers HTTP requests.
+func (c *Checker) Healthy(rawurl string) bool {
+	resp, err := c.Client.Get(rawurl)
+	if err != nil {
+		log.Debugf("checker: %s: %s", rawurl, err)
+		return false
+	}
+	resp.Body.Close()
+	return resp.StatusCode < http.StatusInternalServerError
+}
+
+// Run checks every URL and records whether it is healthy, and when it was
+// checked. It returns how many URLs were checked and how many are healthy.
+func (c *Checker) Run() (checked, healthy int, err error) {
+	var urls []models.URL
+	if err := c.DB.Find(&urls).Error; err != nil {
+		return 0, 0, err
+	}
+
+	concurrency := c.Concurrency
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				urls[i].Healthy = c.Healthy(urls[i].Name)
+			}
+		}()
+	}
+	previous := make([]bool, len(urls))
+	for i := range urls {
+		previous[i] = urls[i].Healthy
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+	if err := c.markChecked(urls, time.Now()); err != nil {
+		return len(urls), 0, err
+	}
+
+	for i, u := range urls {
+		if u.Healthy {
+			healthy++
+		}
+		if u.Healthy == previous[i] {
+			continue
+		}
+		log.Infof("checker: %s healthy: %t", u.Name, u.Healthy)
+		if err := c.DB.Model(&u).Update("healthy", u.Healthy).Error; err != nil {
+			return len(urls), healthy, err
+		}
+	}
+	return len(urls), healthy, nil
+}
+
+// markChecked records that urls were checked at now. The URLs are updated
+// in batches, which are neither audited nor announced.
+func (c *Checker) markChecked(urls []models.URL, now time.Time) error {
+	const batch = 500
+	for start := 0; start < len(urls); start += batch {
+		end := start + batch
+		if end > len(urls) {
+			end = len(urls)
+		}
+		ids := make([]uint, 0, end-start)
+		for _, u := range urls[start:end] {
+			ids = append(ids, u.ID)
+		}
+		if err := c.DB.Model(&models.URL{}).Where("id IN (?)", ids).UpdateColumn("checked_at", now).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Watch runs the checks now and then every interval, in the background.
+func (c *Checker) Watch(interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			if checked, healthy, err := c.Run(); err != nil {
+				log.Errorf("checker: %s", err)
+			} else {
+				log.Infof("checker: %d of %d URLs are healthy", healthy, checked)
+			}
+			<-ticker.C
+		}
+	}()
+}
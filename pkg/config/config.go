@@ -0,0 +1,443 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/jinzhu/configor"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/pflag"
+)
+
+// EnvPrefix prefixes the environment variables overriding the configuration,
+// e.g. ONIONTREE_DATABASE_DSN sets Database.DSN.
+const EnvPrefix = "ONIONTREE"
+
+// DefaultFile is loaded when no configuration file is given, if it exists.
+const DefaultFile = "config/oniontree.yml"
+
+// Config is the configuration shared by every command. Values are taken, from
+// the lowest to the highest precedence, from Default, the YAML, TOML or JSON
+// configuration file, the environment and the command line flags.
+type Config struct {
+	// Debug logs SQL queries and dumps imported services.
+	Debug bool `yaml:"debug" toml:"debug" json:"debug"`
+
+	Log      Log      `yaml:"log" toml:"log" json:"log"`
+	Database Database `yaml:"database" toml:"database" json:"database"`
+	Server   Server   `yaml:"server" toml:"server" json:"server"`
+	Data     Data     `yaml:"data" toml:"data" json:"data"`
+	Webhook  Webhook  `yaml:"webhook" toml:"webhook" json:"webhook"`
+	Check    Check    `yaml:"check" toml:"check" json:"check"`
+	Onion    Onion    `yaml:"onion" toml:"onion" json:"onion"`
+
+	file string
+}
+
+// Log configures logging.
+type Log struct {
+	// Level is one of debug, info, warning or error.
+	Level string `yaml:"level" toml:"level" json:"level"`
+	// Format is text or json.
+	Format string `yaml:"format" toml:"format" json:"format"`
+}
+
+// Database configures the database connection.
+type Database struct {
+	// Dialect is one of sqlite3, postgres or mysql.
+	Dialect string `yaml:"dialect" toml:"dialect" json:"dialect"`
+	// DSN is the path of the SQLite database, or the data source name of
+	// the PostgreSQL or MySQL one, e.g.
+	// "host=localhost user=oniontree dbname=oniontree sslmode=disable" or
+	// "oniontree:secret@tcp(localhost:3306)/oniontree".
+	DSN string `yaml:"dsn" toml:"dsn" json:"dsn"`
+	// Truncate empties the dataset tables before an import, which is
+	// refused while abuse reports or service revisions refer to services.
+	Truncate bool `yaml:"truncate" toml:"truncate" json:"truncate"`
+}
+
+// Server configures the HTTP server.
+type Server struct {
+	Listen string `yaml:"listen" toml:"listen" json:"listen"`
+	// SessionKey secures admin session cookies, it must be at least 32
+	// bytes long. A random key is used when empty.
+	SessionKey string `yaml:"session_key" toml:"session_key" json:"session_key" env:"ONIONTREE_SESSION_KEY"`
+	// DevAssets serves the templates and the assets from their directories,
+	// compiled or not, and reloads them as they change.
+	DevAssets bool `yaml:"dev_assets" toml:"dev_assets" json:"dev_assets"`
+}
+
+// Data configures where the dataset is imported from.
+type Data struct {
+	// Root is a local checkout of the upstream repository.
+	Root string `yaml:"root" toml:"root" json:"root"`
+	// Upstream is the upstream repository: a local path, which may be a
+	// bare repository, a file:// URL or the URL of a remote repository.
+	Upstream string `yaml:"upstream" toml:"upstream" json:"upstream"`
+	// Revision is the branch, tag or full commit SHA of Upstream to import,
+	// HEAD when empty.
+	Revision string `yaml:"revision" toml:"revision" json:"revision"`
+	// Branch is the former name of Revision.
+	//
+	// Deprecated: set Revision instead.
+	Branch string  `yaml:"branch" toml:"branch" json:"branch"`
+	Auth   GitAuth `yaml:"auth" toml:"auth" json:"auth"`
+	// History imports the commit history of Upstream as the timelines of
+	// services.
+	History bool   `yaml:"history" toml:"history" json:"history"`
+	Verify  Verify `yaml:"verify" toml:"verify" json:"verify"`
+	Pull    Pull   `yaml:"pull" toml:"pull" json:"pull"`
+	// Watch imports the changes of the files of Root while serving.
+	Watch bool `yaml:"watch" toml:"watch" json:"watch"`
+	// Trace dumps every file read from the upstream repository and stops
+	// after the hundredth.
+	Trace bool `yaml:"trace" toml:"trace" json:"trace"`
+}
+
+// GitAuth authenticates to the upstream repository. SSH URLs use Key, or the
+// SSH agent without one, HTTP URLs use Username and Password, which may be
+// an access token.
+type GitAuth struct {
+	Username      string `yaml:"username" toml:"username" json:"username"`
+	Password      string `yaml:"password" toml:"password" json:"password"`
+	Key           string `yaml:"key" toml:"key" json:"key"`
+	KeyPassphrase string `yaml:"key_passphrase" toml:"key_passphrase" json:"key_passphrase"`
+}
+
+// Verify configures the verification of the signatures of upstream commits.
+type Verify struct {
+	// Keyring is an armored file of the public keys of trusted
+	// contributors.
+	Keyring string `yaml:"keyring" toml:"keyring" json:"keyring"`
+	// Policy is what happens to the changes of commits which aren't signed
+	// by a trusted key: none imports them, refuse fails the import and
+	// quarantine leaves them out. Commits with a bad signature always fail
+	// the import, unless Policy is none.
+	Policy string `yaml:"policy" toml:"policy" json:"policy"`
+	// Since is the full SHA of the first commit whose signature is
+	// checked, older commits are trusted.
+	Since string `yaml:"since" toml:"since" json:"since"`
+}
+
+// Pull configures the periodic pull of the upstream repository by the
+// server.
+type Pull struct {
+	// Interval is how often Upstream is fetched, never when zero.
+	Interval time.Duration `yaml:"interval" toml:"interval" json:"interval"`
+	// Apply is auto to apply the changes since the last import as soon as
+	// they are pulled, or approval to wait for a maintainer to approve
+	// them in the admin.
+	Apply string `yaml:"apply" toml:"apply" json:"apply"`
+}
+
+// Webhook configures webhook deliveries and key expiry notices.
+type Webhook struct {
+	MaxAttempts int           `yaml:"max_attempts" toml:"max_attempts" json:"max_attempts"`
+	BaseDelay   time.Duration `yaml:"base_delay" toml:"base_delay" json:"base_delay"`
+	MaxDelay    time.Duration `yaml:"max_delay" toml:"max_delay" json:"max_delay"`
+	Timeout     time.Duration `yaml:"timeout" toml:"timeout" json:"timeout"`
+	// KeyExpiryInterval is how often public keys are checked for expiry.
+	KeyExpiryInterval time.Duration `yaml:"key_expiry_interval" toml:"key_expiry_interval" json:"key_expiry_interval"`
+	// KeyExpiryWindow is how long before expiry key.expiring is sent.
+	KeyExpiryWindow time.Duration `yaml:"key_expiry_window" toml:"key_expiry_window" json:"key_expiry_window"`
+}
+
+// Check configures the health checks of service URLs.
+type Check struct {
+	// Proxy is the URL of the Tor SOCKS proxy.
+	Proxy       string        `yaml:"proxy" toml:"proxy" json:"proxy"`
+	Timeout     time.Duration `yaml:"timeout" toml:"timeout" json:"timeout"`
+	Concurrency int           `yaml:"concurrency" toml:"concurrency" json:"concurrency"`
+	// Interval is how often the server checks the URLs, never when zero.
+	Interval time.Duration `yaml:"interval" toml:"interval" json:"interval"`
+}
+
+// Onion configures the hidden service of the server.
+type Onion struct {
+	// Dir is the hidden service directory holding the v3 key, generated
+	// there on first start. No hidden service is set up when empty.
+	Dir string `yaml:"dir" toml:"dir" json:"dir"`
+	// TorDir is Dir as seen by Tor, Dir when empty.
+	TorDir string `yaml:"tor_dir" toml:"tor_dir" json:"tor_dir"`
+	// Port is the port of the hidden service.
+	Port int `yaml:"port" toml:"port" json:"port"`
+	// Target is the address and port Tor forwards the hidden service to,
+	// Tor doesn't resolve host names.
+	Target string `yaml:"target" toml:"target" json:"target"`
+	// Torrc is a file the torrc lines publishing the hidden service are
+	// written to, for a Tor including it.
+	Torrc string `yaml:"torrc" toml:"torrc" json:"torrc"`
+}
+
+// Default returns the configuration used when nothing is overridden.
+func Default() *Config {
+	return &Config{
+		Log: Log{
+			Level:  "info",
+			Format: "text",
+		},
+		Database: Database{
+			Dialect: "sqlite3",
+			DSN:     "oniontree.db",
+		},
+		Server: Server{
+			Listen: ":9000",
+		},
+		Data: Data{
+			Root:     "data/oniontree",
+			Upstream: "https://github.com/onionltd/oniontree",
+			Revision: "master",
+			Verify: Verify{
+				Policy: "none",
+			},
+			Pull: Pull{
+				Apply: "approval",
+			},
+		},
+		Webhook: Webhook{
+			MaxAttempts:       6,
+			BaseDelay:         10 * time.Second,
+			MaxDelay:          time.Hour,
+			Timeout:           15 * time.Second,
+			KeyExpiryInterval: time.Hour,
+			KeyExpiryWindow:   14 * 24 * time.Hour,
+		},
+		Check: Check{
+			Proxy:       "socks5://127.0.0.1:9050",
+			Timeout:     30 * time.Second,
+			Concurrency: 8,
+		},
+		Onion: Onion{
+			Port:   80,
+			Target: "127.0.0.1:9000",
+		},
+	}
+}
+
+// RegisterFlags adds the --config flag and the flags overriding the logging
+// and database configuration of c to fs. Flags default to the current values
+// of c.
+func (c *Config) RegisterFlags(fs *pflag.FlagSet) {
+	fs.StringVarP(&c.file, "config", "c", "", "configuration file, YAML, TOML or JSON (default "+DefaultFile+" if it exists)")
+	fs.BoolVarP(&c.Debug, "debug", "d", c.Debug, "log SQL queries and dump imported services")
+	fs.StringVar(&c.Log.Level, "log-level", c.Log.Level, "log level, one of debug, info, warning or error")
+	fs.StringVar(&c.Log.Format, "log-format", c.Log.Format, "log format, text or json")
+	fs.StringVar(&c.Database.Dialect, "db-dialect", c.Database.Dialect, "database dialect, one of sqlite3, postgres or mysql")
+	fs.StringVar(&c.Database.DSN, "db-dsn", c.Database.DSN, "database data source name")
+}
+
+// RegisterServerFlags adds the flags overriding the server configuration of
+// c, and whether it watches the data root, to fs.
+func (c *Config) RegisterServerFlags(fs *pflag.FlagSet) {
+	fs.StringVarP(&c.Server.Listen, "listen", "l", c.Server.Listen, "address to listen on")
+	fs.BoolVar(&c.Data.Watch, "watch", c.Data.Watch, "import the changes of the files of the data root as they are made")
+	fs.BoolVar(&c.Server.DevAssets, "dev-assets", c.Server.DevAssets, "serve the templates and assets from their directories and reload them as they change")
+	fs.DurationVar(&c.Check.Interval, "check-interval", c.Check.Interval, "how often the URLs of services are checked, never when zero")
+}
+
+// RegisterPullFlags adds the flags overriding the periodic pull
+// configuration of c to fs.
+func (c *Config) RegisterPullFlags(fs *pflag.FlagSet) {
+	fs.DurationVar(&c.Data.Pull.Interval, "pull-interval", c.Data.Pull.Interval, "how often the upstream repository is pulled, never when zero")
+	fs.StringVar(&c.Data.Pull.Apply, "pull-apply", c.Data.Pull.Apply, "how pulled changes are applied, auto or approval")
+}
+
+// RegisterDataFlags adds the flags overriding where the dataset is imported
+// from to fs.
+func (c *Config) RegisterDataFlags(fs *pflag.FlagSet) {
+	fs.StringVar(&c.Data.Root, "data-root", c.Data.Root, "local checkout of the upstream repository")
+	fs.StringVar(&c.Data.Upstream, "upstream", c.Data.Upstream, "upstream repository, a local path or a git URL")
+	fs.StringVar(&c.Data.Revision, "revision", c.Data.Revision, "branch, tag or commit SHA of the upstream repository")
+	fs.StringVar(&c.Data.Revision, "branch", c.Data.Revision, "branch of the upstream repository")
+	fs.MarkDeprecated("branch", "use --revision instead")
+	fs.StringVar(&c.Data.Auth.Username, "git-username", c.Data.Auth.Username, "user name for the upstream repository")
+	fs.StringVar(&c.Data.Auth.Key, "git-key", c.Data.Auth.Key, "SSH private key for the upstream repository")
+	fs.BoolVar(&c.Data.History, "history", c.Data.History, "import the commit history of the upstream repository as service timelines")
+	fs.StringVar(&c.Data.Verify.Keyring, "keyring", c.Data.Verify.Keyring, "armored keyring of the contributors trusted to sign upstream commits")
+	fs.StringVar(&c.Data.Verify.Policy, "verify", c.Data.Verify.Policy, "changes of commits not signed by a trusted key: none, refuse or quarantine")
+	fs.StringVar(&c.Data.Verify.Since, "verify-since", c.Data.Verify.Since, "full SHA of the first upstream commit whose signature is checked")
+	fs.BoolVar(&c.Database.Truncate, "db-truncate", c.Database.Truncate, "empty the dataset tables before the import, refused while abuse reports or service revisions refer to services")
+}
+
+// RegisterCheckFlags adds the flags overriding the health check
+// configuration of c to fs.
+func (c *Config) RegisterCheckFlags(fs *pflag.FlagSet) {
+	fs.StringVar(&c.Check.Proxy, "proxy", c.Check.Proxy, "URL of the Tor SOCKS proxy")
+	fs.DurationVar(&c.Check.Timeout, "timeout", c.Check.Timeout, "timeout of a check")
+	fs.IntVar(&c.Check.Concurrency, "concurrency", c.Check.Concurrency, "number of URLs checked at once")
+}
+
+// RegisterOnionFlags adds the flags overriding the hidden service
+// configuration of c to fs.
+func (c *Config) RegisterOnionFlags(fs *pflag.FlagSet) {
+	fs.StringVar(&c.Onion.Dir, "onion-dir", c.Onion.Dir, "hidden service directory holding the v3 key, generated if missing")
+	fs.StringVar(&c.Onion.TorDir, "onion-tor-dir", c.Onion.TorDir, "hidden service directory as seen by Tor, if it differs")
+	fs.IntVar(&c.Onion.Port, "onion-port", c.Onion.Port, "port of the hidden service")
+	fs.StringVar(&c.Onion.Target, "onion-target", c.Onion.Target, "IP address and port Tor forwards the hidden service to")
+	fs.StringVar(&c.Onion.Torrc, "onion-torrc", c.Onion.Torrc, "file the torrc lines publishing the hidden service are written to")
+}
+
+// Load reads the configuration file and the environment into c, then
+// applies again the flags of fs which were set on the command line, so that
+// they take precedence. fs must have been parsed.
+func (c *Config) Load(fs *pflag.FlagSet) error {
+	flags := map[string]string{}
+	slices := map[string][]string{}
+	if fs != nil {
+		fs.Visit(func(f *pflag.Flag) {
+			// setting a slice flag again would append to it
+			if s, ok := f.Value.(pflag.SliceValue); ok {
+				slices[f.Name] = s.GetSlice()
+				return
+			}
+			flags[f.Name] = f.Value.String()
+		})
+	}
+
+	file := c.file
+	if file == "" {
+		file = os.Getenv(EnvPrefix + "_CONFIG")
+	}
+	if file == "" {
+		if _, err := os.Stat(DefaultFile); err == nil {
+			file = DefaultFile
+		}
+	} else if _, err := os.Stat(file); err != nil {
+		return fmt.Errorf("config: %s", err)
+	}
+
+	var files []string
+	if file != "" {
+		files = append(files, file)
+	}
+	if err := configor.New(&configor.Config{ENVPrefix: EnvPrefix, Silent: true}).Load(c, files...); err != nil {
+		return fmt.Errorf("config: %s", err)
+	}
+	if err := c.Data.renameBranch(); err != nil {
+		return err
+	}
+
+	for name, value := range flags {
+		if err := fs.Set(name, value); err != nil {
+			return err
+		}
+	}
+	for name, values := range slices {
+		if err := fs.Lookup(name).Value.(pflag.SliceValue).Replace(values); err != nil {
+			return err
+		}
+	}
+	return c.Validate()
+}
+
+// renameBranch moves the deprecated Branch to Revision, unless Revision was
+// changed to another revision too.
+func (d *Data) renameBranch() error {
+	if d.Branch == "" {
+		return nil
+	}
+	logrus.Warnf("config: data branch is deprecated, set data revision to %q instead", d.Branch)
+	if d.Revision != d.Branch && d.Revision != Default().Data.Revision {
+		return fmt.Errorf("config: data branch %q and revision %q differ, set only the revision", d.Branch, d.Revision)
+	}
+	d.Revision, d.Branch = d.Branch, ""
+	return nil
+}
+
+// Validate reports the first invalid value of c.
+func (c *Config) Validate() error {
+	if _, err := logrus.ParseLevel(c.Log.Level); err != nil {
+		return fmt.Errorf("config: %s", err)
+	}
+	switch c.Log.Format {
+	case "text", "json":
+	default:
+		return fmt.Errorf("config: unsupported log format %q", c.Log.Format)
+	}
+	switch c.Database.Dialect {
+	case "sqlite3", "postgres", "mysql":
+	default:
+		return fmt.Errorf("config: unsupported database dialect %q", c.Database.Dialect)
+	}
+	if c.Database.DSN == "" {
+		return errors.New("config: database dsn is required")
+	}
+	if c.Server.Listen == "" {
+		return errors.New("config: server listen address is required")
+	}
+	if c.Server.SessionKey != "" && len(c.Server.SessionKey) < 32 {
+		return errors.New("config: server session key must be at least 32 bytes long")
+	}
+	if c.Data.Root == "" {
+		return errors.New("config: data root is required")
+	}
+	switch c.Data.Verify.Policy {
+	case "none":
+	case "refuse", "quarantine":
+		if c.Data.Verify.Keyring == "" {
+			return fmt.Errorf("config: data verify policy %s requires a keyring", c.Data.Verify.Policy)
+		}
+	default:
+		return fmt.Errorf("config: unsupported data verify policy %q", c.Data.Verify.Policy)
+	}
+	if c.Data.Pull.Interval < 0 {
+		return errors.New("config: data pull interval can't be negative")
+	}
+	switch c.Data.Pull.Apply {
+	case "auto", "approval":
+	default:
+		return fmt.Errorf("config: unsupported data pull apply %q", c.Data.Pull.Apply)
+	}
+	if s := c.Data.Verify.Since; s != "" && !isSHA(s) {
+		return fmt.Errorf("config: data verify since must be a full commit SHA, got %q", s)
+	}
+	if c.Webhook.MaxAttempts < 1 {
+		return errors.New("config: webhook max attempts must be at least 1")
+	}
+	for name, d := range map[string]time.Duration{
+		"base delay":          c.Webhook.BaseDelay,
+		"max delay":           c.Webhook.MaxDelay,
+		"timeout":             c.Webhook.Timeout,
+		"key expiry interval": c.Webhook.KeyExpiryInterval,
+		"key expiry window":   c.Webhook.KeyExpiryWindow,
+	} {
+		if d <= 0 {
+			return fmt.Errorf("config: webhook %s must be positive", name)
+		}
+	}
+	if c.Check.Proxy == "" {
+		return errors.New("config: check proxy is required")
+	}
+	if c.Check.Timeout <= 0 {
+		return errors.New("config: check timeout must be positive")
+	}
+	if c.Check.Concurrency < 1 {
+		return errors.New("config: check concurrency must be at least 1")
+	}
+	if c.Check.Interval < 0 {
+		return errors.New("config: check interval can't be negative")
+	}
+	if c.Onion.Port < 1 || c.Onion.Port > 65535 {
+		return fmt.Errorf("config: onion port %d is out of range", c.Onion.Port)
+	}
+	if host, _, err := net.SplitHostPort(c.Onion.Target); err != nil || net.ParseIP(host) == nil {
+		return fmt.Errorf("config: onion target must be an IP address and a port, got %q", c.Onion.Target)
+	}
+	return nil
+}
+
+func isSHA(s string) bool {
+	if len(s) != 40 {
+		return false
+	}
+	for _, r := range s {
+		if !strings.ContainsRune("0123456789abcdef", r) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,98 @@
+package config
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/spf13/pflag"
+)
+
+// load loads the YAML configuration content over the defaults.
+func load(t *testing.T, content string) (*Config, error) {
+	t.Helper()
+	dir, err := ioutil.TempDir("", "oniontree")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	c := Default()
+	c.file = filepath.Join(dir, "oniontree.yml")
+	if err := ioutil.WriteFile(c.file, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return c, c.Load(nil)
+}
+
+func TestLoadBranch(t *testing.T) {
+	for _, c := range []struct {
+		content, revision string
+	}{
+		{"data:\n  branch: dev\n", "dev"},
+		{"data:\n  branch: dev\n  revision: dev\n", "dev"},
+		{"data:\n  revision: v1.0\n", "v1.0"},
+		{"data:\n  branch: dev\n  revision: v1.0\n", ""},
+	} {
+		conf, err := load(t, c.content)
+		if c.revision == "" {
+			if err == nil {
+				t.Errorf("%q: expected an error", c.content)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%q: %s", c.content, err)
+		} else if conf.Data.Revision != c.revision || conf.Data.Branch != "" {
+			t.Errorf("%q: revision %q and branch %q, expected revision %q", c.content, conf.Data.Revision, conf.Data.Branch, c.revision)
+		}
+	}
+
+	os.Setenv(EnvPrefix+"_DATA_BRANCH", "dev")
+	defer os.Unsetenv(EnvPrefix + "_DATA_BRANCH")
+	conf, err := load(t, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if conf.Data.Revision != "dev" {
+		t.Errorf("revision %q, expected the branch of the environment", conf.Data.Revision)
+	}
+}
+
+func TestLoadFlags(t *testing.T) {
+	c := Default()
+	fs := pflag.NewFlagSet("test", pflag.ContinueOnError)
+	c.RegisterFlags(fs)
+	c.RegisterDataFlags(fs)
+	// flags of commands, which Load applies again too
+	include := fs.StringSlice("include", nil, "")
+	if err := fs.Parse([]string{"--log-level", "debug", "--branch", "dev", "--include", "a,b", "--include", "c"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Load(fs); err != nil {
+		t.Fatal(err)
+	}
+	if c.Log.Level != "debug" || c.Data.Revision != "dev" {
+		t.Errorf("log level %q and revision %q, expected the flags", c.Log.Level, c.Data.Revision)
+	}
+	// slice flags aren't appended to again
+	if expected := []string{"a", "b", "c"}; !reflect.DeepEqual(*include, expected) {
+		t.Errorf("include = %q, expected %q", *include, expected)
+	}
+}
+
+func TestValidateWebhook(t *testing.T) {
+	for _, content := range []string{
+		"webhook:\n  key_expiry_window: 0s\n",
+		"webhook:\n  key_expiry_window: -24h\n",
+		"webhook:\n  key_expiry_interval: 0s\n",
+	} {
+		if _, err := load(t, content); err == nil {
+			t.Errorf("%q: expected an error", content)
+		}
+	}
+	if _, err := load(t, "webhook:\n  key_expiry_window: 72h\n"); err != nil {
+		t.Error(err)
+	}
+}
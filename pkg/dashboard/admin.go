@@ -0,0 +1,99 @@
+package dashboard
+
+import (
+	"time"
+
+	"github.com/qor/admin"
+	"github.com/qor/roles"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/x0rzkov/oniontree-backend/pkg/audit"
+	"github.com/x0rzkov/oniontree-backend/pkg/submission"
+)
+
+// Options configures the dashboard.
+type Options struct {
+	// Limit is how many recent changes, pending submissions and services
+	// which are down are listed.
+	Limit int
+	// KeyExpiryWindow is how long before expiry public keys are listed.
+	KeyExpiryWindow time.Duration
+}
+
+// Overview is what the dashboard shows a user. Sections the user may not
+// read are left empty, see ConfigureAdmin.
+type Overview struct {
+	Tags   []TagCount
+	Health *Health
+
+	CanReadChanges bool
+	RecentChanges  []audit.AuditEvent
+
+	CanReadSubmissions bool
+	PendingCount       int
+	Pending            []submission.Submission
+
+	CanReadKeys  bool
+	ExpiringKeys []ExpiringKey
+	// KeyExpiryDays is how long before expiry keys are listed, in days.
+	KeyExpiryDays int
+}
+
+// ConfigureAdmin makes the dashboard, the landing page of Admin, show the
+// services per tag, their health, the recent changes, the pending
+// submissions and the expiring keys. The dashboard template calls
+// oniontree_dashboard to load them, each section only if the user may read
+// the resource it comes from.
+func ConfigureAdmin(Admin *admin.Admin, opts Options) {
+	if opts.Limit <= 0 {
+		opts.Limit = 10
+	}
+	Admin.RegisterFuncMap("oniontree_dashboard", func(context *admin.Context) *Overview {
+		overview, err := load(context, opts)
+		if err != nil {
+			log.Errorf("dashboard: %s", err)
+		}
+		return overview
+	})
+}
+
+// load returns the overview of the sections the user of context may read.
+func load(context *admin.Context, opts Options) (*Overview, error) {
+	db := context.GetDB()
+	overview := &Overview{KeyExpiryDays: int(opts.KeyExpiryWindow / (24 * time.Hour))}
+	var err error
+
+	if canRead(context, "Tag") {
+		if overview.Tags, err = TagCounts(db); err != nil {
+			return overview, err
+		}
+	}
+	if canRead(context, "Service") {
+		if overview.Health, err = LoadHealth(db, opts.Limit); err != nil {
+			return overview, err
+		}
+	}
+	if overview.CanReadChanges = canRead(context, "AuditEvent"); overview.CanReadChanges {
+		if overview.RecentChanges, err = RecentChanges(db, opts.Limit); err != nil {
+			return overview, err
+		}
+	}
+	if overview.CanReadSubmissions = canRead(context, "Submission"); overview.CanReadSubmissions {
+		if overview.PendingCount, overview.Pending, err = PendingSubmissions(db, opts.Limit); err != nil {
+			return overview, err
+		}
+	}
+	if overview.CanReadKeys = canRead(context, "PublicKey"); overview.CanReadKeys {
+		if overview.ExpiringKeys, err = ExpiringKeys(db, opts.KeyExpiryWindow); err != nil {
+			return overview, err
+		}
+	}
+	return overview, nil
+}
+
+// canRead reports whether the user of context may read the resource called
+// name, which must be added to the admin.
+func canRead(context *admin.Context, name string) bool {
+	res := context.Admin.GetResource(name)
+	return res != nil && res.HasPermission(roles.Read, context.Context)
+}
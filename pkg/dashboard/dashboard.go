@@ -0,0 +1,154 @@
+package dashboard
+
+import (
+	"sort"
+	"time"
+
+	"github.com/jinzhu/gorm"
+
+	"github.com/x0rzkov/oniontree-backend/pkg/audit"
+	"github.com/x0rzkov/oniontree-backend/pkg/models"
+	"github.com/x0rzkov/oniontree-backend/pkg/submission"
+	"github.com/x0rzkov/oniontree-backend/pkg/webhook"
+)
+
+// TagCount is the number of services tagged with a tag.
+type TagCount struct {
+	Name     string
+	Services int
+}
+
+// TagCounts returns the number of services of every tag, the most used tag
+// first.
+func TagCounts(db *gorm.DB) ([]TagCount, error) {
+	var counts []TagCount
+	err := db.Table("tags").
+		Select("tags.name AS name, COUNT(services.id) AS services").
+		Joins("LEFT JOIN service_tags ON service_tags.tag_id = tags.id").
+		Joins("LEFT JOIN services ON services.id = service_tags.service_id AND services.deleted_at IS NULL").
+		Where("tags.deleted_at IS NULL").
+		Group("tags.id, tags.name").
+		Order("services DESC, name").
+		Scan(&counts).Error
+	return counts, err
+}
+
+// Health is how many services and URLs answered the last check.
+type Health struct {
+	// Services are counted as healthy when one of their URLs answered the
+	// last check, down when none did and one was checked, and unchecked
+	// otherwise.
+	Services, HealthyServices, DownServices int
+	URLs, HealthyURLs, UncheckedURLs        int
+	// Down are the first services which are down, by name.
+	Down []models.Service
+}
+
+// MoreDown returns the number of services which are down but not in Down.
+func (h Health) MoreDown() int {
+	return h.DownServices - len(h.Down)
+}
+
+// Conditions on services about their URLs.
+const (
+	hasHealthyURL = "EXISTS (SELECT 1 FROM urls WHERE urls.service_id = services.id AND urls.deleted_at IS NULL AND urls.healthy = ?)"
+	hasCheckedURL = "EXISTS (SELECT 1 FROM urls WHERE urls.service_id = services.id AND urls.deleted_at IS NULL AND urls.checked_at IS NOT NULL)"
+)
+
+// LoadHealth returns the health of the services, as recorded by the checker,
+// along with the first limit services which are down.
+func LoadHealth(db *gorm.DB, limit int) (*Health, error) {
+	health := &Health{}
+	services := db.Model(&models.Service{})
+	down := services.Where("NOT "+hasHealthyURL, true).Where(hasCheckedURL)
+	urls := db.Model(&models.URL{}).Joins("JOIN services ON services.id = urls.service_id AND services.deleted_at IS NULL")
+	for _, err := range []error{
+		services.Count(&health.Services).Error,
+		services.Where(hasHealthyURL, true).Count(&health.HealthyServices).Error,
+		down.Count(&health.DownServices).Error,
+		urls.Count(&health.URLs).Error,
+		urls.Where("urls.healthy = ?", true).Count(&health.HealthyURLs).Error,
+		urls.Where("urls.checked_at IS NULL").Count(&health.UncheckedURLs).Error,
+	} {
+		if err != nil {
+			return nil, err
+		}
+	}
+	if health.DownServices > 0 {
+		if err := down.Order("name").Limit(limit).Find(&health.Down).Error; err != nil {
+			return nil, err
+		}
+	}
+	return health, nil
+}
+
+// RecentChanges returns the last limit changes of the audit log, the latest
+// first.
+func RecentChanges(db *gorm.DB, limit int) ([]audit.AuditEvent, error) {
+	var events []audit.AuditEvent
+	err := db.Order("created_at DESC, id DESC").Limit(limit).Find(&events).Error
+	return events, err
+}
+
+// PendingSubmissions returns the number of submissions waiting for a
+// moderator and the oldest limit of them, the oldest first.
+func PendingSubmissions(db *gorm.DB, limit int) (int, []submission.Submission, error) {
+	pending := db.Model(&submission.Submission{}).Where("status = ?", submission.StatusPending)
+	var count int
+	if err := pending.Count(&count).Error; err != nil {
+		return 0, nil, err
+	}
+	var submissions []submission.Submission
+	err := pending.Order("created_at, id").Limit(limit).Find(&submissions).Error
+	return count, submissions, err
+}
+
+// ExpiringKey is a public key expiring soon, or expired.
+type ExpiringKey struct {
+	Key       models.PublicKey
+	Service   models.Service
+	ExpiresAt time.Time
+}
+
+// Expired reports whether the key has expired.
+func (k ExpiringKey) Expired() bool {
+	return k.ExpiresAt.Before(time.Now())
+}
+
+// ExpiringKeys returns the public keys expiring within window, or expired,
+// the first to expire first, along with their services.
+func ExpiringKeys(db *gorm.DB, window time.Duration) ([]ExpiringKey, error) {
+	var keys []models.PublicKey
+	if err := db.Where("value <> ''").Find(&keys).Error; err != nil {
+		return nil, err
+	}
+	var (
+		expiring   []ExpiringKey
+		serviceIDs []uint
+	)
+	for _, key := range keys {
+		expiresAt, ok, err := webhook.KeyExpiry(key.Value)
+		if err != nil || !ok || time.Until(expiresAt) > window {
+			continue
+		}
+		expiring = append(expiring, ExpiringKey{Key: key, ExpiresAt: expiresAt})
+		serviceIDs = append(serviceIDs, key.ServiceID)
+	}
+	if len(expiring) == 0 {
+		return nil, nil
+	}
+
+	var services []models.Service
+	if err := db.Where("id IN (?)", serviceIDs).Find(&services).Error; err != nil {
+		return nil, err
+	}
+	byID := map[uint]models.Service{}
+	for _, service := range services {
+		byID[service.ID] = service
+	}
+	for i := range expiring {
+		expiring[i].Service = byID[expiring[i].Key.ServiceID]
+	}
+	sort.Slice(expiring, func(i, j int) bool { return expiring[i].ExpiresAt.Before(expiring[j].ExpiresAt) })
+	return expiring, nil
+}
@@ -0,0 +1,67 @@
+package dashboard
+
+import (
+	"testing"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	_ "github.com/jinzhu/gorm/dialects/sqlite"
+
+	"github.com/x0rzkov/oniontree-backend/pkg/models"
+)
+
+func TestLoadHealth(t *testing.T) {
+	db, err := gorm.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if err := db.AutoMigrate(models.Tables...).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	checked := time.Now()
+	for _, svc := range []*models.Service{
+		// up, though one of its URLs is down
+		{Name: "a", URLs: []*models.URL{
+			{Name: "http://a.onion", Healthy: true, CheckedAt: &checked},
+			{Name: "http://a2.onion", CheckedAt: &checked},
+		}},
+		{Name: "d", URLs: []*models.URL{{Name: "http://d.onion", CheckedAt: &checked}}},
+		{Name: "c", URLs: []*models.URL{{Name: "http://c.onion", CheckedAt: &checked}}},
+		// down, its new URL wasn't checked yet
+		{Name: "b", URLs: []*models.URL{{Name: "http://b.onion", CheckedAt: &checked}, {Name: "http://b2.onion"}}},
+		// never checked
+		{Name: "e", URLs: []*models.URL{{Name: "http://e.onion"}}},
+		{Name: "f"},
+	} {
+		if err := db.Create(svc).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	deleted := &models.Service{Name: "g", URLs: []*models.URL{{Name: "http://g.onion", CheckedAt: &checked}}}
+	if err := db.Create(deleted).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Delete(deleted).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	health, err := LoadHealth(db, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if health.Services != 6 || health.HealthyServices != 1 || health.DownServices != 3 {
+		t.Errorf("%d services, %d healthy and %d down, expected 6, 1 and 3", health.Services, health.HealthyServices, health.DownServices)
+	}
+	if health.URLs != 7 || health.HealthyURLs != 1 || health.UncheckedURLs != 2 {
+		t.Errorf("%d URLs, %d healthy and %d unchecked, expected 7, 1 and 2", health.URLs, health.HealthyURLs, health.UncheckedURLs)
+	}
+	var down []string
+	for _, svc := range health.Down {
+		down = append(down, svc.Name)
+	}
+	if len(down) != 2 || down[0] != "b" || down[1] != "c" || health.MoreDown() != 1 {
+		t.Errorf("down = %q and %d more, expected [b c] and 1 more", down, health.MoreDown())
+	}
+}
@@ -0,0 +1,43 @@
+package database
+
+import (
+	"fmt"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/jinzhu/gorm"
+	_ "github.com/jinzhu/gorm/dialects/mysql"
+	_ "github.com/jinzhu/gorm/dialects/postgres"
+	_ "github.com/jinzhu/gorm/dialects/sqlite"
+
+	"github.com/x0rzkov/oniontree-backend/pkg/config"
+)
+
+// Open connects to the database configured by conf.
+//
+// MySQL DSNs are given parseTime=true, which GORM needs to scan timestamps.
+// SQLite databases are limited to a single connection, as SQLite only copes
+// with a single writer and background jobs write concurrently.
+func Open(conf config.Database) (*gorm.DB, error) {
+	dsn := conf.DSN
+	switch conf.Dialect {
+	case "sqlite3", "postgres":
+	case "mysql":
+		c, err := mysql.ParseDSN(dsn)
+		if err != nil {
+			return nil, fmt.Errorf("database: %s", err)
+		}
+		c.ParseTime = true
+		dsn = c.FormatDSN()
+	default:
+		return nil, fmt.Errorf("database: unsupported dialect %q", conf.Dialect)
+	}
+
+	db, err := gorm.Open(conf.Dialect, dsn)
+	if err != nil {
+		return nil, fmt.Errorf("database: %s", err)
+	}
+	if conf.Dialect == "sqlite3" {
+		db.DB().SetMaxOpenConns(1)
+	}
+	return db, nil
+}
@@ -0,0 +1,224 @@
+package database_test
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	sqle "github.com/dolthub/go-mysql-server"
+	"github.com/dolthub/go-mysql-server/memory"
+	"github.com/dolthub/go-mysql-server/server"
+	"github.com/dolthub/go-mysql-server/sql"
+	"github.com/dolthub/go-mysql-server/sql/information_schema"
+	"github.com/jinzhu/gorm"
+	"github.com/onionltd/oniontree-tools/pkg/types/service"
+	"github.com/qor/validations"
+
+	"github.com/x0rzkov/oniontree-backend/pkg/abuse"
+	"github.com/x0rzkov/oniontree-backend/pkg/audit"
+	"github.com/x0rzkov/oniontree-backend/pkg/auth"
+	"github.com/x0rzkov/oniontree-backend/pkg/config"
+	"github.com/x0rzkov/oniontree-backend/pkg/database"
+	"github.com/x0rzkov/oniontree-backend/pkg/importer"
+	"github.com/x0rzkov/oniontree-backend/pkg/migrate"
+	"github.com/x0rzkov/oniontree-backend/pkg/models"
+	"github.com/x0rzkov/oniontree-backend/pkg/submission"
+	"github.com/x0rzkov/oniontree-backend/pkg/webhook"
+)
+
+// tables lists every model of the application.
+func tables() []interface{} {
+	var all []interface{}
+	for _, t := range [][]interface{}{models.Tables, webhook.Tables, submission.Tables, abuse.Tables, auth.Tables, audit.Tables, importer.Tables} {
+		all = append(all, t...)
+	}
+	return all
+}
+
+// forEachBackend runs test against an SQLite file, an in-memory SQLite
+// database, an in-process MySQL server, and the PostgreSQL and MySQL
+// databases given by the ONIONTREE_TEST_POSTGRES_DSN and
+// ONIONTREE_TEST_MYSQL_DSN environment variables. The schema is migrated
+// from scratch for every backend.
+func forEachBackend(t *testing.T, test func(t *testing.T, db *gorm.DB)) {
+	dir, err := ioutil.TempDir("", "oniontree")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	backends := map[string]config.Database{
+		"sqlite3-file":   {Dialect: "sqlite3", DSN: filepath.Join(dir, "oniontree.db")},
+		"sqlite3-memory": {Dialect: "sqlite3", DSN: ":memory:"},
+		"mysql-embedded": {Dialect: "mysql", DSN: startMySQL(t)},
+	}
+	if dsn := os.Getenv("ONIONTREE_TEST_POSTGRES_DSN"); dsn != "" {
+		backends["postgres"] = config.Database{Dialect: "postgres", DSN: dsn}
+	}
+	if dsn := os.Getenv("ONIONTREE_TEST_MYSQL_DSN"); dsn != "" {
+		backends["mysql"] = config.Database{Dialect: "mysql", DSN: dsn}
+	}
+
+	for name, conf := range backends {
+		conf := conf
+		t.Run(name, func(t *testing.T) {
+			db, err := database.Open(conf)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer db.Close()
+
+			if err := db.DropTableIfExists(append(tables(), "service_tags", &migrate.SchemaMigration{})...).Error; err != nil {
+				t.Fatal(err)
+			}
+			if _, err := migrate.New(db).Up(0); err != nil {
+				t.Fatal(err)
+			}
+			test(t, db)
+		})
+	}
+}
+
+// startMySQL starts a MySQL server backed by memory, which stands in for
+// MySQL without a database to connect to, and returns its DSN. Parameters
+// are interpolated by the client, as the server doesn't prepare SHOW
+// statements.
+func startMySQL(t *testing.T) string {
+	engine := sqle.NewDefault(sql.NewDatabaseProvider(
+		memory.NewDatabase("oniontree"),
+		information_schema.NewInformationSchemaDatabase(),
+	))
+	s, err := server.NewDefaultServer(server.Config{Protocol: "tcp", Address: "127.0.0.1:0"}, engine)
+	if err != nil {
+		t.Fatal(err)
+	}
+	go s.Start()
+	t.Cleanup(func() { s.Close() })
+	return fmt.Sprintf("root@tcp(%s)/oniontree?interpolateParams=true", s.Listener.Addr())
+}
+
+func TestOpenUnsupportedDialect(t *testing.T) {
+	if _, err := database.Open(config.Database{Dialect: "oracle", DSN: "x"}); err == nil {
+		t.Fatal("expected an error")
+	}
+}
+
+func TestMigrationsRoundTrip(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, db *gorm.DB) {
+		m := migrate.New(db)
+		reverted, err := m.Down(len(migrate.Migrations))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(reverted) != len(migrate.Migrations) {
+			t.Fatalf("reverted %d migrations, want %d", len(reverted), len(migrate.Migrations))
+		}
+		for _, table := range tables() {
+			if db.HasTable(table) {
+				t.Errorf("table of %T is left after reverting every migration", table)
+			}
+		}
+		if _, err := m.Up(0); err != nil {
+			t.Fatal(err)
+		}
+		statuses, err := m.Status()
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, s := range statuses {
+			if !s.Applied {
+				t.Errorf("migration %d %s is pending", s.Version, s.Name)
+			}
+		}
+	})
+}
+
+func TestServiceRoundTrip(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, db *gorm.DB) {
+		description := strings.Repeat("A long description. ", 100)
+		key := strings.Repeat("k", 4096)
+		created, err := models.CreateService(db, service.Service{
+			Name:        "Example Service",
+			Description: description,
+			URLs:        []string{"http://expyuzz4wqqyqhjn.onion", "http://3g2upl4pq6kufc4m.onion"},
+			PublicKeys:  []service.PublicKey{{ID: "ABCDEF0123456789", Value: key}},
+		}, "forum", "chat")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var svc models.Service
+		if err := db.Preload("URLs").Preload("PublicKeys").Preload("Tags").First(&svc, created.ID).Error; err != nil {
+			t.Fatal(err)
+		}
+		if svc.Slug != "example-service" {
+			t.Errorf("slug = %q", svc.Slug)
+		}
+		if svc.Description != description {
+			t.Errorf("description of %d bytes came back as %d bytes", len(description), len(svc.Description))
+		}
+		if len(svc.URLs) != 2 || len(svc.Tags) != 2 {
+			t.Errorf("got %d URLs and %d tags, want 2 and 2", len(svc.URLs), len(svc.Tags))
+		}
+		if len(svc.PublicKeys) != 1 || svc.PublicKeys[0].UID != "ABCDEF0123456789" || svc.PublicKeys[0].Value != key {
+			t.Errorf("public key didn't round trip: %+v", svc.PublicKeys)
+		}
+	})
+}
+
+func TestUniqueNames(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, db *gorm.DB) {
+		if err := db.Create(&models.Tag{Name: "forum"}).Error; err != nil {
+			t.Fatal(err)
+		}
+		if err := db.Create(&models.Tag{Name: "forum"}).Error; err == nil {
+			t.Error("created a second tag with the same name")
+		}
+		if err := db.Create(&models.URL{Name: "http://expyuzz4wqqyqhjn.onion"}).Error; err != nil {
+			t.Fatal(err)
+		}
+		if err := db.Create(&models.URL{Name: "http://expyuzz4wqqyqhjn.onion"}).Error; err == nil {
+			t.Error("created a second URL with the same address")
+		}
+	})
+}
+
+func TestApproveSubmissionIsAudited(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, db *gorm.DB) {
+		validations.RegisterCallbacks(db)
+		audit.RegisterCallbacks(db)
+
+		s := &submission.Submission{
+			Name: "Example Service",
+			URLs: "http://expyuzz4wqqyqhjn.onion",
+			Tags: "forum",
+		}
+		if err := audit.WithOrigin(db, audit.OriginSubmission).Create(s).Error; err != nil {
+			t.Fatal(err)
+		}
+		svc, err := s.Approve(audit.WithActor(db, "moderator"))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var events []audit.AuditEvent
+		if err := db.Where("resource = ? AND action = ?", "services", audit.ActionCreate).Find(&events).Error; err != nil {
+			t.Fatal(err)
+		}
+		if len(events) != 1 {
+			t.Fatalf("got %d service creation events, want 1", len(events))
+		}
+		if e := events[0]; e.Actor != "moderator" || e.Origin != audit.OriginSystem || e.ResourceID != fmt.Sprint(svc.ID) {
+			t.Errorf("unexpected event %+v", e)
+		}
+
+		var count int
+		db.Model(&audit.AuditEvent{}).Where("origin = ?", audit.OriginSubmission).Count(&count)
+		if count != 1 {
+			t.Errorf("got %d events from the submission form, want 1", count)
+		}
+	})
+}
@@ -0,0 +1,83 @@
+package exporter
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/goccy/go-yaml"
+	"github.com/jinzhu/gorm"
+	"github.com/onionltd/oniontree-tools/pkg/types/service"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/x0rzkov/oniontree-backend/pkg/models"
+)
+
+// Export writes the services of db to root in the layout of the oniontree
+// repository: every service is in unsorted/<slug>.yaml, linked from
+// tagged/<tag>/<slug>.yaml for each of its tags. Existing files are
+// overwritten.
+func Export(db *gorm.DB, root string) error {
+	var services []models.Service
+	if err := db.Preload("URLs").Preload("PublicKeys").Preload("Tags").Order("slug").Find(&services).Error; err != nil {
+		return err
+	}
+
+	unsorted := filepath.Join(root, "unsorted")
+	if err := os.MkdirAll(unsorted, 0755); err != nil {
+		return err
+	}
+	for _, m := range services {
+		if m.Slug == "" {
+			log.Warnf("exporter: skipping service %d without a slug", m.ID)
+			continue
+		}
+		name := m.Slug + ".yaml"
+		bytes, err := yaml.Marshal(toService(m))
+		if err != nil {
+			return fmt.Errorf("exporter: %s: %s", m.Slug, err)
+		}
+		if err := ioutil.WriteFile(filepath.Join(unsorted, name), bytes, 0644); err != nil {
+			return err
+		}
+
+		for _, tag := range m.Tags {
+			dir := filepath.Join(root, "tagged", tag.Name)
+			if err := os.MkdirAll(dir, 0755); err != nil {
+				return err
+			}
+			link := filepath.Join(dir, name)
+			if err := os.Remove(link); err != nil && !os.IsNotExist(err) {
+				return err
+			}
+			if err := os.Symlink(filepath.Join("..", "..", "unsorted", name), link); err != nil {
+				return err
+			}
+		}
+	}
+	log.Infof("exporter: exported %d services to %s", len(services), root)
+	return nil
+}
+
+// toService converts m to the format of the repository.
+func toService(m models.Service) service.Service {
+	s := service.Service{
+		Name:        m.Name,
+		Description: m.Description,
+		URLs:        []string{},
+	}
+	for _, url := range m.URLs {
+		s.URLs = append(s.URLs, url.Name)
+	}
+	for _, publicKey := range m.PublicKeys {
+		s.PublicKeys = append(s.PublicKeys, service.PublicKey{
+			ID:          publicKey.UID,
+			UserID:      publicKey.UserID,
+			Fingerprint: publicKey.Fingerprint,
+			Description: publicKey.Description,
+			Value:       publicKey.Value,
+		})
+	}
+	return s
+}
@@ -0,0 +1,138 @@
+package importer
+
+import (
+	"github.com/jinzhu/gorm"
+	"github.com/qor/admin"
+	"github.com/qor/qor"
+
+	"github.com/x0rzkov/oniontree-backend/pkg/models"
+
+	"github.com/x0rzkov/oniontree-backend/pkg/auth"
+)
+
+// ConfigureAdmin adds the read-only list of dataset imports to Admin, the
+// latest one first, so that everyone can tell which commit of the dataset
+// they are looking at, and the updates pulled from upstream.
+func ConfigureAdmin(Admin *admin.Admin) {
+	res := Admin.AddResource(&DatasetImport{}, &admin.Config{
+		Name:       "Dataset Import",
+		Permission: auth.ReadOnly(auth.RoleViewer),
+	})
+	res.IndexAttrs("ID", "CreatedAt", "Source", "Revision", "CommitHash", "CommittedAt", "Subject", "Services")
+	res.ShowAttrs("CreatedAt", "Source", "Revision", "CommitHash", "CommittedAt", "Author", "Subject", "Services")
+	res.Meta(&admin.Meta{Name: "Subject", Type: "text"})
+	res.Filter(&admin.Filter{Name: "CommitHash"})
+
+	configureUpdates(Admin)
+}
+
+// configureUpdates adds the updates pulled from upstream to Admin, where
+// maintainers review their changes and apply or dismiss them.
+func configureUpdates(Admin *admin.Admin) {
+	res := Admin.AddResource(&DatasetUpdate{}, &admin.Config{
+		Name:       "Dataset Update",
+		Permission: auth.ReadOnly(auth.RoleViewer),
+	})
+	res.IndexAttrs("ID", "CreatedAt", "CommitHash", "Subject", "Added", "Modified", "Deleted", "Status")
+	res.ShowAttrs("CreatedAt", "Source", "Revision", "BaseCommit", "CommitHash", "CommittedAt", "Author", "Subject", "Status", "ReviewedAt", "Changes")
+	res.Meta(&admin.Meta{Name: "Subject", Type: "text"})
+	res.Meta(&admin.Meta{
+		Name: "Changes",
+		Type: "dataset_changes",
+		Valuer: func(record interface{}, context *qor.Context) interface{} {
+			u, ok := record.(*DatasetUpdate)
+			if !ok {
+				return nil
+			}
+			changes, err := u.ChangeList()
+			if err != nil {
+				return nil
+			}
+			return changes
+		},
+	})
+
+	for _, status := range UpdateStatuses {
+		status := status
+		res.Scope(&admin.Scope{
+			Name:    status,
+			Group:   "Status",
+			Default: status == UpdatePending,
+			Handler: func(db *gorm.DB, context *qor.Context) *gorm.DB {
+				return db.Where("status = ?", status)
+			},
+		})
+	}
+
+	isPending := func(record interface{}, context *admin.Context) bool {
+		u, ok := record.(*DatasetUpdate)
+		return !ok || u.Status == UpdatePending
+	}
+
+	res.Action(&admin.Action{
+		Name:    "Apply",
+		Visible: isPending,
+		Handler: func(argument *admin.ActionArgument) error {
+			db := argument.Context.GetDB()
+			for _, record := range argument.FindSelectedRecords() {
+				if err := record.(*DatasetUpdate).Apply(db); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+		Modes:      []string{"show", "menu_item"},
+		Permission: auth.ActionPermission(auth.RoleMaintainer),
+	})
+
+	res.Action(&admin.Action{
+		Name:    "Dismiss",
+		Visible: isPending,
+		Handler: func(argument *admin.ActionArgument) error {
+			db := argument.Context.GetDB()
+			for _, record := range argument.FindSelectedRecords() {
+				if err := record.(*DatasetUpdate).Dismiss(db); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+		Modes:      []string{"show", "menu_item", "batch"},
+		Permission: auth.ActionPermission(auth.RoleMaintainer),
+	})
+}
+
+// ConfigureTimeline shows the revisions of a service, the latest first, on
+// its page of the services resource res, below the commit it was imported
+// from and its signer, which are read-only. Revisions are those of the files
+// the service was ever imported from, whatever its name was then.
+func ConfigureTimeline(res *admin.Resource) {
+	res.Meta(&admin.Meta{
+		Name: "Timeline",
+		Type: "timeline",
+		Valuer: func(record interface{}, context *qor.Context) interface{} {
+			svc, ok := record.(*models.Service)
+			if !ok || svc.Slug == "" {
+				return nil
+			}
+			db := context.GetDB()
+			files := db.Model(&ServiceRevision{}).Select("DISTINCT file").Where("slug = ?", svc.Slug).QueryExpr()
+			var revisions []ServiceRevision
+			if err := db.Where("file IN (?)", files).Order("committed_at DESC, id").Find(&revisions).Error; err != nil {
+				return nil
+			}
+			return revisions
+		},
+	})
+	res.Meta(&admin.Meta{Name: "CommitHash", Label: "Commit"})
+	res.IndexAttrs("-Timeline", "-CommitHash")
+	res.NewAttrs("-Timeline", "-CommitHash", "-Signer")
+
+	// The show page defaults to the edit one, it gets the import and the
+	// timeline at the bottom
+	var show []interface{}
+	for _, section := range res.EditAttrs("-Timeline", "-CommitHash", "-Signer") {
+		show = append(show, section)
+	}
+	res.ShowAttrs(append(show, "CommitHash", "Signer", "Timeline")...)
+}
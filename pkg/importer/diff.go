@@ -0,0 +1,338 @@
+package importer
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/goccy/go-yaml"
+	"github.com/gosimple/slug"
+	"github.com/jinzhu/gorm"
+	"github.com/onionltd/oniontree-tools/pkg/types/service"
+	"github.com/sergi/go-diff/diffmatchpatch"
+	"gopkg.in/src-d/go-git.v4/utils/diff"
+
+	"github.com/x0rzkov/oniontree-backend/pkg/models"
+)
+
+// Entry is a service of the dataset along with its tags.
+type Entry struct {
+	service.Service `yaml:",inline"`
+	Tags            []string `json:"tags" yaml:"tags"`
+	// Commit is the commit the entry comes from and Signer who signed it,
+	// when signatures are verified.
+	Commit string `json:"commit,omitempty" yaml:"-"`
+	Signer string `json:"signer,omitempty" yaml:"-"`
+}
+
+// YAML renders e in the format of the repository, followed by its tags.
+func (e *Entry) YAML() string {
+	if e == nil {
+		return ""
+	}
+	out, err := yaml.Marshal(e)
+	if err != nil {
+		return err.Error()
+	}
+	return string(out)
+}
+
+// normalize sorts the URLs, public keys and tags of e, whose order the
+// database doesn't keep.
+func (e *Entry) normalize() {
+	sort.Strings(e.URLs)
+	sort.Strings(e.Tags)
+	sort.Slice(e.PublicKeys, func(i, j int) bool {
+		return e.PublicKeys[i].Fingerprint+e.PublicKeys[i].ID < e.PublicKeys[j].Fingerprint+e.PublicKeys[j].ID
+	})
+}
+
+// Snapshot is the dataset at some point, by slug.
+type Snapshot map[string]*Entry
+
+func (s Snapshot) add(svc service.Service, tag, commit, signer string) {
+	key := slug.Make(svc.Name)
+	e, ok := s[key]
+	if !ok {
+		e = &Entry{Service: svc, Commit: commit, Signer: signer}
+		s[key] = e
+	}
+	for _, t := range e.Tags {
+		if t == tag {
+			return
+		}
+	}
+	e.Tags = append(e.Tags, tag)
+}
+
+// ReadSnapshot returns the services of rev, as Git would import them.
+func ReadSnapshot(rev *Revision) (Snapshot, error) {
+	s := Snapshot{}
+	err := rev.services(false, func(svc service.Service, tag, commit, signer string) error {
+		s.add(svc, tag, commit, signer)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	for _, e := range s {
+		e.normalize()
+	}
+	return s, nil
+}
+
+// DBSnapshot returns the services of db, which may be scoped by a
+// condition.
+func DBSnapshot(db *gorm.DB) (Snapshot, error) {
+	var services []models.Service
+	if err := db.Preload("URLs").Preload("PublicKeys").Preload("Tags").Order("id").Find(&services).Error; err != nil {
+		return nil, err
+	}
+	s := Snapshot{}
+	for _, m := range services {
+		e, ok := s[m.Slug]
+		if !ok {
+			e = &Entry{
+				Service: service.Service{Name: m.Name, Description: m.Description, URLs: []string{}},
+				Commit:  m.CommitHash,
+				Signer:  m.Signer,
+			}
+			s[m.Slug] = e
+		}
+		// services tagged more than once may have been imported as
+		// several rows
+		for _, url := range m.URLs {
+			e.AddURLs(url.Name)
+		}
+		for _, key := range m.PublicKeys {
+			e.AddPublicKeys(service.PublicKey{
+				ID:          key.UID,
+				UserID:      key.UserID,
+				Fingerprint: key.Fingerprint,
+				Description: key.Description,
+				Value:       key.Value,
+			})
+		}
+		for _, tag := range m.Tags {
+			e.Tags = append(e.Tags, tag.Name)
+		}
+	}
+	for _, e := range s {
+		e.Tags = unique(e.Tags)
+		e.normalize()
+	}
+	return s, nil
+}
+
+func unique(names []string) []string {
+	seen := map[string]bool{}
+	var out []string
+	for _, name := range names {
+		if !seen[name] {
+			seen[name] = true
+			out = append(out, name)
+		}
+	}
+	return out
+}
+
+// Change is a service added, modified or deleted between two snapshots.
+type Change struct {
+	Action string `json:"action"`
+	Slug   string `json:"slug"`
+	// Before is nil for an added service, After for a deleted one.
+	Before *Entry `json:"before,omitempty"`
+	After  *Entry `json:"after,omitempty"`
+}
+
+// Name is the name of the service, its new one if it changed.
+func (c Change) Name() string {
+	if c.After != nil {
+		return c.After.Name
+	}
+	return c.Before.Name
+}
+
+// Diff returns the changed lines of the service, prefixed with - or +,
+// between unchanged ones prefixed with a space.
+func (c Change) Diff() string {
+	var b strings.Builder
+	for _, d := range diff.Do(c.Before.YAML(), c.After.YAML()) {
+		prefix := " "
+		switch d.Type {
+		case diffmatchpatch.DiffDelete:
+			prefix = "-"
+		case diffmatchpatch.DiffInsert:
+			prefix = "+"
+		}
+		for _, line := range strings.SplitAfter(d.Text, "\n") {
+			if line != "" {
+				b.WriteString(prefix + line)
+			}
+		}
+	}
+	return b.String()
+}
+
+// Compare returns the changes from before to after, by slug.
+func Compare(before, after Snapshot) []Change {
+	var changes []Change
+	for key, b := range before {
+		a, ok := after[key]
+		switch {
+		case !ok:
+			changes = append(changes, Change{Action: ActionDeleted, Slug: key, Before: b})
+		case a.YAML() != b.YAML():
+			changes = append(changes, Change{Action: ActionModified, Slug: key, Before: b, After: a})
+		}
+	}
+	for key, a := range after {
+		if _, ok := before[key]; !ok {
+			changes = append(changes, Change{Action: ActionAdded, Slug: key, After: a})
+		}
+	}
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Slug < changes[j].Slug })
+	return changes
+}
+
+// Apply makes changes to the database.
+func (i *Importer) Apply(changes []Change) error {
+	for _, c := range changes {
+		var err error
+		switch c.Action {
+		case ActionAdded:
+			err = i.addEntry(c.After)
+		case ActionModified:
+			err = i.updateEntry(c.Slug, c.After)
+		case ActionDeleted:
+			err = i.deleteEntry(c.Slug)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (i *Importer) addEntry(e *Entry) error {
+	for _, tag := range e.Tags {
+		if err := i.importService(e.Service, tag, e.Commit, e.Signer); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// updateEntry updates the services of slug to e, its URLs, public keys and
+// tags included. Services tagged more than once may have been imported as
+// several rows, which are collapsed into the first one.
+func (i *Importer) updateEntry(key string, e *Entry) error {
+	db := i.DB
+	var services []models.Service
+	if err := db.Where("slug = ?", key).Order("id").Find(&services).Error; err != nil {
+		return err
+	}
+	if len(services) == 0 {
+		return i.addEntry(e)
+	}
+	m := services[0]
+	m.Name, m.Description, m.CommitHash, m.Signer = e.Name, e.Description, e.Commit, e.Signer
+	if err := db.Save(&m).Error; err != nil {
+		return err
+	}
+	ids := []uint{}
+	for _, s := range services {
+		ids = append(ids, s.ID)
+	}
+
+	var tags []*models.Tag
+	for _, name := range e.Tags {
+		tag := &models.Tag{}
+		if err := db.Where(models.Tag{Name: name}).FirstOrCreate(tag).Error; err != nil {
+			return err
+		}
+		tags = append(tags, tag)
+	}
+	if err := db.Model(&m).Association("Tags").Replace(tags).Error; err != nil {
+		return err
+	}
+
+	// URLs are unique, a URL may move from another service
+	var urls []models.URL
+	if err := db.Where("service_id IN (?)", ids).Find(&urls).Error; err != nil {
+		return err
+	}
+	for _, url := range urls {
+		if !contains(e.URLs, url.Name) {
+			if err := db.Unscoped().Delete(&url).Error; err != nil {
+				return err
+			}
+		}
+	}
+	for _, name := range e.URLs {
+		url := &models.URL{}
+		if err := db.Where(models.URL{Name: name}).FirstOrCreate(url).Error; err != nil {
+			return err
+		}
+		if url.ServiceID != m.ID {
+			if err := db.Model(url).Update("service_id", m.ID).Error; err != nil {
+				return err
+			}
+		}
+	}
+
+	var keys []models.PublicKey
+	if err := db.Where("service_id IN (?)", ids).Find(&keys).Error; err != nil {
+		return err
+	}
+	for _, key := range keys {
+		if err := db.Unscoped().Delete(&key).Error; err != nil {
+			return err
+		}
+	}
+	for _, key := range e.PublicKeys {
+		pk := &models.PublicKey{
+			UID:         key.ID,
+			UserID:      key.UserID,
+			Fingerprint: key.Fingerprint,
+			Description: key.Description,
+			Value:       key.Value,
+			ServiceID:   m.ID,
+		}
+		if err := db.Create(pk).Error; err != nil {
+			return err
+		}
+	}
+
+	for _, dup := range services[1:] {
+		if err := db.Model(&dup).Association("Tags").Clear().Error; err != nil {
+			return err
+		}
+		if err := db.Delete(&dup).Error; err != nil {
+			return err
+		}
+	}
+	i.imported++
+	return nil
+}
+
+func (i *Importer) deleteEntry(key string) error {
+	var services []models.Service
+	if err := i.DB.Where("slug = ?", key).Find(&services).Error; err != nil {
+		return err
+	}
+	for _, m := range services {
+		if err := i.DB.Delete(&m).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func contains(names []string, name string) bool {
+	for _, n := range names {
+		if n == name {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,124 @@
+package importer
+
+import (
+	"testing"
+
+	"github.com/jinzhu/gorm"
+	_ "github.com/jinzhu/gorm/dialects/sqlite"
+	"github.com/onionltd/oniontree-tools/pkg/types/service"
+
+	"github.com/x0rzkov/oniontree-backend/pkg/models"
+)
+
+// openDB returns an in-memory database with the schema of the dataset and
+// of the imports.
+func openDB(t *testing.T) *gorm.DB {
+	db, err := gorm.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.DB().SetMaxOpenConns(1)
+	if err := db.AutoMigrate(append(append([]interface{}{}, models.Tables...), Tables...)...).Error; err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+func entry(name, description string, tags ...string) *Entry {
+	e := &Entry{
+		Service: service.Service{Name: name, Description: description, URLs: []string{"http://" + name + ".onion"}},
+		Tags:    tags,
+	}
+	e.normalize()
+	return e
+}
+
+// checkSnapshot fails unless the services of db are expected, each in a
+// single row.
+func checkSnapshot(t *testing.T, db *gorm.DB, expected Snapshot) {
+	t.Helper()
+	s, err := DBSnapshot(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if changes := Compare(s, expected); len(changes) > 0 {
+		for _, c := range changes {
+			t.Errorf("%s %s:\n%s", c.Action, c.Slug, c.Diff())
+		}
+	}
+	var rows int
+	if err := db.Model(&models.Service{}).Count(&rows).Error; err != nil {
+		t.Fatal(err)
+	}
+	if rows != len(expected) {
+		t.Errorf("%d services in the database, expected %d", rows, len(expected))
+	}
+}
+
+func TestCompare(t *testing.T) {
+	before := Snapshot{
+		"a": entry("a", "", "market"),
+		"b": entry("b", "", "forum"),
+		"c": entry("c", "", "forum"),
+	}
+	after := Snapshot{
+		"a": entry("a", "", "forum", "market"),
+		"b": entry("b", "", "forum"),
+		"d": entry("d", "", "market"),
+	}
+	changes := Compare(before, after)
+	expected := []Change{
+		{Action: ActionModified, Slug: "a", Before: before["a"], After: after["a"]},
+		{Action: ActionDeleted, Slug: "c", Before: before["c"]},
+		{Action: ActionAdded, Slug: "d", After: after["d"]},
+	}
+	if len(changes) != len(expected) {
+		t.Fatalf("Compare = %v, expected %v", changes, expected)
+	}
+	for i, c := range changes {
+		if c != expected[i] {
+			t.Errorf("change %d = %+v, expected %+v", i, c, expected[i])
+		}
+	}
+	if diff := changes[0].Diff(); diff != " name: a\n urls:\n - http://a.onion\n tags:\n+- forum\n - market\n" {
+		t.Errorf("Diff = %q", diff)
+	}
+	if changes := Compare(after, after); len(changes) > 0 {
+		t.Errorf("Compare of identical snapshots = %v", changes)
+	}
+}
+
+func TestApply(t *testing.T) {
+	db := openDB(t)
+	defer db.Close()
+
+	// a service in two tags, imported as several rows
+	r := newTestRepo(t, "")
+	r.Write("unsorted/a.yaml", "name: a\nurls:\n- http://a.onion\n").
+		Write("unsorted/b.yaml", "name: b\nurls:\n- http://b.onion\n").
+		Write("unsorted/c.yaml", "name: c\nurls:\n- http://c.onion\n").
+		Link("tagged/market/a.yaml", "../../unsorted/a.yaml").
+		Link("tagged/forum/a.yaml", "../../unsorted/a.yaml").
+		Link("tagged/forum/b.yaml", "../../unsorted/b.yaml").
+		Link("tagged/forum/c.yaml", "../../unsorted/c.yaml")
+	if err := New(db).Git(r.Revision(r.Commit("import", nil))); err != nil {
+		t.Fatal(err)
+	}
+
+	before, err := DBSnapshot(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a := entry("a", "renamed", "forum")
+	a.SetURLs("http://a2.onion")
+	after := Snapshot{"a": a, "b": before["b"], "d": entry("d", "", "market")}
+	if err := New(db).Apply(Compare(before, after)); err != nil {
+		t.Fatal(err)
+	}
+	checkSnapshot(t, db, after)
+
+	var url models.URL
+	if !db.Unscoped().Where("name = ?", "http://a.onion").First(&url).RecordNotFound() {
+		t.Error("the URL removed from a is still in the database")
+	}
+}
@@ -0,0 +1,193 @@
+package importer
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/goccy/go-yaml"
+	"github.com/k0kubun/pp"
+	"github.com/onionltd/oniontree-tools/pkg/types/service"
+	log "github.com/sirupsen/logrus"
+	"gopkg.in/src-d/go-git.v4"
+	"gopkg.in/src-d/go-git.v4/plumbing/filemode"
+	"gopkg.in/src-d/go-git.v4/plumbing/object"
+)
+
+// Git imports the services of rev and records the import. If rev was
+// verified, files get their content as of their last change by a trusted
+// commit.
+func (i *Importer) Git(rev *Revision) error {
+	err := rev.services(i.Trace, func(svc service.Service, tag, commit, signer string) error {
+		return i.importService(svc, tag, commit, signer)
+	})
+	if err != nil && err != errTraced {
+		return err
+	}
+	return i.record(rev.Source.URL, rev.Source.Revision, rev.Commit)
+}
+
+// errTraced stops a traced walk after the hundredth file.
+var errTraced = errors.New("importer: stopping after 100 files")
+
+// services calls fn with every service of rev, the tag it is in, the commit
+// it comes from and its signer. trace dumps every file read and stops the
+// walk after the hundredth with errTraced. If rev was verified, the entries
+// of tagged/ and the files they link to are as of their last trusted change.
+func (rev *Revision) services(trace bool, fn func(svc service.Service, tag, commit, signer string) error) error {
+	tree, err := rev.Repository.TreeObject(rev.Commit.TreeHash)
+	if err != nil {
+		return err
+	}
+	var entries []string
+	if rev.Verifier != nil {
+		entries = rev.verifiedEntries()
+	} else if entries, err = taggedEntries(rev.Repository, tree); err != nil {
+		return err
+	}
+
+	for i, name := range entries {
+		// services are in /tagged/<tag>/
+		tag := strings.Split(name, "/")[2]
+		if trace {
+			fmt.Printf("Name:%s Path:%s Tag:%s\n", path.Base(name), path.Dir(name), tag)
+			if i == 100 {
+				log.Info(errTraced)
+				return errTraced
+			}
+		}
+
+		// tagged entries are links to unsorted/, the tag is where the
+		// link is
+		content, hash, signer := []byte(nil), rev.Commit.Hash.String(), ""
+		if rev.Verifier != nil {
+			f, _, err := rev.readVerified(name)
+			if err != nil {
+				return err
+			}
+			if f == nil {
+				log.Warnf("importer: skipping %s: no trusted commit added it", name)
+				continue
+			}
+			content, hash, signer = f.Content, f.Commit, f.Signature.Signer
+		} else if content, _, err = readFile(tree, name); err != nil {
+			return err
+		}
+		if trace {
+			pp.Println("===============================================================\n", string(content))
+		}
+
+		svc := service.Service{}
+		if err := yaml.Unmarshal(content, &svc); err != nil {
+			log.Warnf("importer: skipping %s: %s", name, err)
+			continue
+		}
+		if err := fn(svc, tag, hash, signer); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// taggedEntries returns the paths of the files of tree under /tagged/<tag>/,
+// rooted at "/", breadth first.
+func taggedEntries(r *git.Repository, tree *object.Tree) ([]string, error) {
+	type treePath struct {
+		*object.Tree
+		Path string
+	}
+
+	var entries []string
+	for frontier := []treePath{{Tree: tree, Path: "/"}}; len(frontier) > 0; frontier = frontier[1:] {
+		t := frontier[0]
+
+		for _, e := range t.Entries {
+			if e.Mode != filemode.Dir {
+				// We only care about directories.
+				continue
+			}
+			if strings.HasPrefix(e.Name, ".") || strings.HasPrefix(e.Name, "_") || e.Name == "testdata" {
+				continue
+			}
+			tree, err := r.TreeObject(e.Hash)
+			if err != nil {
+				return nil, err
+			}
+			frontier = append(frontier, treePath{
+				Tree: tree,
+				Path: path.Join(t.Path, e.Name),
+			})
+		}
+
+		parts := strings.Split(t.Path, "/")
+		if len(parts) <= 2 || parts[1] != "tagged" {
+			continue
+		}
+		for _, e := range t.Entries {
+			if e.Mode != filemode.Dir {
+				entries = append(entries, path.Join(t.Path, e.Name))
+			}
+		}
+	}
+	return entries, nil
+}
+
+// verifiedEntries returns the paths of the entries of tagged/ of the
+// verified revision rev which a trusted commit added, rooted at "/", sorted.
+func (rev *Revision) verifiedEntries() []string {
+	var entries []string
+	for name, f := range rev.verified {
+		if strings.HasPrefix(name, "tagged/") && f.Content != nil {
+			entries = append(entries, "/"+name)
+		}
+	}
+	sort.Strings(entries)
+	return entries
+}
+
+// maxSymlinks is how many symlinks readFile follows, like Linux does.
+const maxSymlinks = 40
+
+// readFile returns the content and the path of the file at name in tree,
+// rooted at "/". Symlinks are followed, relative to the directory of the
+// link, within tree.
+func readFile(tree *object.Tree, name string) ([]byte, string, error) {
+	var content []byte
+	name, err := followLinks(name, func(name string) ([]byte, bool, error) {
+		f, err := tree.File(strings.TrimPrefix(name, "/"))
+		if err != nil {
+			return nil, false, fmt.Errorf("importer: %s: %s", name, err)
+		}
+		contents, err := f.Contents()
+		if err != nil {
+			return nil, false, err
+		}
+		content = []byte(contents)
+		return content, f.Mode == filemode.Symlink, nil
+	})
+	if err != nil {
+		return nil, "", err
+	}
+	return content, name, nil
+}
+
+// followLinks returns the path of the file at name, rooted at "/", once
+// the symlinks open reports are followed, relative to the directory of the
+// link. Links must stay within the repository.
+func followLinks(name string, open func(name string) (content []byte, symlink bool, err error)) (string, error) {
+	for hops := 0; hops <= maxSymlinks; hops++ {
+		content, symlink, err := open(name)
+		if err != nil || !symlink {
+			return name, err
+		}
+		target := strings.TrimSpace(string(content))
+		dir := path.Dir(name)
+		if rel := path.Join(strings.TrimPrefix(dir, "/"), target); path.IsAbs(target) || rel == ".." || strings.HasPrefix(rel, "../") {
+			return "", fmt.Errorf("importer: %s links outside of the repository to %s", name, target)
+		}
+		name = path.Join(dir, target)
+	}
+	return "", fmt.Errorf("importer: %s: too many levels of symbolic links", name)
+}
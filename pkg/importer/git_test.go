@@ -0,0 +1,187 @@
+package importer
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/onionltd/oniontree-tools/pkg/types/service"
+	"golang.org/x/crypto/openpgp"
+	"gopkg.in/src-d/go-billy.v4"
+	"gopkg.in/src-d/go-billy.v4/memfs"
+	"gopkg.in/src-d/go-git.v4"
+	"gopkg.in/src-d/go-git.v4/plumbing/object"
+	"gopkg.in/src-d/go-git.v4/storage/memory"
+)
+
+// testRepo is an in-memory repository of the dataset.
+type testRepo struct {
+	t          *testing.T
+	Repository *git.Repository
+	worktree   *git.Worktree
+	fs         billy.Filesystem
+}
+
+// newTestRepo returns a new repository checked out at dir, in memory if
+// dir is empty.
+func newTestRepo(t *testing.T, dir string) *testRepo {
+	var (
+		r   *git.Repository
+		err error
+	)
+	if dir == "" {
+		r, err = git.Init(memory.NewStorage(), memfs.New())
+	} else {
+		r, err = git.PlainInit(dir, false)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	w, err := r.Worktree()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &testRepo{t: t, Repository: r, worktree: w, fs: w.Filesystem}
+}
+
+// Write sets the content of the file name.
+func (r *testRepo) Write(name, content string) *testRepo {
+	f, err := r.fs.Create(name)
+	if err != nil {
+		r.t.Fatal(err)
+	}
+	if _, err := f.Write([]byte(content)); err != nil {
+		r.t.Fatal(err)
+	}
+	if err := f.Close(); err != nil {
+		r.t.Fatal(err)
+	}
+	return r
+}
+
+// Link makes name a symbolic link to target.
+func (r *testRepo) Link(name, target string) *testRepo {
+	r.fs.Remove(name)
+	if err := r.fs.Symlink(target, name); err != nil {
+		r.t.Fatal(err)
+	}
+	return r
+}
+
+// Remove deletes the file name.
+func (r *testRepo) Remove(name string) *testRepo {
+	if err := r.fs.Remove(name); err != nil {
+		r.t.Fatal(err)
+	}
+	return r
+}
+
+// Commit commits every change of the worktree, signed by key unless nil.
+func (r *testRepo) Commit(message string, key *openpgp.Entity) *object.Commit {
+	if err := r.worktree.AddGlob("."); err != nil {
+		r.t.Fatal(err)
+	}
+	// deletions aren't staged by AddGlob
+	status, err := r.worktree.Status()
+	if err != nil {
+		r.t.Fatal(err)
+	}
+	for name, s := range status {
+		if s.Worktree == git.Deleted {
+			if _, err := r.worktree.Remove(name); err != nil {
+				r.t.Fatal(err)
+			}
+		}
+	}
+	hash, err := r.worktree.Commit(message, &git.CommitOptions{
+		Author:  &object.Signature{Name: "test", Email: "test@example.org", When: time.Now()},
+		SignKey: key,
+	})
+	if err != nil {
+		r.t.Fatal(err)
+	}
+	c, err := r.Repository.CommitObject(hash)
+	if err != nil {
+		r.t.Fatal(err)
+	}
+	return c
+}
+
+// Revision returns the revision of commit c.
+func (r *testRepo) Revision(c *object.Commit) *Revision {
+	return &Revision{Source: &Source{URL: "test"}, Repository: r.Repository, Commit: c}
+}
+
+// serviceTags returns the tags of every service of rev, by name.
+func serviceTags(t *testing.T, rev *Revision) map[string][]string {
+	tags := map[string][]string{}
+	err := rev.services(false, func(svc service.Service, tag, commit, signer string) error {
+		tags[svc.Name] = append(tags[svc.Name], tag)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tags
+}
+
+func TestReadFile(t *testing.T) {
+	r := newTestRepo(t, "")
+	r.Write("unsorted/a.yaml", "name: a\n").
+		Link("tagged/market/a.yaml", "../../unsorted/a.yaml").
+		Link("tagged/forum/a.yaml", "../market/a.yaml").
+		Link("tagged/absolute/a.yaml", "/unsorted/a.yaml").
+		Link("tagged/escaping/a.yaml", "../../../unsorted/a.yaml").
+		Link("tagged/dangling/a.yaml", "../../unsorted/missing.yaml").
+		Link("tagged/loop/a.yaml", "b.yaml").
+		Link("tagged/loop/b.yaml", "a.yaml")
+	tree, err := r.Commit("links", nil).Tree()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, c := range []struct {
+		name, content, path string
+	}{
+		{"/unsorted/a.yaml", "name: a\n", "/unsorted/a.yaml"},
+		{"/tagged/market/a.yaml", "name: a\n", "/unsorted/a.yaml"},
+		{"/tagged/forum/a.yaml", "name: a\n", "/unsorted/a.yaml"},
+		{"/tagged/absolute/a.yaml", "", ""},
+		{"/tagged/escaping/a.yaml", "", ""},
+		{"/tagged/dangling/a.yaml", "", ""},
+		{"/tagged/loop/a.yaml", "", ""},
+	} {
+		content, path, err := readFile(tree, c.name)
+		if c.path == "" {
+			if err == nil {
+				t.Errorf("readFile(%s) = %s: expected an error", c.name, path)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("readFile(%s): %s", c.name, err)
+		} else if string(content) != c.content || path != c.path {
+			t.Errorf("readFile(%s) = %q from %s, expected %q from %s", c.name, content, path, c.content, c.path)
+		}
+	}
+}
+
+func TestFollowLinksLimit(t *testing.T) {
+	// a chain of maxSymlinks links is followed, one more isn't
+	chain := func(links int) func(string) ([]byte, bool, error) {
+		return func(name string) ([]byte, bool, error) {
+			var hop int
+			fmt.Sscanf(name, "/%d", &hop)
+			if hop == links {
+				return []byte("name: a\n"), false, nil
+			}
+			return []byte(fmt.Sprint(hop + 1)), true, nil
+		}
+	}
+	if name, err := followLinks("/0", chain(maxSymlinks)); err != nil || name != fmt.Sprintf("/%d", maxSymlinks) {
+		t.Errorf("following %d links = %s, %v", maxSymlinks, name, err)
+	}
+	if _, err := followLinks("/0", chain(maxSymlinks+1)); err == nil {
+		t.Errorf("following %d links: expected an error", maxSymlinks+1)
+	}
+}
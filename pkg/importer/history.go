@@ -0,0 +1,178 @@
+package importer
+
+import (
+	"path"
+	"strings"
+	"time"
+
+	"github.com/goccy/go-yaml"
+	"github.com/gosimple/slug"
+	"github.com/onionltd/oniontree-tools/pkg/types/service"
+	log "github.com/sirupsen/logrus"
+	"gopkg.in/src-d/go-git.v4"
+	"gopkg.in/src-d/go-git.v4/plumbing/object"
+	"gopkg.in/src-d/go-git.v4/utils/merkletrie"
+)
+
+// Actions of a revision on the file of a service.
+const (
+	ActionAdded    = "added"
+	ActionModified = "modified"
+	ActionDeleted  = "deleted"
+)
+
+// Signature statuses of the commit of a revision, when signatures aren't
+// verified.
+const (
+	SignatureNone = "unsigned"
+	// SignaturePresent is a signature which wasn't verified.
+	SignaturePresent = "signed"
+)
+
+// ServiceRevision is a change of the file of a service in a commit of the
+// upstream repository. Files are unsorted/<file>.yaml, services are matched
+// by the slug of their name at the time of the commit.
+type ServiceRevision struct {
+	ID          uint   `gorm:"primary_key"`
+	CommitHash  string `gorm:"size:40;unique_index:idx_service_revisions_commit_path"`
+	Path        string `gorm:"size:255;unique_index:idx_service_revisions_commit_path"`
+	File        string `gorm:"size:255;index"`
+	Slug        string `gorm:"size:255;index"`
+	Action      string `gorm:"size:16"`
+	Author      string
+	AuthorEmail string
+	CommittedAt time.Time `gorm:"index"`
+	Subject     string    `gorm:"type:text"`
+	Signature   string    `gorm:"size:16"`
+	Signer      string
+	Diff        string `gorm:"type:text"`
+}
+
+// History walks the commit log of rev and stores a ServiceRevision for
+// every change of the file of a service, each commit being compared to its
+// first parent. Changes stored by a previous walk are skipped, so that the
+// timeline can be brought up to date. The history of a shallow clone stops
+// at its oldest commit.
+func (i *Importer) History(rev *Revision) error {
+	known := map[string]bool{}
+	rows, err := i.DB.Model(&ServiceRevision{}).Select("commit_hash, path").Rows()
+	if err != nil {
+		return err
+	}
+	for rows.Next() {
+		var hash, name string
+		if err := rows.Scan(&hash, &name); err != nil {
+			rows.Close()
+			return err
+		}
+		known[hash+":"+name] = true
+	}
+	rows.Close()
+
+	commits, err := rev.Repository.Log(&git.LogOptions{From: rev.Commit.Hash})
+	if err != nil {
+		return err
+	}
+	added := 0
+	err = commits.ForEach(func(c *object.Commit) error {
+		revisions, err := i.revisions(c, rev.Verifier, known)
+		if err != nil {
+			return err
+		}
+		for _, r := range revisions {
+			if err := i.DB.Create(r).Error; err != nil {
+				return err
+			}
+			added++
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	log.Infof("importer: added %d service revisions from %s", added, rev.Source.URL)
+	return nil
+}
+
+// revisions returns the changes of service files made by c which aren't
+// known yet, along with the signature of c if v isn't nil.
+func (i *Importer) revisions(c *object.Commit, v *Verifier, known map[string]bool) ([]*ServiceRevision, error) {
+	tree, err := c.Tree()
+	if err != nil {
+		return nil, err
+	}
+	var parent *object.Tree
+	if c.NumParents() > 0 {
+		p, err := c.Parent(0)
+		if err != nil {
+			return nil, err
+		}
+		if parent, err = p.Tree(); err != nil {
+			return nil, err
+		}
+	}
+	changes, err := object.DiffTree(parent, tree)
+	if err != nil {
+		return nil, err
+	}
+
+	var revisions []*ServiceRevision
+	for _, change := range changes {
+		name := change.To.Name
+		if name == "" {
+			name = change.From.Name
+		}
+		if path.Dir(name) != "unsorted" || path.Ext(name) != ".yaml" || known[c.Hash.String()+":"+name] {
+			continue
+		}
+
+		action, err := change.Action()
+		if err != nil {
+			return nil, err
+		}
+		from, to, err := change.Files()
+		if err != nil {
+			return nil, err
+		}
+		patch, err := change.Patch()
+		if err != nil {
+			return nil, err
+		}
+
+		r := &ServiceRevision{
+			CommitHash:  c.Hash.String(),
+			Path:        name,
+			File:        strings.TrimSuffix(path.Base(name), ".yaml"),
+			Author:      c.Author.Name,
+			AuthorEmail: c.Author.Email,
+			CommittedAt: c.Author.When,
+			Subject:     strings.SplitN(strings.TrimSpace(c.Message), "\n", 2)[0],
+			Signature:   SignatureNone,
+			Diff:        patch.String(),
+		}
+		switch {
+		case v != nil:
+			sig := v.Check(c)
+			r.Signature, r.Signer = sig.Status, sig.Signer
+		case c.PGPSignature != "":
+			r.Signature = SignaturePresent
+		}
+		switch action {
+		case merkletrie.Insert:
+			r.Action = ActionAdded
+		case merkletrie.Delete:
+			r.Action = ActionDeleted
+			to = from
+		default:
+			r.Action = ActionModified
+		}
+		if content, err := to.Contents(); err == nil {
+			s := service.Service{}
+			if yaml.Unmarshal([]byte(content), &s) == nil {
+				r.Slug = slug.Make(s.Name)
+			}
+		}
+		revisions = append(revisions, r)
+	}
+	return revisions, nil
+}
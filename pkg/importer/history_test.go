@@ -0,0 +1,147 @@
+package importer
+
+import (
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/jinzhu/gorm"
+	"golang.org/x/crypto/openpgp"
+	"gopkg.in/src-d/go-git.v4/plumbing/object"
+)
+
+// historyRepo returns a repository whose commits add, change, rename and
+// delete the files of services, signed by trusted and untrusted keys, along
+// with its commits.
+func historyRepo(t *testing.T, trusted, untrusted *openpgp.Entity) (*testRepo, []*object.Commit) {
+	r := newTestRepo(t, "")
+	r.Write("unsorted/a.yaml", "name: A Market\nurls:\n- http://a.onion\n").
+		Write("unsorted/b.yaml", "name: B Forum\nurls:\n- http://b.onion\n").
+		Link("tagged/market/a.yaml", "../../unsorted/a.yaml").
+		Write("README.md", "OnionTree\n")
+	add := r.Commit("add a and b\n\nThe first services.", trusted)
+	r.Write("unsorted/a.yaml", "name: A Market\ndescription: edited\nurls:\n- http://a.onion\n").
+		Write("README.md", "OnionTree, edited\n")
+	edit := r.Commit("edit a", nil)
+	// a rename is recorded as the deletion of one file and the addition of another
+	r.Remove("unsorted/b.yaml").
+		Write("unsorted/b-forum.yaml", "name: B Forum\nurls:\n- http://b.onion\n")
+	rename := r.Commit("rename b", untrusted)
+	r.Remove("tagged/market/a.yaml").Remove("unsorted/a.yaml")
+	del := r.Commit("delete a", nil)
+	return r, []*object.Commit{add, edit, rename, del}
+}
+
+// loadRevisions returns the stored revisions in the order of commits, the
+// commits of a test share their date.
+func loadRevisions(t *testing.T, db *gorm.DB, commits ...*object.Commit) []ServiceRevision {
+	order := map[string]int{}
+	for i, c := range commits {
+		order[c.Hash.String()] = i
+	}
+	var revisions []ServiceRevision
+	if err := db.Order("path").Find(&revisions).Error; err != nil {
+		t.Fatal(err)
+	}
+	sort.SliceStable(revisions, func(i, j int) bool {
+		return order[revisions[i].CommitHash] < order[revisions[j].CommitHash]
+	})
+	return revisions
+}
+
+func TestHistory(t *testing.T) {
+	db := openDB(t)
+	defer db.Close()
+	r, commits := historyRepo(t, newKey(t, "trusted"), newKey(t, "untrusted"))
+
+	if err := New(db).History(r.Revision(commits[3])); err != nil {
+		t.Fatal(err)
+	}
+	expected := []struct {
+		commit                   *object.Commit
+		path, slug, action, sign string
+		diff                     []string
+	}{
+		{commits[0], "unsorted/a.yaml", "a-market", ActionAdded, SignaturePresent, []string{"+name: A Market"}},
+		{commits[0], "unsorted/b.yaml", "b-forum", ActionAdded, SignaturePresent, []string{"+name: B Forum"}},
+		{commits[1], "unsorted/a.yaml", "a-market", ActionModified, SignatureNone, []string{"+description: edited", " name: A Market"}},
+		{commits[2], "unsorted/b-forum.yaml", "b-forum", ActionAdded, SignaturePresent, []string{"+name: B Forum"}},
+		{commits[2], "unsorted/b.yaml", "b-forum", ActionDeleted, SignaturePresent, []string{"-name: B Forum"}},
+		{commits[3], "unsorted/a.yaml", "a-market", ActionDeleted, SignatureNone, []string{"-description: edited"}},
+	}
+	revisions := loadRevisions(t, db, commits...)
+	if len(revisions) != len(expected) {
+		t.Fatalf("%d revisions, want %d: %+v", len(revisions), len(expected), revisions)
+	}
+	for i, e := range expected {
+		r := revisions[i]
+		if r.CommitHash != e.commit.Hash.String() || r.Path != e.path || r.Slug != e.slug || r.Action != e.action || r.Signature != e.sign || r.Signer != "" {
+			t.Errorf("revision %d = %s %s %s of %s signed %q, want %s %s %s of %s signed %q",
+				i, r.Action, r.Path, r.Slug, r.CommitHash, r.Signature, e.action, e.path, e.slug, e.commit.Hash, e.sign)
+		}
+		if r.File != strings.TrimSuffix(strings.TrimPrefix(e.path, "unsorted/"), ".yaml") {
+			t.Errorf("revision %d of %s is of the file %q", i, e.path, r.File)
+		}
+		subject := strings.SplitN(e.commit.Message, "\n", 2)[0]
+		if r.Author != "test" || r.AuthorEmail != "test@example.org" || !r.CommittedAt.Equal(e.commit.Author.When) || r.Subject != subject {
+			t.Errorf("revision %d by %s <%s> at %s: %q, want the author, date and subject of %s",
+				i, r.Author, r.AuthorEmail, r.CommittedAt, r.Subject, e.commit.Hash)
+		}
+		for _, line := range e.diff {
+			if !strings.Contains(r.Diff, "\n"+line+"\n") || !strings.Contains(r.Diff, "diff --git a/"+e.path) {
+				t.Errorf("diff of revision %d lacks %q:\n%s", i, line, r.Diff)
+			}
+		}
+	}
+
+	// known changes are skipped, only those of new commits or lost ones
+	// are added
+	tip := r.Write("unsorted/b-forum.yaml", "name: B Forum\nurls:\n- http://b2.onion\n").Commit("move b", nil)
+	if err := db.Where("commit_hash = ?", commits[1].Hash.String()).Delete(&ServiceRevision{}).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := New(db).History(r.Revision(tip)); err != nil {
+		t.Fatal(err)
+	}
+	again := loadRevisions(t, db, append(commits, tip)...)
+	if len(again) != len(expected)+1 {
+		t.Fatalf("%d revisions after a second walk, want %d", len(again), len(expected)+1)
+	}
+	for i := range revisions {
+		if again[i].ID != revisions[i].ID && again[i].CommitHash != commits[1].Hash.String() {
+			t.Errorf("revision %d of %s was stored again", i, again[i].CommitHash)
+		}
+	}
+	if last := again[len(again)-1]; last.CommitHash != tip.Hash.String() || last.Action != ActionModified || last.Path != "unsorted/b-forum.yaml" {
+		t.Errorf("revision of the new commit = %s %s of %s", last.Action, last.Path, last.CommitHash)
+	}
+}
+
+func TestHistoryVerified(t *testing.T) {
+	db := openDB(t)
+	defer db.Close()
+	trusted := newKey(t, "trusted")
+	r, commits := historyRepo(t, trusted, newKey(t, "untrusted"))
+
+	rev := r.Revision(commits[3])
+	if err := rev.Verify(&Verifier{Keyring: openpgp.EntityList{trusted}, Policy: PolicyQuarantine}); err != nil {
+		t.Fatal(err)
+	}
+	if err := New(db).History(rev); err != nil {
+		t.Fatal(err)
+	}
+	signatures := map[string]string{
+		commits[0].Hash.String(): SignatureGood,
+		commits[1].Hash.String(): SignatureNone,
+		commits[2].Hash.String(): SignatureUntrusted,
+		commits[3].Hash.String(): SignatureNone,
+	}
+	for _, r := range loadRevisions(t, db, commits...) {
+		if r.Signature != signatures[r.CommitHash] {
+			t.Errorf("signature of %s = %s, want %s", r.CommitHash, r.Signature, signatures[r.CommitHash])
+		}
+		if signer := identity(trusted); (r.Signature == SignatureGood) != (r.Signer == signer) {
+			t.Errorf("signer of %s = %q, want %q for good signatures only", r.CommitHash, r.Signer, signer)
+		}
+	}
+}
@@ -0,0 +1,251 @@
+package importer
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+
+	"github.com/goccy/go-yaml"
+	"github.com/gosimple/slug"
+	"github.com/jinzhu/gorm"
+	"github.com/k0kubun/pp"
+	"github.com/karrick/godirwalk"
+	"github.com/onionltd/oniontree-tools/pkg/types/service"
+	log "github.com/sirupsen/logrus"
+	"gopkg.in/src-d/go-git.v4"
+	"gopkg.in/src-d/go-git.v4/plumbing/object"
+
+	"github.com/x0rzkov/oniontree-backend/pkg/models"
+)
+
+// Importer loads the services of an oniontree repository into the database.
+// Services are tagged by the directory of tagged/ they are in.
+type Importer struct {
+	DB *gorm.DB
+	// Debug dumps every imported service.
+	Debug bool
+	// Trace dumps every file read from a git repository and stops after
+	// the hundredth.
+	Trace bool
+
+	imported int
+}
+
+// New returns an Importer writing to db.
+func New(db *gorm.DB) *Importer {
+	return &Importer{DB: db}
+}
+
+// Directory imports the services of a local checkout of the repository and
+// records the import, along with the checked out commit if root is a git
+// repository.
+func (i *Importer) Directory(root string) error {
+	head := headCommit(root)
+	hash := ""
+	if head != nil {
+		hash = head.Hash.String()
+	}
+	dirname := filepath.Join(root, "tagged")
+	err := godirwalk.Walk(dirname, &godirwalk.Options{
+		Callback: func(osPathname string, de *godirwalk.Dirent) error {
+			if de.IsDir() {
+				return nil
+			}
+			// services are tagged by the directory they are in
+			rel, err := filepath.Rel(dirname, osPathname)
+			if err != nil {
+				return err
+			}
+			parts := strings.Split(filepath.ToSlash(rel), "/")
+			if i.Debug {
+				fmt.Printf("Type:%s osPathname:%s tag:%s\n", de.ModeType(), osPathname, parts[0])
+			}
+			bytes, err := ioutil.ReadFile(osPathname)
+			if err != nil {
+				return err
+			}
+			t := service.Service{}
+			if err := yaml.Unmarshal(bytes, &t); err != nil {
+				log.Warnf("importer: skipping %s: %s", osPathname, err)
+				return nil
+			}
+			return i.importService(t, parts[0], hash, "")
+		},
+		Unsorted: true, // (optional) set true for faster yet non-deterministic enumeration (see godoc)
+	})
+	if err != nil {
+		return err
+	}
+	return i.record(root, "", head)
+}
+
+// headCommit returns the checked out commit of root, nil if root isn't a
+// git repository.
+func headCommit(root string) *object.Commit {
+	r, err := git.PlainOpen(root)
+	if err != nil {
+		return nil
+	}
+	head, err := r.Head()
+	if err != nil {
+		return nil
+	}
+	commit, err := r.CommitObject(head.Hash())
+	if err != nil {
+		return nil
+	}
+	return commit
+}
+
+// importService adds t, tagged with tag, to the database, along with the
+// commit it was imported from and its signer.
+func (i *Importer) importService(t service.Service, tag, commit, signer string) error {
+	db := i.DB
+	if i.Debug {
+		pp.Println(t)
+	}
+
+	// add service
+	m := &models.Service{
+		Name:        t.Name,
+		Description: t.Description,
+		Slug:        slug.Make(t.Name),
+		CommitHash:  commit,
+		Signer:      signer,
+	}
+	if err := db.Create(m).Error; err != nil {
+		return err
+	}
+
+	// add public keys
+	for _, publicKey := range t.PublicKeys {
+		pubKey := &models.PublicKey{
+			UID:         publicKey.ID,
+			UserID:      publicKey.UserID,
+			Fingerprint: publicKey.Fingerprint,
+			Description: publicKey.Description,
+			Value:       publicKey.Value,
+		}
+		if _, err := createOrUpdatePublicKey(db, m, pubKey); err != nil {
+			return err
+		}
+	}
+
+	// add urls
+	for _, url := range t.URLs {
+		var urlExists models.URL
+		u := &models.URL{Name: url}
+		if db.Where("name = ?", url).First(&urlExists).RecordNotFound() {
+			db.Create(&u)
+			if i.Debug {
+				pp.Println(u)
+			}
+		}
+		if _, err := createOrUpdateURL(db, m, u); err != nil {
+			return err
+		}
+	}
+
+	// add tags
+	// check if tag already exists
+	tg := &models.Tag{Name: tag}
+	var tagExists models.Tag
+	if db.Where("name = ?", tag).First(&tagExists).RecordNotFound() {
+		db.Create(&tg)
+		if i.Debug {
+			pp.Println(tg)
+		}
+	}
+	if _, err := createOrUpdateTag(db, m, tg); err != nil {
+		return err
+	}
+	i.imported++
+	return nil
+}
+
+func createOrUpdateTag(db *gorm.DB, svc *models.Service, tag *models.Tag) (bool, error) {
+	var existingSvc models.Service
+	if db.Where("slug = ?", svc.Slug).First(&existingSvc).RecordNotFound() {
+		err := db.Create(svc).Error
+		return err == nil, err
+	}
+	var existingTag models.Tag
+	if db.Where("name = ?", tag.Name).First(&existingTag).RecordNotFound() {
+		err := db.Create(tag).Error
+		return err == nil, err
+	}
+	svc.ID = existingSvc.ID
+	svc.CreatedAt = existingSvc.CreatedAt
+	svc.Tags = append(svc.Tags, &existingTag)
+	return false, db.Save(svc).Error
+}
+
+func createOrUpdatePublicKey(db *gorm.DB, svc *models.Service, pubKey *models.PublicKey) (bool, error) {
+	var existingSvc models.Service
+	if db.Where("slug = ?", svc.Slug).First(&existingSvc).RecordNotFound() {
+		err := db.Create(svc).Error
+		return err == nil, err
+	}
+	var existingPublicKey models.PublicKey
+	if db.Where("uid = ?", pubKey.UID).First(&existingPublicKey).RecordNotFound() {
+		err := db.Create(pubKey).Error
+		return err == nil, err
+	}
+	svc.ID = existingSvc.ID
+	svc.CreatedAt = existingSvc.CreatedAt
+	svc.PublicKeys = append(svc.PublicKeys, &existingPublicKey)
+	return false, db.Save(svc).Error
+}
+
+func createOrUpdateURL(db *gorm.DB, svc *models.Service, url *models.URL) (bool, error) {
+	var existingSvc models.Service
+	if db.Where("slug = ?", svc.Slug).First(&existingSvc).RecordNotFound() {
+		err := db.Create(svc).Error
+		return err == nil, err
+	}
+	var existingURL models.URL
+	if db.Where("name = ?", url.Name).First(&existingURL).RecordNotFound() {
+		err := db.Create(url).Error
+		return err == nil, err
+	}
+	svc.ID = existingSvc.ID
+	svc.CreatedAt = existingSvc.CreatedAt
+	svc.URLs = append(svc.URLs, &existingURL)
+	return false, db.Save(svc).Error
+}
+
+// dependents are the tables whose rows refer to services and outlive an
+// import, which Truncate won't orphan.
+var dependents = []struct{ table, name string }{
+	{"abuse_reports", "abuse reports"},
+	{"service_revisions", "service revisions"},
+}
+
+// Truncate deletes every row of tables, and the tags of services, leaving
+// the schema to the migrations. It is refused while abuse reports or the
+// timelines of services refer to them.
+func Truncate(db *gorm.DB, tables ...interface{}) error {
+	for _, dep := range dependents {
+		if !db.HasTable(dep.table) {
+			continue
+		}
+		var count int
+		if err := db.Table(dep.table).Count(&count).Error; err != nil {
+			return err
+		}
+		if count > 0 {
+			return fmt.Errorf("importer: not emptying the dataset tables, %d %s refer to services", count, dep.name)
+		}
+	}
+	if err := db.Exec("DELETE FROM service_tags").Error; err != nil {
+		return err
+	}
+	for _, table := range tables {
+		if err := db.Unscoped().Delete(table).Error; err != nil {
+			return err
+		}
+	}
+	log.Infof("importer: emptied %d tables", len(tables))
+	return nil
+}
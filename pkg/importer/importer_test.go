@@ -0,0 +1,59 @@
+package importer
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/x0rzkov/oniontree-backend/pkg/models"
+)
+
+func TestTruncate(t *testing.T) {
+	db := openDB(t)
+	defer db.Close()
+
+	r := newTestRepo(t, "")
+	r.Write("unsorted/a.yaml", "name: a\nurls:\n- http://a.onion\n").
+		Link("tagged/market/a.yaml", "../../unsorted/a.yaml")
+	if err := New(db).Git(r.Revision(r.Commit("import", nil))); err != nil {
+		t.Fatal(err)
+	}
+
+	// abuse reports are owned by another package, only their table matters
+	if err := db.Exec("CREATE TABLE abuse_reports (id integer PRIMARY KEY, service_id integer)").Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Exec("INSERT INTO abuse_reports (service_id) VALUES (1)").Error; err != nil {
+		t.Fatal(err)
+	}
+	err := Truncate(db, models.Tables...)
+	if err == nil || !strings.Contains(err.Error(), "1 abuse reports") {
+		t.Fatalf("Truncate with an abuse report = %v, want a refusal", err)
+	}
+	if err := db.Exec("DELETE FROM abuse_reports").Error; err != nil {
+		t.Fatal(err)
+	}
+
+	if err := db.Create(&ServiceRevision{CommitHash: "c", Path: "unsorted/a.yaml", Slug: "a"}).Error; err != nil {
+		t.Fatal(err)
+	}
+	err = Truncate(db, models.Tables...)
+	if err == nil || !strings.Contains(err.Error(), "1 service revisions") {
+		t.Fatalf("Truncate with a service revision = %v, want a refusal", err)
+	}
+	var count int
+	if db.Model(&models.Service{}).Count(&count); count != 1 {
+		t.Fatalf("%d services after a refused Truncate, want 1", count)
+	}
+	if err := db.Delete(&ServiceRevision{}).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	if err := Truncate(db, models.Tables...); err != nil {
+		t.Fatal(err)
+	}
+	for _, table := range models.Tables {
+		if db.Unscoped().Model(table).Count(&count); count != 0 {
+			t.Errorf("%d rows of %T left", count, table)
+		}
+	}
+}
@@ -0,0 +1,282 @@
+package importer
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	log "github.com/sirupsen/logrus"
+	"gopkg.in/src-d/go-git.v4/plumbing"
+
+	"github.com/x0rzkov/oniontree-backend/pkg/config"
+)
+
+// Statuses of a dataset update.
+const (
+	UpdatePending = "pending"
+	UpdateApplied = "applied"
+	// UpdateDismissed was rejected by a maintainer.
+	UpdateDismissed = "dismissed"
+	// UpdateSuperseded was replaced by a newer update before it was
+	// applied.
+	UpdateSuperseded = "superseded"
+)
+
+// How pulled updates are applied, see config.Pull.
+const (
+	ApplyAuto     = "auto"
+	ApplyApproval = "approval"
+)
+
+// UpdateStatuses lists every dataset update status.
+var UpdateStatuses = []string{UpdatePending, UpdateApplied, UpdateDismissed, UpdateSuperseded}
+
+// DatasetUpdate is the set of services added, changed and removed upstream
+// since the last import, which waits for approval unless applied
+// automatically.
+type DatasetUpdate struct {
+	ID        uint      `gorm:"primary_key"`
+	CreatedAt time.Time `gorm:"index"`
+	Source    string
+	Revision  string `gorm:"size:255"`
+	// ImportID is the last import when the update was pulled, and
+	// BaseCommit its commit which the update is compared to, empty when it
+	// was compared to the database.
+	ImportID    uint
+	BaseCommit  string `gorm:"size:40"`
+	CommitHash  string `gorm:"size:40;index"`
+	CommittedAt *time.Time
+	Author      string
+	Subject     string `gorm:"type:text"`
+	Added       int
+	Modified    int
+	Deleted     int
+	// Services is the number of services once the update is applied.
+	Services int
+	// Changes is the JSON of the list of changes.
+	Changes    string `gorm:"type:text"`
+	Status     string `gorm:"size:16;index"`
+	ReviewedAt *time.Time
+}
+
+// ChangeList decodes the changes of u.
+func (u DatasetUpdate) ChangeList() ([]Change, error) {
+	var changes []Change
+	if u.Changes == "" {
+		return nil, nil
+	}
+	err := json.Unmarshal([]byte(u.Changes), &changes)
+	return changes, err
+}
+
+// Apply makes the changes of u to db and records the import of its commit.
+// Only the latest pending update of the last imported commit can be
+// applied.
+func (u *DatasetUpdate) Apply(db *gorm.DB) error {
+	if u.Status != UpdatePending {
+		return fmt.Errorf("dataset update %d is already %s", u.ID, u.Status)
+	}
+	if last := lastImport(db); last.ID != u.ImportID {
+		return fmt.Errorf("dataset update %d is outdated, %s was imported since", u.ID, last.CommitHash)
+	}
+	changes, err := u.ChangeList()
+	if err != nil {
+		return err
+	}
+
+	tx := db.Begin()
+	i := New(tx)
+	if err := i.Apply(changes); err != nil {
+		tx.Rollback()
+		return err
+	}
+	imp := &DatasetImport{
+		Source:      u.Source,
+		Revision:    u.Revision,
+		Services:    u.Services,
+		CommitHash:  u.CommitHash,
+		CommittedAt: u.CommittedAt,
+		Author:      u.Author,
+		Subject:     u.Subject,
+	}
+	if err := tx.Create(imp).Error; err != nil {
+		tx.Rollback()
+		return err
+	}
+	now := time.Now()
+	u.Status, u.ReviewedAt = UpdateApplied, &now
+	if err := tx.Save(u).Error; err != nil {
+		tx.Rollback()
+		return err
+	}
+	if err := tx.Commit().Error; err != nil {
+		return err
+	}
+	log.Infof("importer: applied %s", u)
+	return nil
+}
+
+// Dismiss marks u dismissed, it is pulled again only once upstream moves.
+func (u *DatasetUpdate) Dismiss(db *gorm.DB) error {
+	if u.Status != UpdatePending {
+		return fmt.Errorf("dataset update %d is already %s", u.ID, u.Status)
+	}
+	now := time.Now()
+	u.Status, u.ReviewedAt = UpdateDismissed, &now
+	return db.Save(u).Error
+}
+
+func (u DatasetUpdate) String() string {
+	return fmt.Sprintf("%d added, %d modified and %d deleted services from %s at %s", u.Added, u.Modified, u.Deleted, u.Source, u.CommitHash)
+}
+
+func lastImport(db *gorm.DB) DatasetImport {
+	var imp DatasetImport
+	db.Order("id DESC").First(&imp)
+	return imp
+}
+
+// Puller fetches the upstream repository and computes the dataset updates
+// since the last import. Remote repositories are cloned once, then fetched.
+type Puller struct {
+	DB       *gorm.DB
+	Source   *Source
+	Verifier *Verifier
+	// Auto applies updates as soon as they are pulled, they wait for
+	// approval in the admin otherwise.
+	Auto bool
+
+	rev *Revision
+}
+
+// NewPuller returns the Puller of the upstream repository of c, writing to
+// db.
+func NewPuller(db *gorm.DB, c config.Data) (*Puller, error) {
+	src, err := NewSource(c)
+	if err != nil {
+		return nil, err
+	}
+	// the last imported commit is needed to compare to it
+	src.Full = true
+	v, err := NewVerifier(c.Verify)
+	if err != nil {
+		return nil, err
+	}
+	return &Puller{DB: db, Source: src, Verifier: v, Auto: c.Pull.Apply == ApplyAuto}, nil
+}
+
+// Pull fetches the upstream repository and stores the update since the last
+// import, which is applied if Auto is set or if no service changed. It
+// returns nil if the last import or a pending update are up to date.
+func (p *Puller) Pull() (*DatasetUpdate, error) {
+	var (
+		rev *Revision
+		err error
+	)
+	if p.rev == nil {
+		rev, err = p.Source.Open()
+	} else {
+		rev, err = p.Source.Update(p.rev)
+	}
+	if err != nil {
+		return nil, err
+	}
+	p.rev = rev
+	if err := rev.Verify(p.Verifier); err != nil {
+		return nil, err
+	}
+
+	hash := rev.Commit.Hash.String()
+	last := lastImport(p.DB)
+	pending := p.DB.Model(&DatasetUpdate{}).Where("status = ?", UpdatePending)
+	if last.CommitHash == hash {
+		return nil, pending.Update("status", UpdateSuperseded).Error
+	}
+	var count int
+	if err := p.DB.Model(&DatasetUpdate{}).Where("commit_hash = ? AND import_id = ? AND status IN (?)", hash, last.ID, []string{UpdatePending, UpdateDismissed}).Count(&count).Error; err != nil {
+		return nil, err
+	}
+	if count > 0 {
+		return nil, nil
+	}
+
+	after, err := ReadSnapshot(rev)
+	if err != nil {
+		return nil, err
+	}
+	before, base, err := p.base(last.CommitHash)
+	if err != nil {
+		return nil, err
+	}
+	changes := Compare(before, after)
+	encoded, err := json.Marshal(changes)
+	if err != nil {
+		return nil, err
+	}
+
+	committedAt := rev.Commit.Committer.When
+	u := &DatasetUpdate{
+		Source:      rev.Source.URL,
+		Revision:    rev.Source.Revision,
+		ImportID:    last.ID,
+		BaseCommit:  base,
+		CommitHash:  hash,
+		CommittedAt: &committedAt,
+		Author:      rev.Commit.Author.Name + " <" + rev.Commit.Author.Email + ">",
+		Subject:     strings.SplitN(strings.TrimSpace(rev.Commit.Message), "\n", 2)[0],
+		Services:    len(after),
+		Changes:     string(encoded),
+		Status:      UpdatePending,
+	}
+	for _, c := range changes {
+		switch c.Action {
+		case ActionAdded:
+			u.Added++
+		case ActionModified:
+			u.Modified++
+		case ActionDeleted:
+			u.Deleted++
+		}
+	}
+	if err := pending.Update("status", UpdateSuperseded).Error; err != nil {
+		return nil, err
+	}
+	if err := p.DB.Create(u).Error; err != nil {
+		return nil, err
+	}
+	if p.Auto || len(changes) == 0 {
+		return u, u.Apply(p.DB)
+	}
+	log.Infof("importer: pulled %s, waiting for approval", u)
+	return u, nil
+}
+
+// base returns the services of the last imported commit, along with the
+// commit, or those of the database if the repository doesn't have it.
+func (p *Puller) base(commit string) (Snapshot, string, error) {
+	if commit != "" {
+		if c, err := p.rev.Repository.CommitObject(plumbing.NewHash(commit)); err == nil {
+			s, err := ReadSnapshot(&Revision{Source: p.Source, Repository: p.rev.Repository, Commit: c})
+			return s, commit, err
+		}
+		log.Warnf("importer: %s isn't in %s, comparing to the database", commit, p.Source.URL)
+	}
+	s, err := DBSnapshot(p.DB)
+	return s, "", err
+}
+
+// Watch pulls every interval until the process exits.
+func (p *Puller) Watch(interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			if _, err := p.Pull(); err != nil {
+				log.Errorf("importer: pulling %s: %s", p.Source, err)
+			}
+			<-ticker.C
+		}
+	}()
+}
@@ -0,0 +1,73 @@
+package importer
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func TestPullerPull(t *testing.T) {
+	db := openDB(t)
+	defer db.Close()
+	dir, err := ioutil.TempDir("", "oniontree")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	r := newTestRepo(t, dir)
+	r.Write("unsorted/a.yaml", "name: a\nurls:\n- http://a.onion\n").
+		Link("tagged/market/a.yaml", "../../unsorted/a.yaml")
+	base := r.Commit("add a", nil)
+	if err := New(db).Git(r.Revision(base)); err != nil {
+		t.Fatal(err)
+	}
+	imported := Snapshot{"a": entry("a", "", "market")}
+
+	p := &Puller{DB: db, Source: &Source{URL: dir}}
+	if u, err := p.Pull(); err != nil || u != nil {
+		t.Fatalf("Pull of the imported commit = %v, %v", u, err)
+	}
+
+	r.Write("unsorted/a.yaml", "name: a\ndescription: market\nurls:\n- http://a.onion\n").
+		Write("unsorted/b.yaml", "name: b\nurls:\n- http://b.onion\n").
+		Link("tagged/forum/b.yaml", "../../unsorted/b.yaml")
+	tip := r.Commit("edit a, add b", nil)
+	u, err := p.Pull()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u == nil || u.Status != UpdatePending || u.BaseCommit != base.Hash.String() || u.CommitHash != tip.Hash.String() ||
+		u.Added != 1 || u.Modified != 1 || u.Deleted != 0 || u.Services != 2 || u.Subject != "edit a, add b" {
+		t.Fatalf("Pull = %+v, expected a pending update adding b and modifying a", u)
+	}
+	// pending updates wait for approval
+	checkSnapshot(t, db, imported)
+	if again, err := p.Pull(); err != nil || again != nil {
+		t.Fatalf("Pull of a pending commit = %v, %v", again, err)
+	}
+
+	if err := u.Apply(db); err != nil {
+		t.Fatal(err)
+	}
+	a := entry("a", "market", "market")
+	checkSnapshot(t, db, Snapshot{"a": a, "b": entry("b", "", "forum")})
+	if last := lastImport(db); last.CommitHash != tip.Hash.String() {
+		t.Errorf("last import = %s, expected %s", last.CommitHash, tip.Hash)
+	}
+	if err := u.Apply(db); err == nil {
+		t.Error("an applied update was applied again")
+	}
+
+	// automatically applied updates
+	p.Auto = true
+	r.Remove("tagged/forum/b.yaml").Remove("unsorted/b.yaml")
+	r.Commit("delete b", nil)
+	if u, err = p.Pull(); err != nil {
+		t.Fatal(err)
+	}
+	if u == nil || u.Status != UpdateApplied || u.Deleted != 1 {
+		t.Fatalf("Pull = %+v, expected an applied update deleting b", u)
+	}
+	checkSnapshot(t, db, Snapshot{"a": a})
+}
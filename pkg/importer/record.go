@@ -0,0 +1,58 @@
+package importer
+
+import (
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"gopkg.in/src-d/go-git.v4/plumbing/object"
+)
+
+// Tables lists every model owned by this package, in creation order.
+var Tables = []interface{}{
+	&DatasetImport{},
+	&ServiceRevision{},
+	&DatasetUpdate{},
+}
+
+// DatasetImport records an import of the dataset, and the commit it was
+// imported from when it came from git.
+type DatasetImport struct {
+	ID        uint      `gorm:"primary_key"`
+	CreatedAt time.Time `gorm:"index"`
+	// Source is the repository URL or the directory imported.
+	Source string
+	// Revision is the requested branch, tag or commit.
+	Revision    string `gorm:"size:255"`
+	CommitHash  string `gorm:"size:40;index"`
+	CommittedAt *time.Time
+	Author      string
+	Subject     string `gorm:"type:text"`
+	Services    int
+}
+
+// record stores the import of the services read so far from source, at
+// commit if it is not nil.
+func (i *Importer) record(source, revision string, commit *object.Commit) error {
+	imp := &DatasetImport{
+		Source:   source,
+		Revision: revision,
+		Services: i.imported,
+	}
+	if commit != nil {
+		committedAt := commit.Committer.When
+		imp.CommitHash = commit.Hash.String()
+		imp.CommittedAt = &committedAt
+		imp.Author = commit.Author.Name + " <" + commit.Author.Email + ">"
+		imp.Subject = strings.SplitN(strings.TrimSpace(commit.Message), "\n", 2)[0]
+	}
+	if err := i.DB.Create(imp).Error; err != nil {
+		return err
+	}
+	if imp.CommitHash != "" {
+		log.Infof("importer: imported %d services from %s at %s", imp.Services, source, imp.CommitHash)
+	} else {
+		log.Infof("importer: imported %d services from %s", imp.Services, source)
+	}
+	return nil
+}
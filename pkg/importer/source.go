@@ -0,0 +1,210 @@
+package importer
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"gopkg.in/src-d/go-git.v4"
+	gitconfig "gopkg.in/src-d/go-git.v4/config"
+	"gopkg.in/src-d/go-git.v4/plumbing"
+	"gopkg.in/src-d/go-git.v4/plumbing/object"
+	"gopkg.in/src-d/go-git.v4/plumbing/transport"
+	"gopkg.in/src-d/go-git.v4/plumbing/transport/http"
+	"gopkg.in/src-d/go-git.v4/plumbing/transport/ssh"
+	"gopkg.in/src-d/go-git.v4/storage/memory"
+
+	"github.com/x0rzkov/oniontree-backend/pkg/config"
+)
+
+// Source is a git repository to import from.
+type Source struct {
+	// URL is a local path, a file:// URL or the URL of a remote repository.
+	// Local repositories may be bare.
+	URL string
+	// Revision is a branch, a tag or a full commit SHA, HEAD when empty.
+	Revision string
+	// Auth authenticates to a remote repository, nil for none.
+	Auth transport.AuthMethod
+	// Full clones the whole history of a remote repository.
+	Full bool
+}
+
+// NewSource returns the upstream repository of c.
+func NewSource(c config.Data) (*Source, error) {
+	s := &Source{URL: c.Upstream, Revision: c.Revision, Full: c.History || (c.Verify.Policy != "" && c.Verify.Policy != PolicyNone)}
+	if s.local() != "" {
+		return s, nil
+	}
+	ep, err := transport.NewEndpoint(s.URL)
+	if err != nil {
+		return nil, err
+	}
+	switch ep.Protocol {
+	case "ssh":
+		user := c.Auth.Username
+		if user == "" {
+			user = ep.User
+		}
+		if user == "" {
+			user = "git"
+		}
+		if c.Auth.Key != "" {
+			s.Auth, err = ssh.NewPublicKeysFromFile(user, c.Auth.Key, c.Auth.KeyPassphrase)
+		} else {
+			s.Auth, err = ssh.NewSSHAgentAuth(user)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("importer: ssh auth: %s", err)
+		}
+	case "http", "https":
+		if c.Auth.Username != "" || c.Auth.Password != "" {
+			s.Auth = &http.BasicAuth{Username: c.Auth.Username, Password: c.Auth.Password}
+		}
+	}
+	return s, nil
+}
+
+func (s *Source) String() string {
+	if s.Revision == "" {
+		return s.URL
+	}
+	return s.URL + "@" + s.Revision
+}
+
+// local returns the path of a local repository, or "" for a remote one.
+func (s *Source) local() string {
+	if strings.HasPrefix(s.URL, "file://") {
+		return strings.TrimPrefix(s.URL, "file://")
+	}
+	if _, err := os.Stat(s.URL); err == nil {
+		return s.URL
+	}
+	return ""
+}
+
+// Revision is a commit of a Source, ready to be imported.
+type Revision struct {
+	Source     *Source
+	Repository *git.Repository
+	Commit     *object.Commit
+	// Verifier checked the signatures of the history of Commit, see
+	// Verify.
+	Verifier *Verifier
+
+	verified map[string]*verifiedFile
+}
+
+// Open opens the repository and resolves the revision to a commit. Local
+// repositories are opened in place, remote ones are cloned to memory,
+// shallow unless Full is set or the revision is neither a branch nor a tag.
+func (s *Source) Open() (*Revision, error) {
+	var (
+		r   *git.Repository
+		err error
+	)
+	if path := s.local(); path != "" {
+		r, err = git.PlainOpen(path)
+	} else {
+		r, err = s.clone()
+	}
+	if err != nil {
+		return nil, fmt.Errorf("importer: %s: %s", s.URL, err)
+	}
+	return s.resolve(r)
+}
+
+// Update brings rev up to date with its source: local repositories are
+// opened again, remote ones fetch the new commits of the revision. A
+// revision of HEAD stays at the commit first cloned.
+func (s *Source) Update(rev *Revision) (*Revision, error) {
+	if s.local() != "" {
+		return s.Open()
+	}
+	err := rev.Repository.Fetch(&git.FetchOptions{Auth: s.Auth, Force: true})
+	if err != nil && err != git.NoErrAlreadyUpToDate {
+		return nil, fmt.Errorf("importer: %s: %s", s.URL, err)
+	}
+	return s.resolve(rev.Repository)
+}
+
+// resolve returns the commit of the revision in r. Branches of a clone are
+// resolved to the remote ones, which fetches update.
+func (s *Source) resolve(r *git.Repository) (*Revision, error) {
+	revision := s.Revision
+	if revision == "" {
+		revision = "HEAD"
+	}
+	candidates := []string{revision, "origin/" + revision}
+	if s.local() == "" {
+		candidates[0], candidates[1] = candidates[1], candidates[0]
+	}
+	var (
+		hash *plumbing.Hash
+		err  error
+	)
+	for _, candidate := range candidates {
+		if hash, err = r.ResolveRevision(plumbing.Revision(candidate)); err == nil {
+			break
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("importer: %s: revision %s not found", s.URL, revision)
+	}
+	commit, err := r.CommitObject(*hash)
+	if err != nil {
+		return nil, err
+	}
+	return &Revision{Source: s, Repository: r, Commit: commit}, nil
+}
+
+func (s *Source) clone() (*git.Repository, error) {
+	opts := &git.CloneOptions{
+		URL:  s.URL,
+		Auth: s.Auth,
+		Tags: git.NoTags,
+	}
+	if s.Revision != "" {
+		ref, err := s.findRef()
+		if err != nil {
+			return nil, err
+		}
+		if ref == "" {
+			// a commit, which may be anywhere in the history
+			opts.Tags = git.AllTags
+			return git.Clone(memory.NewStorage(), nil, opts)
+		}
+		opts.ReferenceName = ref
+	}
+	opts.SingleBranch = true
+	if !s.Full {
+		opts.Depth = 1
+	}
+	return git.Clone(memory.NewStorage(), nil, opts)
+}
+
+// findRef returns the branch or tag called like the revision, or "" if
+// there is none.
+func (s *Source) findRef() (plumbing.ReferenceName, error) {
+	remote := git.NewRemote(memory.NewStorage(), &gitconfig.RemoteConfig{
+		Name: git.DefaultRemoteName,
+		URLs: []string{s.URL},
+	})
+	refs, err := remote.List(&git.ListOptions{Auth: s.Auth})
+	if err != nil {
+		return "", err
+	}
+	names := map[plumbing.ReferenceName]bool{}
+	for _, ref := range refs {
+		names[ref.Name()] = true
+	}
+	for _, name := range []plumbing.ReferenceName{
+		plumbing.NewBranchReferenceName(s.Revision),
+		plumbing.NewTagReferenceName(s.Revision),
+	} {
+		if names[name] {
+			return name, nil
+		}
+	}
+	return "", nil
+}
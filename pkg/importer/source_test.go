@@ -0,0 +1,230 @@
+package importer
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"gopkg.in/src-d/go-billy.v4/osfs"
+	"gopkg.in/src-d/go-git.v4/plumbing"
+	"gopkg.in/src-d/go-git.v4/plumbing/object"
+	"gopkg.in/src-d/go-git.v4/plumbing/transport/client"
+	"gopkg.in/src-d/go-git.v4/plumbing/transport/http"
+	"gopkg.in/src-d/go-git.v4/plumbing/transport/server"
+
+	"github.com/x0rzkov/oniontree-backend/pkg/config"
+)
+
+// sourceRepo is a repository checked out at dir, whose master branch adds a
+// in the first commit, tagged v1, adds b in the second, the tip of the dev
+// branch, and edits a in the third.
+type sourceRepo struct {
+	*testRepo
+	dir     string
+	commits []*object.Commit
+}
+
+func newSourceRepo(t *testing.T) *sourceRepo {
+	dir, err := ioutil.TempDir("", "oniontree")
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := &sourceRepo{testRepo: newTestRepo(t, dir), dir: dir}
+	// written on first change only, servers need it
+	cfg, err := r.Repository.Config()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Repository.Storer.SetConfig(cfg); err != nil {
+		t.Fatal(err)
+	}
+	r.Write("unsorted/a.yaml", "name: a\nurls:\n- http://a.onion\n").
+		Link("tagged/market/a.yaml", "../../unsorted/a.yaml")
+	r.commits = append(r.commits, r.Commit("add a", nil))
+	if _, err := r.Repository.CreateTag("v1", r.commits[0].Hash, nil); err != nil {
+		t.Fatal(err)
+	}
+	r.Write("unsorted/b.yaml", "name: b\nurls:\n- http://b.onion\n").
+		Link("tagged/forum/b.yaml", "../../unsorted/b.yaml")
+	r.commits = append(r.commits, r.Commit("add b", nil))
+	if err := r.Repository.Storer.SetReference(plumbing.NewHashReference(plumbing.NewBranchReferenceName("dev"), r.commits[1].Hash)); err != nil {
+		t.Fatal(err)
+	}
+	r.Write("unsorted/a.yaml", "name: a\ndescription: edited\nurls:\n- http://a.onion\n")
+	r.commits = append(r.commits, r.Commit("edit a", nil))
+	return r
+}
+
+func (r *sourceRepo) Close() {
+	os.RemoveAll(r.dir)
+}
+
+// revisions maps revisions of r to the commit they resolve to.
+func (r *sourceRepo) revisions() map[string]*object.Commit {
+	return map[string]*object.Commit{
+		"":                         r.commits[2],
+		"master":                   r.commits[2],
+		"dev":                      r.commits[1],
+		"v1":                       r.commits[0],
+		r.commits[1].Hash.String(): r.commits[1],
+	}
+}
+
+func TestNewSource(t *testing.T) {
+	dir, err := ioutil.TempDir("", "oniontree")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	for _, test := range []struct {
+		data  config.Data
+		local string
+		auth  bool
+		full  bool
+	}{
+		{data: config.Data{Upstream: dir}, local: dir},
+		{data: config.Data{Upstream: "file://" + dir}, local: dir},
+		{data: config.Data{Upstream: "https://example.org/oniontree", History: true}, full: true},
+		{data: config.Data{Upstream: "https://example.org/oniontree", Verify: config.Verify{Policy: PolicyQuarantine}}, full: true},
+		{data: config.Data{Upstream: "https://example.org/oniontree", Auth: config.GitAuth{Username: "bot", Password: "secret"}}, auth: true},
+	} {
+		s, err := NewSource(test.data)
+		if err != nil {
+			t.Errorf("%s: %s", test.data.Upstream, err)
+			continue
+		}
+		if s.local() != test.local || (s.Auth != nil) != test.auth || s.Full != test.full {
+			t.Errorf("%s: local %q, auth %v, full %v", test.data.Upstream, s.local(), s.Auth, s.Full)
+		}
+		if test.auth {
+			if auth, ok := s.Auth.(*http.BasicAuth); !ok || auth.Username != "bot" || auth.Password != "secret" {
+				t.Errorf("%s: auth %v, want the basic auth of bot", test.data.Upstream, s.Auth)
+			}
+		}
+	}
+
+	_, err = NewSource(config.Data{Upstream: "git@example.org:oniontree.git", Auth: config.GitAuth{Key: filepath.Join(dir, "missing")}})
+	if err == nil || !strings.Contains(err.Error(), "ssh auth") {
+		t.Errorf("NewSource with a missing SSH key = %v", err)
+	}
+}
+
+func TestSourceOpenLocal(t *testing.T) {
+	r := newSourceRepo(t)
+	defer r.Close()
+
+	// a checkout, the same as a URL and its git directory, a bare repository
+	for _, url := range []string{r.dir, "file://" + r.dir, filepath.Join(r.dir, ".git")} {
+		for revision, commit := range r.revisions() {
+			rev, err := (&Source{URL: url, Revision: revision}).Open()
+			if err != nil {
+				t.Errorf("%s@%s: %s", url, revision, err)
+				continue
+			}
+			if rev.Commit.Hash != commit.Hash {
+				t.Errorf("%s@%s = %q, want %q", url, revision, rev.Commit.Message, commit.Message)
+			}
+		}
+		_, err := (&Source{URL: url, Revision: "missing"}).Open()
+		if err == nil || !strings.Contains(err.Error(), "revision missing not found") {
+			t.Errorf("%s@missing = %v", url, err)
+		}
+	}
+}
+
+// serve serves the repositories of the file system as gittest:// URLs, from
+// memory. It doesn't serve shallow clones.
+func serve(t *testing.T) {
+	client.InstallProtocol("gittest", server.NewClient(server.NewFilesystemLoader(osfs.New(""))))
+	t.Cleanup(func() { client.InstallProtocol("gittest", nil) })
+}
+
+func TestSourceClone(t *testing.T) {
+	r := newSourceRepo(t)
+	defer r.Close()
+	serve(t)
+	url := "gittest://" + filepath.Join(r.dir, ".git")
+
+	for revision, commit := range r.revisions() {
+		s := &Source{URL: url, Revision: revision, Full: true}
+		if s.local() != "" {
+			t.Fatalf("%s is local", url)
+		}
+		rev, err := s.Open()
+		if err != nil {
+			t.Errorf("%s@%s: %s", url, revision, err)
+			continue
+		}
+		if rev.Commit.Hash != commit.Hash {
+			t.Errorf("%s@%s = %q, want %q", url, revision, rev.Commit.Message, commit.Message)
+		}
+	}
+
+	for revision, want := range map[string]plumbing.ReferenceName{
+		"dev":                      "refs/heads/dev",
+		"v1":                       "refs/tags/v1",
+		r.commits[0].Hash.String(): "",
+	} {
+		if ref, err := (&Source{URL: url, Revision: revision}).findRef(); err != nil || ref != want {
+			t.Errorf("findRef of %s = %q, %v, want %q", revision, ref, err, want)
+		}
+	}
+	if _, err := (&Source{URL: url, Revision: "missing", Full: true}).Open(); err == nil {
+		t.Error("cloning a missing revision succeeded")
+	}
+}
+
+func TestSourceUpdate(t *testing.T) {
+	r := newSourceRepo(t)
+	defer r.Close()
+	serve(t)
+
+	var revs []*Revision
+	for _, s := range []*Source{
+		{URL: "gittest://" + filepath.Join(r.dir, ".git"), Revision: "master", Full: true},
+		{URL: "gittest://" + filepath.Join(r.dir, ".git"), Revision: "v1", Full: true},
+		{URL: r.dir, Revision: "master"},
+	} {
+		rev, err := s.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		revs = append(revs, rev)
+	}
+
+	r.Remove("unsorted/b.yaml").Remove("tagged/forum/b.yaml")
+	tip := r.Commit("remove b", nil)
+	for i, want := range []*object.Commit{tip, r.commits[0], tip} {
+		rev, err := revs[i].Source.Update(revs[i])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if rev.Commit.Hash != want.Hash {
+			t.Errorf("update of %s = %q, want %q", revs[i].Source, rev.Commit.Message, want.Message)
+		}
+	}
+}
+
+func TestSourceImport(t *testing.T) {
+	db := openDB(t)
+	defer db.Close()
+	r := newSourceRepo(t)
+	defer r.Close()
+
+	rev, err := (&Source{URL: r.dir, Revision: "dev"}).Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := New(db).Git(rev); err != nil {
+		t.Fatal(err)
+	}
+	last := lastImport(db)
+	if last.Source != r.dir || last.Revision != "dev" || last.CommitHash != r.commits[1].Hash.String() ||
+		last.Subject != "add b" || last.Author != "test <test@example.org>" || last.Services != 2 || last.CommittedAt == nil {
+		t.Errorf("recorded import = %+v, want the tip of dev", last)
+	}
+	checkSnapshot(t, db, Snapshot{"a": entry("a", "", "market"), "b": entry("b", "", "forum")})
+}
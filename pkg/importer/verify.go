@@ -0,0 +1,311 @@
+package importer
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/crypto/openpgp"
+	pgperrors "golang.org/x/crypto/openpgp/errors"
+	"gopkg.in/src-d/go-git.v4"
+	"gopkg.in/src-d/go-git.v4/plumbing"
+	"gopkg.in/src-d/go-git.v4/plumbing/filemode"
+	"gopkg.in/src-d/go-git.v4/plumbing/object"
+	"gopkg.in/src-d/go-git.v4/plumbing/storer"
+
+	"github.com/x0rzkov/oniontree-backend/pkg/config"
+)
+
+// Signature statuses of commits checked against a keyring.
+const (
+	// SignatureGood is a valid signature by a trusted key.
+	SignatureGood = "good"
+	// SignatureUntrusted is a signature by a key missing from the keyring.
+	SignatureUntrusted = "untrusted"
+	// SignatureBad is a signature which doesn't match the commit, which
+	// was tampered with.
+	SignatureBad = "bad"
+	// SignatureTrusted is a commit older than the one signatures are
+	// required from.
+	SignatureTrusted = "trusted"
+)
+
+// Verification policies, see config.Verify.
+const (
+	PolicyNone       = "none"
+	PolicyRefuse     = "refuse"
+	PolicyQuarantine = "quarantine"
+)
+
+// Signature is the result of the verification of a commit.
+type Signature struct {
+	Status string
+	// Signer is the identity of the key of a good signature.
+	Signer string
+}
+
+// Verifier checks the signatures of commits against a keyring of trusted
+// contributors.
+type Verifier struct {
+	Keyring openpgp.EntityList
+	Policy  string
+	// Since is the oldest commit whose signature is checked, older ones
+	// are trusted. The zero hash checks the whole history.
+	Since plumbing.Hash
+}
+
+// NewVerifier returns the Verifier configured by c, nil if the policy is
+// PolicyNone.
+func NewVerifier(c config.Verify) (*Verifier, error) {
+	if c.Policy == "" || c.Policy == PolicyNone {
+		return nil, nil
+	}
+	f, err := os.Open(c.Keyring)
+	if err != nil {
+		return nil, fmt.Errorf("importer: keyring: %s", err)
+	}
+	defer f.Close()
+	keyring, err := openpgp.ReadArmoredKeyRing(f)
+	if err != nil {
+		return nil, fmt.Errorf("importer: keyring %s: %s", c.Keyring, err)
+	}
+	return &Verifier{Keyring: keyring, Policy: c.Policy, Since: plumbing.NewHash(c.Since)}, nil
+}
+
+// Check verifies the signature of c.
+func (v *Verifier) Check(c *object.Commit) Signature {
+	if c.PGPSignature == "" {
+		return Signature{Status: SignatureNone}
+	}
+	encoded := &plumbing.MemoryObject{}
+	if err := c.EncodeWithoutSignature(encoded); err != nil {
+		return Signature{Status: SignatureBad}
+	}
+	r, err := encoded.Reader()
+	if err != nil {
+		return Signature{Status: SignatureBad}
+	}
+	signer, err := openpgp.CheckArmoredDetachedSignature(v.Keyring, r, strings.NewReader(c.PGPSignature))
+	switch {
+	case err == pgperrors.ErrUnknownIssuer:
+		return Signature{Status: SignatureUntrusted}
+	case err != nil:
+		return Signature{Status: SignatureBad}
+	}
+	return Signature{Status: SignatureGood, Signer: identity(signer)}
+}
+
+// identity names the owner of e, along with the ID of its key.
+func identity(e *openpgp.Entity) string {
+	name := ""
+	for _, ident := range e.Identities {
+		if name == "" || (ident.SelfSignature != nil && ident.SelfSignature.IsPrimaryId != nil && *ident.SelfSignature.IsPrimaryId) {
+			name = ident.Name
+		}
+	}
+	return strings.TrimSpace(name + " " + e.PrimaryKey.KeyIdString())
+}
+
+// verifiedFile is the content of a file of the dataset as of its last
+// change by a trusted commit.
+type verifiedFile struct {
+	// Content is nil when no trusted commit ever added the file.
+	Content []byte
+	// Symlink tells that Content is the target of a symbolic link.
+	Symlink   bool
+	Commit    string
+	Signature Signature
+}
+
+// Verify checks the signatures of the history of rev with v, which imports
+// of rev then abide by. Nothing is checked when v is nil.
+//
+// A bad signature fails, the repository was tampered with. Under
+// PolicyRefuse, so does any commit which isn't signed by a trusted key.
+// Under PolicyQuarantine, the changes of such commits are held back: files
+// of unsorted/ and links of tagged/ get the content of their last trusted
+// change instead, those they deleted are restored, and those they added are
+// left out.
+func (rev *Revision) Verify(v *Verifier) error {
+	if v == nil {
+		return nil
+	}
+	files, err := v.verify(rev)
+	if err != nil {
+		return err
+	}
+	rev.Verifier, rev.verified = v, files
+	return nil
+}
+
+// verifiedPath reports whether the file name of the repository is verified:
+// the services of unsorted/ and the entries of tagged/ linking to them.
+func verifiedPath(name string) bool {
+	if path.Dir(name) == "unsorted" {
+		return path.Ext(name) == ".yaml"
+	}
+	return strings.HasPrefix(name, "tagged/") && strings.Count(name, "/") >= 2
+}
+
+// verify walks the history of rev from its tip and returns, for every
+// verified path, its content as of its last change by a trusted commit.
+func (v *Verifier) verify(rev *Revision) (map[string]*verifiedFile, error) {
+	tree, err := rev.Commit.Tree()
+	if err != nil {
+		return nil, err
+	}
+	// candidates are the files not resolved yet, as of the commit being
+	// walked, and seen the files whose last change was walked
+	candidates := map[string]object.TreeEntry{}
+	seen := map[string]bool{}
+	err = tree.Files().ForEach(func(f *object.File) error {
+		if verifiedPath(f.Name) {
+			candidates[f.Name] = object.TreeEntry{Name: f.Name, Mode: f.Mode, Hash: f.Hash}
+			seen[f.Name] = true
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	files := map[string]*verifiedFile{}
+	resolve := func(name, commit string, sig Signature) error {
+		entry := candidates[name]
+		delete(candidates, name)
+		file := &verifiedFile{Symlink: entry.Mode == filemode.Symlink, Commit: commit, Signature: sig}
+		if !entry.Hash.IsZero() {
+			blob, err := rev.Repository.BlobObject(entry.Hash)
+			if err != nil {
+				return err
+			}
+			if file.Content, err = blobContent(blob); err != nil {
+				return err
+			}
+		}
+		files[name] = file
+		return nil
+	}
+
+	commits, err := rev.Repository.Log(&git.LogOptions{From: rev.Commit.Hash})
+	if err != nil {
+		return nil, err
+	}
+	err = commits.ForEach(func(c *object.Commit) error {
+		sig := v.Check(c)
+		switch {
+		case sig.Status == SignatureBad:
+			return fmt.Errorf("importer: commit %s has a bad signature, %s may have been tampered with", c.Hash, rev.Source.URL)
+		case sig.Status != SignatureGood && v.Policy == PolicyRefuse:
+			return fmt.Errorf("importer: commit %s of %s is %s, refusing to import", c.Hash, rev.Source.URL, sig.Status)
+		}
+
+		changes, err := commitChanges(c)
+		if err != nil {
+			return err
+		}
+		for _, change := range changes {
+			name := change.To.Name
+			if name == "" {
+				name = change.From.Name
+			}
+			if !verifiedPath(name) {
+				continue
+			}
+			if !seen[name] {
+				// the last change of a file missing from the tip, which
+				// deleted it
+				seen[name] = true
+				if sig.Status == SignatureGood {
+					continue
+				}
+				log.Warnf("importer: quarantining the deletion of %s by %s commit %s", name, sig.Status, c.Hash)
+				candidates[name] = change.From.TreeEntry
+				continue
+			}
+			if _, ok := candidates[name]; !ok {
+				continue
+			}
+			if sig.Status == SignatureGood {
+				if err := resolve(name, c.Hash.String(), sig); err != nil {
+					return err
+				}
+				continue
+			}
+			log.Warnf("importer: quarantining the change of %s by %s commit %s", name, sig.Status, c.Hash)
+			// the file as it was before, which is resolved by an older commit
+			candidates[name] = change.From.TreeEntry
+			if change.From.Name == "" {
+				if err := resolve(name, "", sig); err != nil {
+					return err
+				}
+			}
+		}
+		if c.Hash == v.Since {
+			// the rest of the files are as of the parent of c
+			parent := c.Hash
+			if c.NumParents() > 0 {
+				parent = c.ParentHashes[0]
+			}
+			for name := range candidates {
+				if err := resolve(name, parent.String(), Signature{Status: SignatureTrusted}); err != nil {
+					return err
+				}
+			}
+			return storer.ErrStop
+		}
+		// deletions by untrusted commits are found by walking the whole
+		// history
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return files, nil
+}
+
+// readVerified returns the content of the file at name, rooted at "/", as of
+// its last trusted change, along with that change. Symlinks are followed
+// like readFile does, through their last trusted target. The file is nil if
+// no trusted commit added it.
+func (rev *Revision) readVerified(name string) (*verifiedFile, string, error) {
+	var file *verifiedFile
+	name, err := followLinks(name, func(name string) ([]byte, bool, error) {
+		file = rev.verified[strings.TrimPrefix(name, "/")]
+		if file == nil || file.Content == nil {
+			return nil, false, nil
+		}
+		return file.Content, file.Symlink, nil
+	})
+	if err != nil || file == nil || file.Content == nil {
+		return nil, name, err
+	}
+	return file, name, nil
+}
+
+// commitChanges returns the changes c made to its first parent.
+func commitChanges(c *object.Commit) (object.Changes, error) {
+	tree, err := c.Tree()
+	if err != nil {
+		return nil, err
+	}
+	var parent *object.Tree
+	if c.NumParents() > 0 {
+		p, err := c.Parent(0)
+		if err != nil {
+			return nil, err
+		}
+		if parent, err = p.Tree(); err != nil {
+			return nil, err
+		}
+	}
+	return object.DiffTree(parent, tree)
+}
+
+func blobContent(blob *object.Blob) ([]byte, error) {
+	f := object.NewFile("", 0, blob)
+	content, err := f.Contents()
+	return []byte(content), err
+}
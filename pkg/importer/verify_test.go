@@ -0,0 +1,80 @@
+package importer
+
+import (
+	"reflect"
+	"testing"
+
+	"golang.org/x/crypto/openpgp"
+)
+
+func newKey(t *testing.T, name string) *openpgp.Entity {
+	key, err := openpgp.NewEntity(name, "", name+"@example.org", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+func TestVerifyQuarantine(t *testing.T) {
+	trusted, untrusted := newKey(t, "trusted"), newKey(t, "untrusted")
+	v := &Verifier{Keyring: openpgp.EntityList{trusted}, Policy: PolicyQuarantine}
+
+	r := newTestRepo(t, "")
+	r.Write("unsorted/a.yaml", "name: a\n").
+		Write("unsorted/b.yaml", "name: b\n").
+		Link("tagged/market/a.yaml", "../../unsorted/a.yaml").
+		Link("tagged/forum/b.yaml", "../../unsorted/b.yaml")
+	r.Commit("add a and b", trusted)
+	// untrusted changes: editing a, retagging b, adding c, deleting a
+	// tag and a service
+	r.Write("unsorted/a.yaml", "name: a\ndescription: scam\n").
+		Link("tagged/market/b.yaml", "../../unsorted/b.yaml").
+		Write("unsorted/c.yaml", "name: c\n").
+		Link("tagged/market/c.yaml", "../../unsorted/c.yaml")
+	r.Commit("untrusted changes", untrusted)
+	r.Remove("tagged/forum/b.yaml")
+	r.Remove("tagged/market/a.yaml").Remove("unsorted/a.yaml")
+	tip := r.Commit("untrusted deletions", nil)
+
+	rev := r.Revision(tip)
+	if err := rev.Verify(v); err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string][]string{"a": {"market"}, "b": {"forum"}}
+	if tags := serviceTags(t, rev); !reflect.DeepEqual(tags, expected) {
+		t.Errorf("tags = %v, expected %v", tags, expected)
+	}
+	if content := string(rev.verified["unsorted/a.yaml"].Content); content != "name: a\n" {
+		t.Errorf("unsorted/a.yaml = %q, expected its trusted content", content)
+	}
+
+	// a trusted deletion is imported
+	r.Write("unsorted/d.yaml", "name: d\n").Link("tagged/forum/d.yaml", "../../unsorted/d.yaml")
+	r.Commit("add d", trusted)
+	r.Remove("tagged/forum/d.yaml")
+	tip = r.Commit("untag d", trusted)
+	rev = r.Revision(tip)
+	if err := rev.Verify(v); err != nil {
+		t.Fatal(err)
+	}
+	if tags := serviceTags(t, rev); !reflect.DeepEqual(tags, expected) {
+		t.Errorf("tags = %v, expected %v", tags, expected)
+	}
+}
+
+func TestVerifyRefuse(t *testing.T) {
+	trusted := newKey(t, "trusted")
+	v := &Verifier{Keyring: openpgp.EntityList{trusted}, Policy: PolicyRefuse}
+
+	r := newTestRepo(t, "")
+	r.Write("unsorted/a.yaml", "name: a\n").Link("tagged/market/a.yaml", "../../unsorted/a.yaml")
+	tip := r.Commit("add a", trusted)
+	if err := r.Revision(tip).Verify(v); err != nil {
+		t.Fatal(err)
+	}
+	r.Remove("tagged/market/a.yaml")
+	tip = r.Commit("unsigned", nil)
+	if err := r.Revision(tip).Verify(v); err == nil {
+		t.Error("an unsigned commit was accepted")
+	}
+}
@@ -0,0 +1,256 @@
+package importer
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/blevesearch/bleve"
+	"github.com/fsnotify/fsnotify"
+	"github.com/goccy/go-yaml"
+	"github.com/gosimple/slug"
+	"github.com/jinzhu/gorm"
+	"github.com/onionltd/oniontree-tools/pkg/types/service"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/x0rzkov/oniontree-backend/pkg/search"
+)
+
+// DefaultDebounce is how long the files of a Watcher settle by default.
+const DefaultDebounce = 500 * time.Millisecond
+
+// Watcher imports the changes of a local checkout of the repository as they
+// are made. Services are identified by the name of their file in unsorted/,
+// and are tagged by the links to it in tagged/, like Directory imports them.
+type Watcher struct {
+	Importer *Importer
+	Root     string
+	// Debounce is how long files settle before their changes are imported.
+	Debounce time.Duration
+	// Index is kept up to date along with the database if not nil.
+	Index bleve.Index
+
+	// slugs are the slugs of the services imported from the files of
+	// unsorted/, by file name without extension
+	slugs   map[string]string
+	watcher *fsnotify.Watcher
+}
+
+// NewWatcher returns a Watcher of the checkout at root, writing to db.
+func NewWatcher(db *gorm.DB, root string) *Watcher {
+	return &Watcher{Importer: New(db), Root: root, Debounce: DefaultDebounce}
+}
+
+// Start watches unsorted/ and the directories of tagged/ until Close is
+// called.
+func (w *Watcher) Start() error {
+	var err error
+	if w.watcher, err = fsnotify.NewWatcher(); err != nil {
+		return err
+	}
+	w.slugs = map[string]string{}
+	unsorted, err := filepath.Glob(filepath.Join(w.Root, "unsorted", "*.yaml"))
+	if err != nil {
+		return err
+	}
+	for _, name := range unsorted {
+		file := fileName(name)
+		if e, err := w.read(file); err == nil && e != nil {
+			w.slugs[file] = slug.Make(e.Name)
+		}
+	}
+	for _, dir := range append([]string{filepath.Join(w.Root, "unsorted"), filepath.Join(w.Root, "tagged")}, w.tags()...) {
+		if err := w.watcher.Add(dir); err != nil {
+			w.watcher.Close()
+			return err
+		}
+	}
+	go w.loop()
+	log.Infof("importer: watching %s", w.Root)
+	return nil
+}
+
+// Close stops watching.
+func (w *Watcher) Close() error {
+	return w.watcher.Close()
+}
+
+func (w *Watcher) loop() {
+	changed := map[string]bool{}
+	var settled <-chan time.Time
+	for {
+		select {
+		case event, ok := <-w.watcher.Events:
+			if !ok {
+				return
+			}
+			for _, file := range w.affected(event) {
+				changed[file] = true
+			}
+			if len(changed) > 0 {
+				settled = time.After(w.Debounce)
+			}
+		case err, ok := <-w.watcher.Errors:
+			if !ok {
+				return
+			}
+			log.Errorf("importer: watching %s: %s", w.Root, err)
+		case <-settled:
+			for file := range changed {
+				if err := w.update(file); err != nil {
+					log.Errorf("importer: importing %s: %s", file, err)
+				}
+			}
+			changed, settled = map[string]bool{}, nil
+		}
+	}
+}
+
+// affected returns the files whose services event may have changed. A tag
+// which is added or removed affects every file.
+func (w *Watcher) affected(event fsnotify.Event) []string {
+	dir, base := filepath.Dir(event.Name), filepath.Base(event.Name)
+	if strings.HasPrefix(base, ".") {
+		return nil
+	}
+	tagged := filepath.Join(w.Root, "tagged")
+	if dir == tagged {
+		if event.Op&fsnotify.Create != 0 {
+			if info, err := os.Stat(event.Name); err == nil && info.IsDir() {
+				if err := w.watcher.Add(event.Name); err != nil {
+					log.Errorf("importer: watching %s: %s", event.Name, err)
+				}
+			}
+		}
+		var files []string
+		for file := range w.slugs {
+			files = append(files, file)
+		}
+		// a new tag directory may link to files which weren't imported
+		for _, name := range w.files(event.Name) {
+			files = append(files, name)
+		}
+		return files
+	}
+	if filepath.Ext(base) != ".yaml" {
+		return nil
+	}
+	if dir == filepath.Join(w.Root, "unsorted") || filepath.Dir(dir) == tagged {
+		return []string{fileName(base)}
+	}
+	return nil
+}
+
+// update imports the changes of the service of file, which may have been
+// renamed, deleted, tagged or untagged.
+func (w *Watcher) update(file string) error {
+	e, err := w.read(file)
+	if err != nil {
+		// the file may be in the middle of an edit
+		log.Warnf("importer: skipping %s: %s", file, err)
+		return nil
+	}
+	after := Snapshot{}
+	keys := []string{w.slugs[file]}
+	if e != nil {
+		key := slug.Make(e.Name)
+		after[key] = e
+		keys = append(keys, key)
+	}
+	before, err := DBSnapshot(w.Importer.DB.Where("slug IN (?)", keys))
+	if err != nil {
+		return err
+	}
+	changes := Compare(before, after)
+	if err := w.Importer.Apply(changes); err != nil {
+		return err
+	}
+	if e != nil {
+		w.slugs[file] = slug.Make(e.Name)
+	} else {
+		delete(w.slugs, file)
+	}
+	for _, c := range changes {
+		log.Infof("importer: %s %s from %s", c.Action, c.Slug, file)
+		if w.Index == nil {
+			continue
+		}
+		if c.After == nil {
+			err = w.Index.Delete(c.Slug)
+		} else {
+			err = w.Index.Index(c.Slug, document(c.After))
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// read returns the service of file along with the tags linking to it, nil
+// if the file was deleted or isn't tagged.
+func (w *Watcher) read(file string) (*Entry, error) {
+	content, err := ioutil.ReadFile(filepath.Join(w.Root, "unsorted", file+".yaml"))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	svc := service.Service{}
+	if err := yaml.Unmarshal(content, &svc); err != nil {
+		return nil, err
+	}
+	e := &Entry{Service: svc}
+	for _, tag := range w.tags() {
+		// broken links don't tag
+		if _, err := os.Stat(filepath.Join(tag, file+".yaml")); err == nil {
+			e.Tags = append(e.Tags, filepath.Base(tag))
+		}
+	}
+	if len(e.Tags) == 0 {
+		return nil, nil
+	}
+	e.normalize()
+	return e, nil
+}
+
+// tags returns the directories of tagged/.
+func (w *Watcher) tags() []string {
+	var dirs []string
+	infos, err := ioutil.ReadDir(filepath.Join(w.Root, "tagged"))
+	if err != nil {
+		return nil
+	}
+	for _, info := range infos {
+		if info.IsDir() {
+			dirs = append(dirs, filepath.Join(w.Root, "tagged", info.Name()))
+		}
+	}
+	return dirs
+}
+
+// files returns the names of the services linked from dir.
+func (w *Watcher) files(dir string) []string {
+	var files []string
+	names, _ := filepath.Glob(filepath.Join(dir, "*.yaml"))
+	for _, name := range names {
+		files = append(files, fileName(name))
+	}
+	return files
+}
+
+func fileName(name string) string {
+	return strings.TrimSuffix(filepath.Base(name), ".yaml")
+}
+
+// document returns the search document of e.
+func document(e *Entry) *search.Service {
+	doc := search.FromService(e.Service, false)
+	for _, tag := range e.Tags {
+		doc.Tags = append(doc.Tags, &search.Tag{Name: tag})
+	}
+	return doc
+}
@@ -0,0 +1,197 @@
+package importer
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/blevesearch/bleve"
+
+	"github.com/x0rzkov/oniontree-backend/pkg/models"
+	"github.com/x0rzkov/oniontree-backend/pkg/search"
+)
+
+// testCheckout is a local checkout of the repository watched by a Watcher.
+type testCheckout struct {
+	t    *testing.T
+	Root string
+}
+
+func newTestCheckout(t *testing.T) *testCheckout {
+	root, err := ioutil.TempDir("", "oniontree")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, dir := range []string{"unsorted", "tagged"} {
+		if err := os.Mkdir(filepath.Join(root, dir), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return &testCheckout{t: t, Root: root}
+}
+
+func (c *testCheckout) Write(name, content string) {
+	if err := ioutil.WriteFile(filepath.Join(c.Root, "unsorted", name+".yaml"), []byte(content), 0644); err != nil {
+		c.t.Fatal(err)
+	}
+}
+
+// Tag links the service name from the directory of tag, created if needed.
+func (c *testCheckout) Tag(name, tag string) {
+	dir := filepath.Join(c.Root, "tagged", tag)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		c.t.Fatal(err)
+	}
+	if err := os.Symlink(filepath.Join("..", "..", "unsorted", name+".yaml"), filepath.Join(dir, name+".yaml")); err != nil {
+		c.t.Fatal(err)
+	}
+}
+
+func (c *testCheckout) Untag(name, tag string) {
+	if err := os.Remove(filepath.Join(c.Root, "tagged", tag, name+".yaml")); err != nil {
+		c.t.Fatal(err)
+	}
+}
+
+// startWatcher imports the checkout c and watches it, keeping an index up
+// to date.
+func startWatcher(t *testing.T, c *testCheckout, debounce time.Duration) *Watcher {
+	db := openDB(t)
+	if err := New(db).Directory(c.Root); err != nil {
+		t.Fatal(err)
+	}
+	services, err := search.FromDirectory(c.Root, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := NewWatcher(db, c.Root)
+	w.Debounce = debounce
+	if w.Index, err = search.NewMemOnly(services); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Start(); err != nil {
+		t.Fatal(err)
+	}
+	return w
+}
+
+// tags returns the tags of the service key in the database and in the
+// index of w, nil if it isn't there, and its number of rows.
+func tags(t *testing.T, w *Watcher, key string) (db, index []string, rows int) {
+	var services []models.Service
+	if err := w.Importer.DB.Preload("Tags").Where("slug = ?", key).Find(&services).Error; err != nil {
+		t.Fatal(err)
+	}
+	for _, svc := range services {
+		db = []string{}
+		for _, tag := range svc.Tags {
+			db = append(db, tag.Name)
+		}
+		sort.Strings(db)
+	}
+
+	req := bleve.NewSearchRequest(bleve.NewDocIDQuery([]string{key}))
+	req.Fields = []string{"tags.name"}
+	res, err := w.Index.Search(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, hit := range res.Hits {
+		index = []string{}
+		switch names := hit.Fields["tags.name"].(type) {
+		case string:
+			index = append(index, names)
+		case []interface{}:
+			for _, name := range names {
+				index = append(index, fmt.Sprint(name))
+			}
+		}
+		sort.Strings(index)
+	}
+	return db, index, len(services)
+}
+
+// waitTags waits for the service key to have the tags expected, nil for
+// none, in a single row of the database and in the index of w.
+func waitTags(t *testing.T, w *Watcher, key string, expected []string) {
+	t.Helper()
+	var (
+		db, index []string
+		rows      int
+	)
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(20 * time.Millisecond) {
+		db, index, rows = tags(t, w, key)
+		if rows <= 1 && reflect.DeepEqual(db, expected) && reflect.DeepEqual(index, expected) {
+			return
+		}
+	}
+	t.Fatalf("tags of %s = %q in %d rows of the database and %q in the index, expected %q", key, db, rows, index, expected)
+}
+
+func TestWatcherTags(t *testing.T) {
+	c := newTestCheckout(t)
+	defer os.RemoveAll(c.Root)
+	// a service in two tags, imported as several rows
+	c.Write("a", "name: a\nurls:\n- http://a.onion\n")
+	c.Tag("a", "forum")
+	c.Tag("a", "market")
+	w := startWatcher(t, c, 10*time.Millisecond)
+	defer w.Close()
+
+	c.Untag("a", "market")
+	waitTags(t, w, "a", []string{"forum"})
+
+	c.Tag("a", "market")
+	waitTags(t, w, "a", []string{"forum", "market"})
+
+	// a new tag directory
+	c.Tag("a", "shop")
+	waitTags(t, w, "a", []string{"forum", "market", "shop"})
+
+	for _, tag := range []string{"forum", "market", "shop"} {
+		c.Untag("a", tag)
+	}
+	waitTags(t, w, "a", nil)
+}
+
+func TestWatcherDebounce(t *testing.T) {
+	c := newTestCheckout(t)
+	defer os.RemoveAll(c.Root)
+	c.Write("a", "name: a\nurls:\n- http://a.onion\n")
+	c.Tag("a", "market")
+	const debounce = time.Second
+	w := startWatcher(t, c, debounce)
+	defer w.Close()
+
+	// an edit in several writes, the first of which isn't valid
+	start := time.Now()
+	c.Write("a", "name: [")
+	c.Write("a", "name: a\ndescription: edited\nurls:\n- http://a.onion\n")
+	c.Tag("a", "forum")
+
+	var svc models.Service
+	for {
+		if err := w.Importer.DB.Where("slug = ?", "a").First(&svc).Error; err != nil {
+			t.Fatal(err)
+		}
+		if svc.Description != "" {
+			break
+		}
+		if time.Since(start) > 5*time.Second {
+			t.Fatal("the edit wasn't imported")
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	if elapsed := time.Since(start); elapsed < debounce {
+		t.Errorf("the edit was imported after %s, before the files settled", elapsed)
+	}
+	if svc.Description != "edited" {
+		t.Errorf("description = %q, expected edited", svc.Description)
+	}
+	waitTags(t, w, "a", []string{"forum", "market"})
+}
@@ -0,0 +1,111 @@
+package lint
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/goccy/go-yaml"
+	"github.com/onionltd/oniontree-tools/pkg/types/service"
+
+	"github.com/x0rzkov/oniontree-backend/pkg/submission"
+)
+
+// Problem is something wrong with a file of the repository.
+type Problem struct {
+	Path    string
+	Message string
+}
+
+func (p Problem) String() string {
+	return p.Path + ": " + p.Message
+}
+
+// Directory checks a local checkout of the repository: every service of
+// unsorted/ must parse, have a name and onion URLs no other service has,
+// and public keys that parse, and every entry of tagged/ must link to a
+// service of unsorted/.
+func Directory(root string) ([]Problem, error) {
+	var problems []Problem
+	report := func(path, format string, args ...interface{}) {
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			rel = path
+		}
+		problems = append(problems, Problem{Path: rel, Message: fmt.Sprintf(format, args...)})
+	}
+
+	unsorted := filepath.Join(root, "unsorted")
+	files, err := ioutil.ReadDir(unsorted)
+	if err != nil {
+		return nil, err
+	}
+	urls := map[string]string{}
+	for _, fi := range files {
+		path := filepath.Join(unsorted, fi.Name())
+		if fi.IsDir() || filepath.Ext(path) != ".yaml" {
+			report(path, "not a service file")
+			continue
+		}
+		bytes, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		s := service.Service{}
+		if err := yaml.Unmarshal(bytes, &s); err != nil {
+			report(path, "invalid YAML: %s", err)
+			continue
+		}
+		if strings.TrimSpace(s.Name) == "" {
+			report(path, "name is missing")
+		}
+		if len(s.URLs) == 0 {
+			report(path, "no URLs")
+		}
+		for _, url := range s.URLs {
+			if !submission.IsOnionURL(url) {
+				report(path, "%q is not an onion URL", url)
+			}
+			if other, ok := urls[url]; ok {
+				report(path, "%q is also a URL of %s", url, other)
+			}
+			urls[url] = fi.Name()
+		}
+		for _, publicKey := range s.PublicKeys {
+			if _, err := service.ParseKey([]byte(publicKey.Value)); err != nil {
+				report(path, "public key %s doesn't parse: %s", publicKey.ID, err)
+			}
+		}
+	}
+
+	tagged := filepath.Join(root, "tagged")
+	err = filepath.Walk(tagged, func(path string, fi os.FileInfo, err error) error {
+		if err != nil || fi.IsDir() {
+			return err
+		}
+		if fi.Mode()&os.ModeSymlink == 0 {
+			report(path, "not a link to a service of unsorted/")
+			return nil
+		}
+		target, err := filepath.EvalSymlinks(path)
+		if err != nil {
+			report(path, "broken link")
+			return nil
+		}
+		if dir, err := filepath.EvalSymlinks(unsorted); err == nil && filepath.Dir(target) != dir {
+			report(path, "links outside of unsorted/")
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.SliceStable(problems, func(i, j int) bool {
+		return problems[i].Path < problems[j].Path
+	})
+	return problems, nil
+}
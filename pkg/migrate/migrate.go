@@ -0,0 +1,160 @@
+package migrate
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	log "github.com/sirupsen/logrus"
+)
+
+// Migration is a numbered step of the schema. Down undoes Up.
+type Migration struct {
+	Version uint
+	Name    string
+	Up      func(db *gorm.DB) error
+	Down    func(db *gorm.DB) error
+}
+
+// SchemaMigration records an applied migration.
+type SchemaMigration struct {
+	Version   uint `gorm:"primary_key;auto_increment:false"`
+	Name      string
+	AppliedAt time.Time
+}
+
+// TableName implements gorm's tabler.
+func (SchemaMigration) TableName() string {
+	return "schema_migrations"
+}
+
+// Status tells whether a migration is applied.
+type Status struct {
+	Migration
+	Applied   bool
+	AppliedAt time.Time
+}
+
+// Migrator applies and reverts migrations, each in its own transaction.
+type Migrator struct {
+	DB         *gorm.DB
+	Migrations []Migration
+}
+
+// New returns a Migrator of db with the migrations of the application.
+func New(db *gorm.DB) *Migrator {
+	return &Migrator{DB: db, Migrations: Migrations}
+}
+
+func (m *Migrator) sorted() []Migration {
+	migrations := append([]Migration(nil), m.Migrations...)
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+	return migrations
+}
+
+func (m *Migrator) applied() (map[uint]SchemaMigration, error) {
+	if err := m.DB.AutoMigrate(&SchemaMigration{}).Error; err != nil {
+		return nil, err
+	}
+	var records []SchemaMigration
+	if err := m.DB.Find(&records).Error; err != nil {
+		return nil, err
+	}
+	applied := map[uint]SchemaMigration{}
+	for _, r := range records {
+		applied[r.Version] = r
+	}
+	return applied, nil
+}
+
+// Status lists every migration, in order, and whether it is applied.
+func (m *Migrator) Status() ([]Status, error) {
+	applied, err := m.applied()
+	if err != nil {
+		return nil, err
+	}
+	var statuses []Status
+	for _, migration := range m.sorted() {
+		r, ok := applied[migration.Version]
+		statuses = append(statuses, Status{Migration: migration, Applied: ok, AppliedAt: r.AppliedAt})
+	}
+	return statuses, nil
+}
+
+// Up applies the pending migrations up to version to, or all of them when
+// to is 0, and returns the ones it applied.
+func (m *Migrator) Up(to uint) ([]Migration, error) {
+	applied, err := m.applied()
+	if err != nil {
+		return nil, err
+	}
+	var done []Migration
+	for _, migration := range m.sorted() {
+		if to != 0 && migration.Version > to {
+			break
+		}
+		if _, ok := applied[migration.Version]; ok {
+			continue
+		}
+		err := m.run(migration, migration.Up, func(tx *gorm.DB) error {
+			return tx.Create(&SchemaMigration{
+				Version:   migration.Version,
+				Name:      migration.Name,
+				AppliedAt: time.Now(),
+			}).Error
+		})
+		if err != nil {
+			return done, err
+		}
+		log.Infof("migrate: applied %d %s", migration.Version, migration.Name)
+		done = append(done, migration)
+	}
+	return done, nil
+}
+
+// Down reverts the last steps applied migrations and returns the ones it
+// reverted.
+func (m *Migrator) Down(steps int) ([]Migration, error) {
+	applied, err := m.applied()
+	if err != nil {
+		return nil, err
+	}
+	migrations := m.sorted()
+	var done []Migration
+	for i := len(migrations) - 1; i >= 0 && len(done) < steps; i-- {
+		migration := migrations[i]
+		if _, ok := applied[migration.Version]; !ok {
+			continue
+		}
+		err := m.run(migration, migration.Down, func(tx *gorm.DB) error {
+			return tx.Delete(&SchemaMigration{Version: migration.Version}).Error
+		})
+		if err != nil {
+			return done, err
+		}
+		log.Infof("migrate: reverted %d %s", migration.Version, migration.Name)
+		done = append(done, migration)
+	}
+	return done, nil
+}
+
+func (m *Migrator) run(migration Migration, step, record func(*gorm.DB) error) error {
+	tx := m.DB.Begin()
+	if tx.Error != nil {
+		return tx.Error
+	}
+	if step != nil {
+		if err := step(tx); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("migrate: %d %s: %s", migration.Version, migration.Name, err)
+		}
+	}
+	if err := record(tx); err != nil {
+		tx.Rollback()
+		return fmt.Errorf("migrate: %d %s: %s", migration.Version, migration.Name, err)
+	}
+	return tx.Commit().Error
+}
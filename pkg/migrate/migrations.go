@@ -0,0 +1,398 @@
+package migrate
+
+import (
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+// Migrations of the application, in order. Applied migrations must not be
+// changed, add a new one instead.
+var Migrations = []Migration{
+	{
+		// The dataset tables as AutoMigrate used to create them, so that
+		// existing databases are picked up as they are.
+		Version: 1,
+		Name:    "create dataset tables",
+		Up: func(db *gorm.DB) error {
+			return db.AutoMigrate(&baselineTag{}, &baselineService{}, &baselineURL{}, &baselinePublicKey{}).Error
+		},
+		Down: func(db *gorm.DB) error {
+			return db.DropTableIfExists("service_tags", "urls", "public_keys", "services", "tags").Error
+		},
+	},
+	{
+		// Tables of webhooks, submissions, abuse reports, users and audit
+		// events, which were also created by AutoMigrate.
+		Version: 2,
+		Name:    "create application tables",
+		Up: func(db *gorm.DB) error {
+			return db.AutoMigrate(applicationTables()...).Error
+		},
+		Down: func(db *gorm.DB) error {
+			return db.DropTableIfExists(applicationTables()...).Error
+		},
+	},
+	{
+		// Long values are text rather than varchar(255), which only matters
+		// outside of SQLite, and tags, URLs and public keys are indexed.
+		Version: 3,
+		Name:    "portable dataset columns",
+		Up: func(db *gorm.DB) error {
+			if err := modifyColumns(db, "text"); err != nil {
+				return err
+			}
+			for _, err := range []error{
+				db.Table("tags").AddUniqueIndex("idx_tags_name", "name").Error,
+				db.Table("urls").AddUniqueIndex("idx_urls_name", "name").Error,
+				db.Table("public_keys").AddIndex("idx_public_keys_uid", "uid").Error,
+			} {
+				if err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+		Down: func(db *gorm.DB) error {
+			for _, err := range []error{
+				db.Table("tags").RemoveIndex("idx_tags_name").Error,
+				db.Table("urls").RemoveIndex("idx_urls_name").Error,
+				db.Table("public_keys").RemoveIndex("idx_public_keys_uid").Error,
+			} {
+				if err != nil {
+					return err
+				}
+			}
+			return modifyColumns(db, "varchar(255)")
+		},
+	},
+	{
+		// The commit every import of the dataset was made from.
+		Version: 4,
+		Name:    "create dataset imports",
+		Up: func(db *gorm.DB) error {
+			return db.AutoMigrate(&datasetImport{}).Error
+		},
+		Down: func(db *gorm.DB) error {
+			return db.DropTableIfExists(&datasetImport{}).Error
+		},
+	},
+	{
+		// Timelines of services from the history of the dataset.
+		Version: 5,
+		Name:    "create service revisions",
+		Up: func(db *gorm.DB) error {
+			return db.AutoMigrate(&serviceRevision{}).Error
+		},
+		Down: func(db *gorm.DB) error {
+			return db.DropTableIfExists(&serviceRevision{}).Error
+		},
+	},
+	{
+		// The commit services were imported from and who signed it.
+		Version: 6,
+		Name:    "add commit signers",
+		Up: func(db *gorm.DB) error {
+			return db.AutoMigrate(&signerService{}, &signerRevision{}).Error
+		},
+		Down: func(db *gorm.DB) error {
+			// SQLite can't drop columns before 3.35, the columns are
+			// left unused.
+			if db.Dialect().GetName() == "sqlite3" {
+				return nil
+			}
+			for _, err := range []error{
+				db.Table("services").DropColumn("commit_hash").Error,
+				db.Table("services").DropColumn("signer").Error,
+				db.Table("service_revisions").DropColumn("signer").Error,
+			} {
+				if err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	},
+	{
+		// Changes pulled from upstream, waiting for approval.
+		Version: 7,
+		Name:    "create dataset updates",
+		Up: func(db *gorm.DB) error {
+			return db.AutoMigrate(&datasetUpdate{}).Error
+		},
+		Down: func(db *gorm.DB) error {
+			return db.DropTableIfExists(&datasetUpdate{}).Error
+		},
+	},
+	{
+		// When URLs were last checked, to tell the ones never checked from
+		// the unhealthy ones. Healthy URLs were checked, when is unknown.
+		Version: 8,
+		Name:    "add URL checks",
+		Up: func(db *gorm.DB) error {
+			if err := db.AutoMigrate(&checkedURL{}).Error; err != nil {
+				return err
+			}
+			return db.Table("urls").Where("healthy = ?", true).UpdateColumn("checked_at", gorm.Expr("updated_at")).Error
+		},
+		Down: func(db *gorm.DB) error {
+			if db.Dialect().GetName() == "sqlite3" {
+				return nil
+			}
+			return db.Table("urls").DropColumn("checked_at").Error
+		},
+	},
+	{
+		// Bulk updates and deletes are recorded as one audit event with
+		// their conditions and the number of rows they changed.
+		Version: 9,
+		Name:    "add bulk audit events",
+		Up: func(db *gorm.DB) error {
+			return db.AutoMigrate(&bulkAuditEvent{}).Error
+		},
+		Down: func(db *gorm.DB) error {
+			if db.Dialect().GetName() == "sqlite3" {
+				return nil
+			}
+			for _, column := range []string{"conditions", "rows_affected"} {
+				if err := db.Table("audit_events").DropColumn(column).Error; err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	},
+}
+
+func applicationTables() []interface{} {
+	return []interface{}{
+		&applicationWebhook{},
+		&applicationDelivery{},
+		&applicationSubmission{},
+		&applicationAbuseReport{},
+		&applicationUser{},
+		&applicationAuditEvent{},
+	}
+}
+
+// modifyColumns changes the type of the long dataset columns. SQLite doesn't
+// enforce column sizes, nor can it alter columns.
+func modifyColumns(db *gorm.DB, typ string) error {
+	if db.Dialect().GetName() == "sqlite3" {
+		return nil
+	}
+	for table, columns := range map[string][]string{
+		"services":    {"description"},
+		"public_keys": {"description", "value"},
+	} {
+		for _, column := range columns {
+			if err := db.Table(table).ModifyColumn(column, typ).Error; err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+type baselineTag struct {
+	gorm.Model
+	Name string `gorm:"size:32;unique"`
+}
+
+func (baselineTag) TableName() string { return "tags" }
+
+type baselineService struct {
+	gorm.Model
+	Name        string
+	Slug        string
+	Description string
+	Tags        []*baselineTag `gorm:"many2many:service_tags;association_foreignkey:ID;foreignkey:ID;jointable_foreignkey:service_id;association_jointable_foreignkey:tag_id"`
+}
+
+func (baselineService) TableName() string { return "services" }
+
+type baselineURL struct {
+	gorm.Model
+	Name      string `gorm:"size:255;unique"`
+	Healthy   bool
+	ServiceID uint
+}
+
+func (baselineURL) TableName() string { return "urls" }
+
+type baselinePublicKey struct {
+	gorm.Model
+	UID         string
+	UserID      string
+	Fingerprint string
+	Description string
+	Value       string
+	ServiceID   uint
+}
+
+func (baselinePublicKey) TableName() string { return "public_keys" }
+
+type signerService struct {
+	ID         uint   `gorm:"primary_key"`
+	CommitHash string `gorm:"size:40"`
+	Signer     string
+}
+
+func (signerService) TableName() string { return "services" }
+
+type signerRevision struct {
+	ID     uint `gorm:"primary_key"`
+	Signer string
+}
+
+func (signerRevision) TableName() string { return "service_revisions" }
+
+type applicationWebhook struct {
+	gorm.Model
+	Name   string
+	URL    string `gorm:"size:255"`
+	Secret string
+	Events string
+	Active bool
+}
+
+func (applicationWebhook) TableName() string { return "webhooks" }
+
+type applicationDelivery struct {
+	gorm.Model
+	WebhookID     uint
+	Event         string
+	Payload       string `gorm:"type:text"`
+	Attempts      int
+	StatusCode    int
+	Response      string `gorm:"type:text"`
+	Error         string `gorm:"type:text"`
+	Delivered     bool
+	NextAttemptAt *time.Time
+}
+
+func (applicationDelivery) TableName() string { return "deliveries" }
+
+type applicationSubmission struct {
+	gorm.Model
+	Name        string
+	Description string `gorm:"type:text"`
+	URLs        string `gorm:"type:text"`
+	Tags        string
+	PublicKey   string `gorm:"type:text"`
+	Contact     string
+	Status      string `gorm:"size:16;index"`
+	Reason      string `gorm:"type:text"`
+	ServiceID   uint
+	ReviewedAt  *time.Time
+}
+
+func (applicationSubmission) TableName() string { return "submissions" }
+
+type applicationAbuseReport struct {
+	gorm.Model
+	ServiceID  uint
+	Category   string `gorm:"size:16"`
+	Details    string `gorm:"type:text"`
+	Contact    string
+	State      string `gorm:"size:16;index"`
+	Notes      string `gorm:"type:text"`
+	Assignee   string
+	ResolvedAt *time.Time
+}
+
+func (applicationAbuseReport) TableName() string { return "abuse_reports" }
+
+type applicationUser struct {
+	gorm.Model
+	Name         string `gorm:"size:64;unique_index"`
+	PasswordHash string
+	Role         string `gorm:"size:16"`
+	Disabled     bool
+}
+
+func (applicationUser) TableName() string { return "users" }
+
+type applicationAuditEvent struct {
+	ID         uint      `gorm:"primary_key"`
+	CreatedAt  time.Time `gorm:"index"`
+	Actor      string    `gorm:"size:64;index"`
+	Origin     string    `gorm:"size:16;index"`
+	Resource   string    `gorm:"size:64;index:idx_audit_events_resource"`
+	ResourceID string    `gorm:"size:64;index:idx_audit_events_resource"`
+	Action     string    `gorm:"size:16;index"`
+	Before     string    `gorm:"type:text"`
+	After      string    `gorm:"type:text"`
+	Diff       string    `gorm:"type:text"`
+}
+
+func (applicationAuditEvent) TableName() string { return "audit_events" }
+
+type datasetImport struct {
+	ID          uint      `gorm:"primary_key"`
+	CreatedAt   time.Time `gorm:"index"`
+	Source      string
+	Revision    string `gorm:"size:255"`
+	CommitHash  string `gorm:"size:40;index"`
+	CommittedAt *time.Time
+	Author      string
+	Subject     string `gorm:"type:text"`
+	Services    int
+}
+
+func (datasetImport) TableName() string { return "dataset_imports" }
+
+// serviceRevision is without the signer, added by version 6.
+type serviceRevision struct {
+	ID          uint   `gorm:"primary_key"`
+	CommitHash  string `gorm:"size:40;unique_index:idx_service_revisions_commit_path"`
+	Path        string `gorm:"size:255;unique_index:idx_service_revisions_commit_path"`
+	File        string `gorm:"size:255;index"`
+	Slug        string `gorm:"size:255;index"`
+	Action      string `gorm:"size:16"`
+	Author      string
+	AuthorEmail string
+	CommittedAt time.Time `gorm:"index"`
+	Subject     string    `gorm:"type:text"`
+	Signature   string    `gorm:"size:16"`
+	Diff        string    `gorm:"type:text"`
+}
+
+func (serviceRevision) TableName() string { return "service_revisions" }
+
+type datasetUpdate struct {
+	ID          uint      `gorm:"primary_key"`
+	CreatedAt   time.Time `gorm:"index"`
+	Source      string
+	Revision    string `gorm:"size:255"`
+	ImportID    uint
+	BaseCommit  string `gorm:"size:40"`
+	CommitHash  string `gorm:"size:40;index"`
+	CommittedAt *time.Time
+	Author      string
+	Subject     string `gorm:"type:text"`
+	Added       int
+	Modified    int
+	Deleted     int
+	Services    int
+	Changes     string `gorm:"type:text"`
+	Status      string `gorm:"size:16;index"`
+	ReviewedAt  *time.Time
+}
+
+func (datasetUpdate) TableName() string { return "dataset_updates" }
+
+type checkedURL struct {
+	ID        uint `gorm:"primary_key"`
+	CheckedAt *time.Time
+}
+
+func (checkedURL) TableName() string { return "urls" }
+
+type bulkAuditEvent struct {
+	ID           uint   `gorm:"primary_key"`
+	Conditions   string `gorm:"type:text"`
+	RowsAffected int64
+}
+
+func (bulkAuditEvent) TableName() string { return "audit_events" }
@@ -0,0 +1,56 @@
+package models
+
+import (
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+// Tables lists every model owned by this package, in creation order.
+var Tables = []interface{}{
+	&Tag{},
+	&Service{},
+	&PublicKey{},
+	&URL{},
+}
+
+// Create a GORM-backend model
+type Tag struct {
+	gorm.Model
+	Name string `gorm:"size:32;unique_index" json:"name" yaml:"name"`
+}
+
+type Service struct {
+	gorm.Model
+	Name        string       `json:"name" yaml:"name"`
+	Slug        string       `json:"slug,omitempty" yaml:"slug,omitempty"`
+	Description string       `gorm:"type:text" json:"description,omitempty" yaml:"description,omitempty"`
+	URLs        []*URL       `json:"urls,omitempty" yaml:"urls,omitempty"`
+	PublicKeys  []*PublicKey `json:"public_keys,omitempty" yaml:"public_keys,omitempty"`
+	Tags        []*Tag       `gorm:"many2many:service_tags;" json:"tags,omitempty" yaml:"tags,omitempty"`
+	// CommitHash is the upstream commit the service was imported from, and
+	// Signer the trusted contributor who signed it, when signatures are
+	// verified.
+	CommitHash string `gorm:"size:40" json:"commit,omitempty" yaml:"-"`
+	Signer     string `json:"signer,omitempty" yaml:"-"`
+}
+
+type URL struct {
+	gorm.Model
+	Name      string `gorm:"size:255;unique_index" json:"href" yaml:"href"`
+	Healthy   bool   `json:"healthy" yaml:"healthy"`
+	ServiceID uint   `json:"-" yaml:"-"`
+	// CheckedAt is when the checker last checked the URL, nil if it never
+	// did, in which case Healthy means nothing.
+	CheckedAt *time.Time `json:"-" yaml:"-"`
+}
+
+type PublicKey struct {
+	gorm.Model
+	UID         string `gorm:"size:64;index" json:"id,omitempty" yaml:"id,omitempty"`
+	UserID      string `json:"user_id,omitempty" yaml:"user_id,omitempty"`
+	Fingerprint string `json:"fingerprint,omitempty" yaml:"fingerprint,omitempty"`
+	Description string `gorm:"type:text" json:"description,omitempty" yaml:"description,omitempty"`
+	Value       string `gorm:"type:text" json:"value" yaml:"value"`
+	ServiceID   uint   `json:"-" yaml:"-"`
+}
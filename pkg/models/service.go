@@ -0,0 +1,49 @@
+package models
+
+import (
+	"github.com/gosimple/slug"
+	"github.com/jinzhu/gorm"
+	"github.com/onionltd/oniontree-tools/pkg/types/service"
+)
+
+// CreateService stores s along with its URLs and public keys, and tags it
+// with the named tags, creating the ones that don't exist yet.
+func CreateService(db *gorm.DB, s service.Service, tags ...string) (*Service, error) {
+	m := &Service{
+		Name:        s.Name,
+		Description: s.Description,
+		Slug:        slug.Make(s.Name),
+	}
+	for _, url := range s.URLs {
+		m.URLs = append(m.URLs, &URL{Name: url})
+	}
+	for _, publicKey := range s.PublicKeys {
+		m.PublicKeys = append(m.PublicKeys, &PublicKey{
+			UID:         publicKey.ID,
+			UserID:      publicKey.UserID,
+			Fingerprint: publicKey.Fingerprint,
+			Description: publicKey.Description,
+			Value:       publicKey.Value,
+		})
+	}
+	for _, name := range tags {
+		tag, err := FindOrCreateTag(db, name)
+		if err != nil {
+			return nil, err
+		}
+		m.Tags = append(m.Tags, tag)
+	}
+	if err := db.Create(m).Error; err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// FindOrCreateTag returns the tag called name, creating it if needed.
+func FindOrCreateTag(db *gorm.DB, name string) (*Tag, error) {
+	tag := &Tag{}
+	if err := db.Where(Tag{Name: name}).FirstOrCreate(tag).Error; err != nil {
+		return nil, err
+	}
+	return tag, nil
+}
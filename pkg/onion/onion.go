@@ -0,0 +1,257 @@
+package onion
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha512"
+	"encoding/base32"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"filippo.io/edwards25519"
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/crypto/sha3"
+
+	"github.com/x0rzkov/oniontree-backend/pkg/config"
+)
+
+// Files of a hidden service directory, as Tor reads and writes them.
+const (
+	SecretKeyFile = "hs_ed25519_secret_key"
+	PublicKeyFile = "hs_ed25519_public_key"
+	HostnameFile  = "hostname"
+)
+
+var (
+	secretKeyHeader = []byte("== ed25519v1-secret: type0 ==\x00\x00\x00")
+	publicKeyHeader = []byte("== ed25519v1-public: type0 ==\x00\x00\x00")
+)
+
+const version = 3
+
+// ErrNotFound is returned by Load when the directory holds no key.
+var ErrNotFound = errors.New("onion: no hidden service key")
+
+// Identity is the ed25519 key of a v3 hidden service.
+type Identity struct {
+	// SecretKey is the expanded secret key, the clamped scalar followed by
+	// the nonce prefix, which is what Tor stores.
+	SecretKey [64]byte
+	PublicKey ed25519.PublicKey
+}
+
+// Generate returns a new identity.
+func Generate() (*Identity, error) {
+	seed := make([]byte, ed25519.SeedSize)
+	if _, err := rand.Read(seed); err != nil {
+		return nil, err
+	}
+	return fromSeed(seed), nil
+}
+
+// fromSeed returns the identity of the ed25519 private key seed.
+func fromSeed(seed []byte) *Identity {
+	key := ed25519.NewKeyFromSeed(seed)
+	id := &Identity{
+		SecretKey: sha512.Sum512(seed),
+		PublicKey: key.Public().(ed25519.PublicKey),
+	}
+	id.SecretKey[0] &= 248
+	id.SecretKey[31] &= 127
+	id.SecretKey[31] |= 64
+	return id
+}
+
+// publicKey returns the public key of the expanded secret key.
+func publicKey(secretKey [64]byte) (ed25519.PublicKey, error) {
+	scalar, err := edwards25519.NewScalar().SetBytesWithClamping(secretKey[:32])
+	if err != nil {
+		return nil, err
+	}
+	return new(edwards25519.Point).ScalarBaseMult(scalar).Bytes(), nil
+}
+
+// Address returns the .onion address of the hidden service.
+func (id *Identity) Address() string {
+	checksum := sha3.Sum256(bytes.Join([][]byte{[]byte(".onion checksum"), id.PublicKey, {version}}, nil))
+	address := bytes.Join([][]byte{id.PublicKey, checksum[:2], {version}}, nil)
+	return strings.ToLower(base32.StdEncoding.EncodeToString(address)) + ".onion"
+}
+
+// Load reads the identity of the hidden service directory dir, which must
+// only be accessible by its owner, as Tor requires. The public key must be
+// the one of the secret key.
+func Load(dir string) (*Identity, error) {
+	secret, err := ioutil.ReadFile(filepath.Join(dir, SecretKeyFile))
+	if os.IsNotExist(err) {
+		return nil, ErrNotFound
+	} else if err != nil {
+		return nil, fmt.Errorf("onion: %s", err)
+	}
+	if err := checkPrivate(dir); err != nil {
+		return nil, err
+	}
+	if err := checkPrivate(filepath.Join(dir, SecretKeyFile)); err != nil {
+		return nil, err
+	}
+	public, err := ioutil.ReadFile(filepath.Join(dir, PublicKeyFile))
+	if err != nil {
+		return nil, fmt.Errorf("onion: %s", err)
+	}
+
+	id := &Identity{}
+	if len(secret) != len(secretKeyHeader)+len(id.SecretKey) || !bytes.HasPrefix(secret, secretKeyHeader) {
+		return nil, fmt.Errorf("onion: %s is not an ed25519 secret key", filepath.Join(dir, SecretKeyFile))
+	}
+	if len(public) != len(publicKeyHeader)+ed25519.PublicKeySize || !bytes.HasPrefix(public, publicKeyHeader) {
+		return nil, fmt.Errorf("onion: %s is not an ed25519 public key", filepath.Join(dir, PublicKeyFile))
+	}
+	copy(id.SecretKey[:], secret[len(secretKeyHeader):])
+	id.PublicKey = ed25519.PublicKey(public[len(publicKeyHeader):])
+	expected, err := publicKey(id.SecretKey)
+	if err != nil {
+		return nil, fmt.Errorf("onion: %s", err)
+	}
+	if !bytes.Equal(id.PublicKey, expected) {
+		return nil, fmt.Errorf("onion: %s is not the public key of %s", filepath.Join(dir, PublicKeyFile), filepath.Join(dir, SecretKeyFile))
+	}
+	return id, nil
+}
+
+// Save writes the identity to the hidden service directory dir, created
+// if needed, only accessible by its owner. It never overwrites a key.
+func (id *Identity) Save(dir string) error {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return fmt.Errorf("onion: %s", err)
+	}
+	if err := checkPrivate(dir); err != nil {
+		return err
+	}
+	for _, f := range []struct {
+		name    string
+		content []byte
+	}{
+		{SecretKeyFile, append(append([]byte{}, secretKeyHeader...), id.SecretKey[:]...)},
+		{PublicKeyFile, append(append([]byte{}, publicKeyHeader...), id.PublicKey...)},
+		{HostnameFile, []byte(id.Address() + "\n")},
+	} {
+		if err := writeNew(filepath.Join(dir, f.name), f.content); err != nil {
+			return fmt.Errorf("onion: %s", err)
+		}
+	}
+	return nil
+}
+
+// LoadOrGenerate loads the identity of the hidden service directory dir,
+// or generates one and saves it there if there is none. created reports
+// whether it was generated.
+func LoadOrGenerate(dir string) (id *Identity, created bool, err error) {
+	id, err = Load(dir)
+	if err != ErrNotFound {
+		return id, false, err
+	}
+	if id, err = Generate(); err != nil {
+		return nil, false, err
+	}
+	return id, true, id.Save(dir)
+}
+
+// Torrc returns the torrc lines publishing the hidden service of the
+// directory dir, as seen by Tor, on port, forwarding to target, IP:port.
+func (id *Identity) Torrc(dir string, port int, target string) string {
+	return fmt.Sprintf("# %s\nHiddenServiceDir %s\nHiddenServiceVersion %d\nHiddenServicePort %d %s\n", id.Address(), dir, version, port, target)
+}
+
+// AddOnion returns the control port command publishing the hidden service
+// on port, forwarding to target, IP:port, until Tor exits. It holds the
+// secret key.
+func (id *Identity) AddOnion(port int, target string) string {
+	return fmt.Sprintf("ADD_ONION ED25519-V3:%s Flags=Detach Port=%d,%s", base64.StdEncoding.EncodeToString(id.SecretKey[:]), port, target)
+}
+
+// checkPrivate fails if the file or directory at path is accessible by
+// other users than its owner.
+func checkPrivate(path string) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return fmt.Errorf("onion: %s", err)
+	}
+	if info.Mode().Perm()&077 != 0 {
+		mode := os.FileMode(0600)
+		if info.IsDir() {
+			mode = 0700
+		}
+		return fmt.Errorf("onion: %s is accessible by other users, its mode must be %#o", path, mode)
+	}
+	return nil
+}
+
+// writeNew writes content to the new file name, only readable by its owner.
+func writeNew(name string, content []byte) error {
+	f, err := os.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(content); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// writeAtomic replaces the file name with content, so that it is never
+// read half written.
+func writeAtomic(name string, content []byte, perm os.FileMode) error {
+	f, err := ioutil.TempFile(filepath.Dir(name), "."+filepath.Base(name))
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	if _, err := f.Write(content); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Chmod(perm); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), name)
+}
+
+// Setup loads the identity of the hidden service directory of conf, or
+// generates it, and writes the torrc lines publishing it to conf.Torrc if
+// set.
+func Setup(conf config.Onion) (*Identity, error) {
+	if conf.Dir == "" {
+		return nil, errors.New("onion: no hidden service directory configured")
+	}
+	id, created, err := LoadOrGenerate(conf.Dir)
+	if err != nil {
+		return nil, err
+	}
+	if created {
+		log.Infof("onion: generated the hidden service key of %s in %s", id.Address(), conf.Dir)
+	}
+	if conf.Torrc != "" {
+		torDir := conf.TorDir
+		if torDir == "" {
+			// Tor runs from another directory
+			if torDir, err = filepath.Abs(conf.Dir); err != nil {
+				return nil, fmt.Errorf("onion: %s", err)
+			}
+		}
+		if err := writeAtomic(conf.Torrc, []byte(id.Torrc(torDir, conf.Port, conf.Target)), 0644); err != nil {
+			return nil, fmt.Errorf("onion: %s", err)
+		}
+	}
+	return id, nil
+}
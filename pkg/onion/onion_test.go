@@ -0,0 +1,161 @@
+package onion
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/hex"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/x0rzkov/oniontree-backend/pkg/config"
+)
+
+// torKeys are expanded secret keys generated by Tor, as returned by
+// ADD_ONION NEW:ED25519-V3, and the addresses Tor published them at.
+var torKeys = []struct {
+	secretKey, address string
+}{
+	{"SLne6D/uawqUj23619GbeYCd6HnzYPqyUvF8/xyz/3XNVpkgnonQI+J5NQVSGkppD1b0M87+qOtUBmVXsd7H3w", "2s2wk473fmotzgh6l2ycigrwegnurlzufatjm3bglrb36zbvlerskxad.onion"},
+	{"kPUs5aPoqISZVbg0q7coW+mNCODlcL4O7k2QWFOCC0gOQBiDm+g4Xz48lqucA7o2HIQ3gBdL5rlB6+q1tFdJwQ", "tmcpdbgklpbywqyjpr7fijvjl7qjihd7pyubosbeohefec2m2thvzoqd.onion"},
+	{"YGzw/EwpcqfWb5UWIw652Ps4vTKu38VgX7Qo16XvOWjNWQK9YmfgARYiGQ1XYXEAKBJvoq8x+rKFbQN3FG1F6w", "nrcan5uye2fwazixubug6pzrzp6ofjez43bjcyfoxhgxyygxbhgs4zqd.onion"},
+}
+
+// torIdentity returns the identity of the ith key of torKeys.
+func torIdentity(t *testing.T, i int) *Identity {
+	secret, err := base64.RawStdEncoding.DecodeString(torKeys[i].secretKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	id := &Identity{}
+	copy(id.SecretKey[:], secret)
+	if id.PublicKey, err = publicKey(id.SecretKey); err != nil {
+		t.Fatal(err)
+	}
+	return id
+}
+
+func TestAddress(t *testing.T) {
+	for i, key := range torKeys {
+		id := torIdentity(t, i)
+		if address := id.Address(); address != key.address {
+			t.Errorf("Address of key %d = %s, expected %s", i, address, key.address)
+		}
+		if cmd := id.AddOnion(80, "127.0.0.1:9000"); !strings.Contains(cmd, "ED25519-V3:"+key.secretKey) {
+			t.Errorf("AddOnion of key %d = %s, expected its secret key", i, cmd)
+		}
+	}
+}
+
+func TestFromSeed(t *testing.T) {
+	// test 1 of RFC 8032
+	seed, _ := hex.DecodeString("9d61b19deffd5a60ba844af492ec2cc44449c5697b326919703bac031cae7f60")
+	public, _ := hex.DecodeString("d75a980182b10ab7d54bfed3c964073a0ee172f3daa62325af021a68f707511a")
+	id := fromSeed(seed)
+	if !bytes.Equal(id.PublicKey, public) {
+		t.Errorf("public key = %x, expected %x", id.PublicKey, public)
+	}
+	// the expanded secret key is the one of the public key
+	expanded, err := publicKey(id.SecretKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(expanded, public) {
+		t.Errorf("public key of the expanded secret key = %x, expected %x", expanded, public)
+	}
+	// signatures made with the seed verify with it
+	if !ed25519.Verify(id.PublicKey, []byte("oniontree"), ed25519.Sign(ed25519.NewKeyFromSeed(seed), []byte("oniontree"))) {
+		t.Error("signature rejected")
+	}
+}
+
+func TestLoad(t *testing.T) {
+	dir, err := ioutil.TempDir("", "onion")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	hsDir := filepath.Join(dir, "hidden_service")
+	if _, err := Load(hsDir); err != ErrNotFound {
+		t.Fatalf("Load of an empty directory: %v, expected ErrNotFound", err)
+	}
+
+	id := torIdentity(t, 0)
+	if err := id.Save(hsDir); err != nil {
+		t.Fatal(err)
+	}
+	if err := id.Save(hsDir); err == nil {
+		t.Error("Save overwrote the key")
+	}
+	loaded, err := Load(hsDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loaded.SecretKey != id.SecretKey || loaded.Address() != torKeys[0].address {
+		t.Errorf("loaded %s, expected %s", loaded.Address(), torKeys[0].address)
+	}
+	if hostname, err := ioutil.ReadFile(filepath.Join(hsDir, HostnameFile)); err != nil || string(hostname) != torKeys[0].address+"\n" {
+		t.Errorf("hostname = %q, %v", hostname, err)
+	}
+
+	// the public key of another identity
+	other := torIdentity(t, 1)
+	public := append(append([]byte{}, publicKeyHeader...), other.PublicKey...)
+	if err := ioutil.WriteFile(filepath.Join(hsDir, PublicKeyFile), public, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Load(hsDir); err == nil {
+		t.Error("Load accepted the public key of another secret key")
+	}
+
+	if err := os.Chmod(hsDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Load(hsDir); err == nil {
+		t.Error("Load accepted a directory readable by others")
+	}
+}
+
+func TestSetup(t *testing.T) {
+	dir, err := ioutil.TempDir("", "onion")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	conf := config.Onion{
+		Dir:    filepath.Join(dir, "hidden_service"),
+		TorDir: "/var/lib/tor/hidden_service",
+		Port:   80,
+		Target: "127.0.0.1:9000",
+		Torrc:  filepath.Join(dir, "torrc"),
+	}
+	id, err := Setup(conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the torrc is replaced, with the same key
+	again, err := Setup(conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again.Address() != id.Address() {
+		t.Errorf("address changed from %s to %s", id.Address(), again.Address())
+	}
+	torrc, err := ioutil.ReadFile(conf.Torrc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := id.Torrc(conf.TorDir, conf.Port, conf.Target); string(torrc) != expected {
+		t.Errorf("torrc = %q, expected %q", torrc, expected)
+	}
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 2 {
+		t.Errorf("%d files next to the torrc, expected the hidden service directory only", len(files)-1)
+	}
+}
@@ -0,0 +1,45 @@
+package search
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/blevesearch/bleve"
+	log "github.com/sirupsen/logrus"
+)
+
+// MaxSize is the largest number of results a Handler returns.
+const MaxSize = 100
+
+// Handler answers the query string q on Index with the JSON of the results,
+// size of them, 10 by default.
+type Handler struct {
+	Index bleve.Index
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query().Get("q")
+	if q == "" {
+		http.Error(w, "q is required", http.StatusBadRequest)
+		return
+	}
+	size := 10
+	if s := r.URL.Query().Get("size"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 1 || n > MaxSize {
+			http.Error(w, "size must be between 1 and "+strconv.Itoa(MaxSize), http.StatusBadRequest)
+			return
+		}
+		size = n
+	}
+	result, err := Query(h.Index, q, size)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(result); err != nil {
+		log.Errorf("search: %s", err)
+	}
+}
@@ -0,0 +1,191 @@
+package search
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+
+	"github.com/blevesearch/bleve"
+	"github.com/blevesearch/bleve/analysis/analyzer/custom"
+	"github.com/blevesearch/bleve/analysis/analyzer/keyword"
+	"github.com/blevesearch/bleve/analysis/char/html"
+	"github.com/blevesearch/bleve/analysis/token/camelcase"
+	"github.com/blevesearch/bleve/analysis/token/lowercase"
+	"github.com/blevesearch/bleve/analysis/tokenizer/web"
+	"github.com/blevesearch/bleve/mapping"
+	"github.com/gosimple/slug"
+	"github.com/iancoleman/strcase"
+	"github.com/karrick/godirwalk"
+	"github.com/onionltd/oniontree-tools/pkg/types/service"
+	log "github.com/sirupsen/logrus"
+	"gopkg.in/yaml.v3"
+)
+
+// Tag is a tag of an indexed service.
+type Tag struct {
+	Name string `json:"name" yaml:"name"`
+}
+
+// Service is the indexed document of a service.
+type Service struct {
+	Name        string       `json:"name" yaml:"name"`
+	Alias       string       `json:"alias" yaml:"alias"`
+	Slug        string       `json:"slug,omitempty" yaml:"slug,omitempty"`
+	Description string       `json:"description,omitempty" yaml:"description,omitempty"`
+	URLs        []*URL       `json:"urls,omitempty" yaml:"urls,omitempty"`
+	PublicKeys  []*PublicKey `json:"public_keys,omitempty" yaml:"public_keys,omitempty"`
+	Tags        []*Tag       `json:"tags,omitempty" yaml:"tags,omitempty"`
+}
+
+// URL is an address of an indexed service.
+type URL struct {
+	Href    string `json:"href" yaml:"href"`
+	Healthy bool   `json:"healthy" yaml:"healthy"`
+}
+
+// PublicKey is a public key of an indexed service.
+type PublicKey struct {
+	UID         string `json:"id,omitempty" yaml:"id,omitempty"`
+	UserID      string `json:"user_id,omitempty" yaml:"user_id,omitempty"`
+	Fingerprint string `json:"fingerprint,omitempty" yaml:"fingerprint,omitempty"`
+	Description string `json:"description,omitempty" yaml:"description,omitempty"`
+	Value       string `json:"value" yaml:"value"`
+}
+
+// Mapping returns the index mapping of services: names, aliases and tags
+// are split on camel case, descriptions are analysed as English and URLs
+// are kept whole.
+func Mapping() (mapping.IndexMapping, error) {
+	enFieldMapping := bleve.NewTextFieldMapping()
+	enFieldMapping.Analyzer = "en"
+
+	kwFieldMapping := bleve.NewTextFieldMapping()
+	kwFieldMapping.Analyzer = keyword.Name
+
+	m := bleve.NewIndexMapping()
+
+	//tokenizers
+	resultAnalyser := "resultAnalyser"
+	if err := m.AddCustomAnalyzer(resultAnalyser, map[string]interface{}{
+		"type":          custom.Name,
+		"char_filters":  []string{html.Name},
+		"tokenizer":     web.Name,
+		"token_filters": []string{camelcase.Name, lowercase.Name},
+	}); err != nil {
+		return nil, err
+	}
+
+	// field mapping types
+	keywordContent := bleve.NewTextFieldMapping()
+	keywordContent.Analyzer = resultAnalyser
+
+	// fields are named after the json tags of Service
+	svcMapping := bleve.NewDocumentMapping()
+	svcMapping.AddFieldMappingsAt("name", keywordContent)
+	svcMapping.AddFieldMappingsAt("alias", keywordContent)
+	svcMapping.AddFieldMappingsAt("description", enFieldMapping)
+
+	urlMapping := bleve.NewDocumentMapping()
+	urlMapping.AddFieldMappingsAt("href", kwFieldMapping)
+	svcMapping.AddSubDocumentMapping("urls", urlMapping)
+
+	tagMapping := bleve.NewDocumentMapping()
+	tagMapping.AddFieldMappingsAt("name", keywordContent)
+	svcMapping.AddSubDocumentMapping("tags", tagMapping)
+
+	m.DefaultMapping = svcMapping
+	return m, nil
+}
+
+// NewMemOnly returns an in-memory index of services, keyed by slug.
+func NewMemOnly(services map[string]*Service) (bleve.Index, error) {
+	m, err := Mapping()
+	if err != nil {
+		return nil, err
+	}
+	index, err := bleve.NewMemOnly(m)
+	if err != nil {
+		return nil, err
+	}
+	for _, s := range services {
+		if err := index.Index(s.Slug, s); err != nil {
+			return nil, err
+		}
+	}
+	return index, nil
+}
+
+// Query runs the query string q on index, faceted by tag.
+func Query(index bleve.Index, q string, size int) (*bleve.SearchResult, error) {
+	req := bleve.NewSearchRequestOptions(bleve.NewQueryStringQuery(q), size, 0, false)
+	req.Fields = []string{"*"}
+	req.AddFacet("tags", bleve.NewFacetRequest("tags.name", 10))
+	return index.Search(req)
+}
+
+// FromService returns the document of t, without tags. Public keys are left
+// out unless publicKeys is set.
+func FromService(t service.Service, publicKeys bool) *Service {
+	s := &Service{
+		Alias:       strcase.ToDelimited(t.Name, ' '),
+		Name:        t.Name,
+		Description: t.Description,
+		Slug:        slug.Make(t.Name),
+	}
+	if publicKeys {
+		for _, publicKey := range t.PublicKeys {
+			s.PublicKeys = append(s.PublicKeys, &PublicKey{
+				UID:         publicKey.ID,
+				UserID:      publicKey.UserID,
+				Fingerprint: publicKey.Fingerprint,
+				Description: publicKey.Description,
+				Value:       publicKey.Value,
+			})
+		}
+	}
+	for _, url := range t.URLs {
+		s.URLs = append(s.URLs, &URL{Href: url})
+	}
+	return s
+}
+
+// FromDirectory reads the services of a local checkout of the repository,
+// keyed by slug. Public keys are left out unless publicKeys is set.
+func FromDirectory(root string, publicKeys bool) (map[string]*Service, error) {
+	dirname := filepath.Join(root, "tagged")
+	entries := make(map[string]*Service)
+	err := godirwalk.Walk(dirname, &godirwalk.Options{
+		Callback: func(osPathname string, de *godirwalk.Dirent) error {
+			if de.IsDir() {
+				return nil
+			}
+			// services are tagged by the directory they are in
+			rel, err := filepath.Rel(dirname, osPathname)
+			if err != nil {
+				return err
+			}
+			parts := strings.Split(filepath.ToSlash(rel), "/")
+			bytes, err := ioutil.ReadFile(osPathname)
+			if err != nil {
+				return err
+			}
+			t := service.Service{}
+			if err := yaml.Unmarshal(bytes, &t); err != nil {
+				log.Warnf("search: skipping %s: %s", osPathname, err)
+				return nil
+			}
+
+			slugName := slug.Make(t.Name)
+			if entries[slugName] == nil {
+				entries[slugName] = FromService(t, publicKeys)
+			}
+			entries[slugName].Tags = append(entries[slugName].Tags, &Tag{Name: parts[0]})
+			return nil
+		},
+		Unsorted: true, // (optional) set true for faster yet non-deterministic enumeration (see godoc)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
@@ -0,0 +1,269 @@
+package server
+
+import (
+	"crypto/rand"
+	"fmt"
+	"io"
+	"net/http"
+	"path/filepath"
+
+	"github.com/jinzhu/gorm"
+	"github.com/qor/admin"
+	"github.com/qor/assetfs"
+	"github.com/qor/qor/utils"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/x0rzkov/oniontree-backend/pkg/abuse"
+	"github.com/x0rzkov/oniontree-backend/pkg/audit"
+	"github.com/x0rzkov/oniontree-backend/pkg/auth"
+	"github.com/x0rzkov/oniontree-backend/pkg/bindatafs"
+	"github.com/x0rzkov/oniontree-backend/pkg/checker"
+	"github.com/x0rzkov/oniontree-backend/pkg/config"
+	"github.com/x0rzkov/oniontree-backend/pkg/dashboard"
+	"github.com/x0rzkov/oniontree-backend/pkg/importer"
+	"github.com/x0rzkov/oniontree-backend/pkg/models"
+	"github.com/x0rzkov/oniontree-backend/pkg/onion"
+	"github.com/x0rzkov/oniontree-backend/pkg/search"
+	"github.com/x0rzkov/oniontree-backend/pkg/submission"
+	"github.com/x0rzkov/oniontree-backend/pkg/webhook"
+)
+
+// Server serves the admin, the login pages and the public forms.
+type Server struct {
+	Config *config.Config
+	DB     *gorm.DB
+	Admin  *admin.Admin
+	Auth   *auth.Auth
+	Hooks  *webhook.Dispatcher
+	// Puller pulls the upstream repository periodically, nil unless
+	// configured.
+	Puller *importer.Puller
+	// Checker checks the URLs of services periodically, nil unless
+	// configured.
+	Checker *checker.Checker
+	// Watcher imports the changes of the data root and keeps the search
+	// index up to date, nil unless configured.
+	Watcher *importer.Watcher
+	// Onion is the identity of the hidden service of the server, nil
+	// unless configured.
+	Onion *onion.Identity
+	// DevAssets stops reloading the templates and assets as they are
+	// edited, nil unless configured.
+	DevAssets io.Closer
+	Mux       *http.ServeMux
+}
+
+// New sets up the server of conf on db, whose schema must be migrated.
+func New(conf *config.Config, db *gorm.DB) (*Server, error) {
+	s := &Server{Config: conf, DB: db, Mux: http.NewServeMux()}
+
+	// Reload the templates and assets as they are edited
+	if conf.Server.DevAssets {
+		dev, err := bindatafs.AssetFS.Dev()
+		if err != nil {
+			return nil, err
+		}
+		s.DevAssets = dev
+	}
+
+	// Register custom paths to manually saved views, compiled binaries
+	// run without them
+	assets, _ := RegisterAssets(bindatafs.AssetFS, utils.AppRoot)
+
+	// Initialize AssetFS
+	AssetFS := assetfs.AssetFS().NameSpace("admin")
+
+	// Initalize
+	// ref. https://doc.getqor.com/admin/general.html
+	s.Admin = admin.New(&admin.AdminConfig{
+		DB:       db,
+		SiteName: "OnionTreeLtd",
+		AssetFS:  AssetFS,
+	})
+
+	// Templates of the public pages
+	PublicFS := assetfs.AssetFS().NameSpace("public")
+
+	// Require logging in, see auth.Roles for what each role may do
+	if err := auth.Bootstrap(db); err != nil {
+		return nil, err
+	}
+	key, err := sessionKey(conf.Server.SessionKey)
+	if err != nil {
+		return nil, err
+	}
+	s.Auth = auth.New(db, PublicFS, key)
+	s.Auth.ConfigureAdmin(s.Admin)
+
+	// Everyone can browse the dataset, maintainers edit it
+	dataset := &admin.Config{Permission: auth.Permission(auth.RoleViewer, auth.RoleMaintainer)}
+
+	// Allow to use Admin to manage Tag, PublicKey, URL, Service
+	s.Admin.AddResource(&models.Tag{}, dataset)
+
+	svc := s.Admin.AddResource(&models.Service{}, dataset)
+	svc.Meta(&admin.Meta{
+		Name: "Description",
+		Type: "rich_editor",
+	})
+	importer.ConfigureTimeline(svc)
+
+	pks := s.Admin.AddResource(&models.PublicKey{}, dataset)
+	pks.Meta(&admin.Meta{
+		Name: "Value",
+		Type: "text",
+	})
+
+	s.Admin.AddResource(&models.URL{}, dataset)
+
+	// Which commit of the dataset was imported
+	importer.ConfigureAdmin(s.Admin)
+
+	// Moderation queue of the public submission form
+	submission.ConfigureAdmin(s.Admin)
+
+	// Triage queue of the public abuse report form
+	abuse.ConfigureAdmin(s.Admin)
+
+	// Audit log of every change
+	audit.ConfigureAdmin(s.Admin)
+
+	// Announce changes made through the server
+	s.Hooks = webhook.New(db, webhook.Options{
+		MaxAttempts: conf.Webhook.MaxAttempts,
+		BaseDelay:   conf.Webhook.BaseDelay,
+		MaxDelay:    conf.Webhook.MaxDelay,
+		Timeout:     conf.Webhook.Timeout,
+	})
+	s.Hooks.ConfigureAdmin(s.Admin)
+	s.Hooks.RegisterCallbacks(db)
+
+	// Landing page of the admin
+	dashboard.ConfigureAdmin(s.Admin, dashboard.Options{KeyExpiryWindow: conf.Webhook.KeyExpiryWindow})
+
+	// Pull upstream changes for review
+	if conf.Data.Pull.Interval > 0 {
+		if s.Puller, err = importer.NewPuller(audit.WithOrigin(db, audit.OriginImporter), conf.Data); err != nil {
+			return nil, err
+		}
+	}
+
+	// Check the URLs of services, announcing those going up or down
+	if conf.Check.Interval > 0 {
+		if s.Checker, err = checker.New(audit.WithOrigin(db, audit.OriginSystem), conf.Check); err != nil {
+			return nil, err
+		}
+	}
+
+	// Import local edits of the dataset live, and search it
+	if conf.Data.Watch {
+		services, err := search.FromDirectory(conf.Data.Root, false)
+		if err != nil {
+			return nil, err
+		}
+		index, err := search.NewMemOnly(services)
+		if err != nil {
+			return nil, err
+		}
+		s.Watcher = importer.NewWatcher(audit.WithOrigin(db, audit.OriginImporter), conf.Data.Root)
+		s.Watcher.Index = index
+		s.Mux.Handle("/search", &search.Handler{Index: index})
+	}
+
+	// Generate the hidden service key on first start
+	if conf.Onion.Dir != "" {
+		if s.Onion, err = onion.Setup(conf.Onion); err != nil {
+			return nil, err
+		}
+	}
+
+	// Mount admin interface to mux
+	s.Admin.MountTo("/admin", s.Mux)
+
+	// Serve the admin assets precompressed once compiled, and link them by
+	// their fingerprinted names if they were fingerprinted
+	s.Mux.Handle("/admin/assets/", http.StripPrefix("/admin", assets))
+	for name, fn := range bindatafs.FuncMap("/admin") {
+		s.Admin.RegisterFuncMap(name, fn)
+	}
+
+	// Mount login and logout pages
+	s.Auth.MountTo(s.Mux)
+
+	// Mount public submission form
+	s.Mux.Handle("/submit", &submission.Handler{DB: db, AssetFS: PublicFS})
+
+	// Mount public abuse report form
+	s.Mux.Handle("/report", &abuse.Handler{DB: db, AssetFS: PublicFS})
+
+	return s, nil
+}
+
+// assetPaths are the directories of the templates the server renders, by
+// namespace, relative to the root of the application.
+var assetPaths = []struct{ nameSpace, dir string }{
+	{"admin", "tmpl/qor/admin/views"},
+	{"public", "tmpl/public"},
+}
+
+// adminAssets is the directory of the assets of the admin, in the admin
+// views.
+const adminAssets = "assets"
+
+// RegisterAssets registers the paths of the templates and assets the server
+// serves, within root, to assetFS, and returns the file server of the admin
+// assets. It returns the first path which couldn't be registered, once the
+// others are.
+func RegisterAssets(assetFS bindatafs.AssetFSInterface, root string) (http.Handler, error) {
+	var first error
+	for _, p := range assetPaths {
+		dir := filepath.Join(root, p.dir)
+		if err := assetFS.NameSpace(p.nameSpace).RegisterPath(dir); err != nil && first == nil {
+			first = fmt.Errorf("%s: %s", dir, err)
+		}
+	}
+	return assetFS.FileServer(http.Dir(filepath.Join(root, assetPaths[0].dir)), adminAssets), first
+}
+
+// ListenAndServe starts delivering webhooks, pulling upstream, checking the
+// URLs of services and watching the data root, and serves HTTP requests on the configured address.
+func (s *Server) ListenAndServe() error {
+	s.Hooks.Start()
+	defer s.Hooks.Stop()
+	s.Hooks.WatchKeyExpiry(s.Config.Webhook.KeyExpiryInterval, s.Config.Webhook.KeyExpiryWindow)
+	if s.Puller != nil {
+		s.Puller.Watch(s.Config.Data.Pull.Interval)
+	}
+	if s.Checker != nil {
+		s.Checker.Watch(s.Config.Check.Interval)
+	}
+	if s.Watcher != nil {
+		if err := s.Watcher.Start(); err != nil {
+			return err
+		}
+		defer s.Watcher.Close()
+	}
+	if s.DevAssets != nil {
+		defer s.DevAssets.Close()
+	}
+
+	log.Infof("server: listening on %s", s.Config.Server.Listen)
+	if s.Onion != nil {
+		log.Infof("server: hidden service at http://%s", s.Onion.Address())
+	}
+	return http.ListenAndServe(s.Config.Server.Listen, s.Mux)
+}
+
+// sessionKey returns the key securing admin session cookies. Without one in
+// the configuration, sessions don't survive a restart.
+func sessionKey(configured string) ([]byte, error) {
+	if configured != "" {
+		return []byte(configured), nil
+	}
+	log.Warn("server: no session key configured, using a random session key")
+	key := make([]byte, 64)
+	if _, err := rand.Read(key); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
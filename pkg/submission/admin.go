@@ -0,0 +1,85 @@
+package submission
+
+import (
+	"errors"
+
+	"github.com/jinzhu/gorm"
+	"github.com/qor/admin"
+	"github.com/qor/qor"
+
+	"github.com/x0rzkov/oniontree-backend/pkg/auth"
+)
+
+type rejectArgument struct {
+	Reason string
+}
+
+// ConfigureAdmin adds the moderation queue to Admin.
+func ConfigureAdmin(Admin *admin.Admin) {
+	res := Admin.AddResource(&Submission{}, &admin.Config{
+		Menu:       []string{"Moderation"},
+		Permission: auth.Permission(auth.RoleModerator, auth.RoleModerator),
+	})
+	res.IndexAttrs("ID", "CreatedAt", "Name", "URLs", "Tags", "Status")
+	res.ShowAttrs("Name", "Description", "URLs", "Tags", "PublicKey", "Contact", "Status", "Reason", "Service", "ReviewedAt")
+	res.EditAttrs("Name", "Description", "URLs", "Tags", "PublicKey", "Contact")
+	res.NewAttrs(res.EditAttrs())
+	res.Meta(&admin.Meta{Name: "Description", Type: "text"})
+	res.Meta(&admin.Meta{Name: "URLs", Type: "text"})
+	res.Meta(&admin.Meta{Name: "PublicKey", Type: "text"})
+	res.Meta(&admin.Meta{Name: "Reason", Type: "text"})
+
+	for _, status := range Statuses {
+		status := status
+		res.Scope(&admin.Scope{
+			Name:    status,
+			Group:   "Status",
+			Default: status == StatusPending,
+			Handler: func(db *gorm.DB, context *qor.Context) *gorm.DB {
+				return db.Where("status = ?", status)
+			},
+		})
+	}
+
+	isPending := func(record interface{}, context *admin.Context) bool {
+		s, ok := record.(*Submission)
+		return !ok || s.Status == StatusPending
+	}
+
+	res.Action(&admin.Action{
+		Name:    "Approve",
+		Visible: isPending,
+		Handler: func(argument *admin.ActionArgument) error {
+			db := argument.Context.GetDB()
+			for _, record := range argument.FindSelectedRecords() {
+				if _, err := record.(*Submission).Approve(db); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+		Modes:      []string{"show", "menu_item", "batch"},
+		Permission: auth.ActionPermission(auth.RoleModerator),
+	})
+
+	res.Action(&admin.Action{
+		Name:     "Reject",
+		Visible:  isPending,
+		Resource: Admin.NewResource(&rejectArgument{}),
+		Handler: func(argument *admin.ActionArgument) error {
+			arg := argument.Argument.(*rejectArgument)
+			if arg.Reason == "" {
+				return errors.New("a reason is required to reject a submission")
+			}
+			db := argument.Context.GetDB()
+			for _, record := range argument.FindSelectedRecords() {
+				if err := record.(*Submission).Reject(db, arg.Reason); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+		Modes:      []string{"show", "menu_item", "batch"},
+		Permission: auth.ActionPermission(auth.RoleModerator),
+	})
+}
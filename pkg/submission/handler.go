@@ -0,0 +1,51 @@
+package submission
+
+import (
+	"net/http"
+
+	"github.com/jinzhu/gorm"
+	"github.com/qor/assetfs"
+
+	"github.com/x0rzkov/oniontree-backend/pkg/audit"
+	"github.com/x0rzkov/oniontree-backend/pkg/bindatafs"
+)
+
+// Handler serves the public submission form.
+type Handler struct {
+	DB *gorm.DB
+	// AssetFS resolves submit.tmpl.
+	AssetFS assetfs.Interface
+}
+
+type formData struct {
+	Submission *Submission
+	Errors     []error
+	Submitted  bool
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		h.render(w, http.StatusOK, formData{Submission: &Submission{}})
+	case http.MethodPost:
+		s := &Submission{
+			Name:        r.PostFormValue("name"),
+			Description: r.PostFormValue("description"),
+			URLs:        r.PostFormValue("urls"),
+			Tags:        r.PostFormValue("tags"),
+			PublicKey:   r.PostFormValue("public_key"),
+			Contact:     r.PostFormValue("contact"),
+		}
+		if errs := audit.WithOrigin(h.DB, audit.OriginSubmission).Create(s).GetErrors(); len(errs) > 0 {
+			h.render(w, http.StatusUnprocessableEntity, formData{Submission: s, Errors: errs})
+			return
+		}
+		h.render(w, http.StatusCreated, formData{Submission: s, Submitted: true})
+	default:
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+	}
+}
+
+func (h *Handler) render(w http.ResponseWriter, status int, data formData) {
+	bindatafs.Render(w, h.AssetFS, "submit.tmpl", status, data)
+}
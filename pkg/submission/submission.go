@@ -0,0 +1,164 @@
+package submission
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/gosimple/slug"
+	"github.com/jinzhu/gorm"
+	"github.com/onionltd/oniontree-tools/pkg/types/service"
+	"github.com/qor/validations"
+
+	"github.com/x0rzkov/oniontree-backend/pkg/models"
+)
+
+const (
+	StatusPending  = "pending"
+	StatusApproved = "approved"
+	StatusRejected = "rejected"
+)
+
+// Statuses lists every submission status.
+var Statuses = []string{StatusPending, StatusApproved, StatusRejected}
+
+// Tables lists every model owned by this package.
+var Tables = []interface{}{
+	&Submission{},
+}
+
+var onionHost = regexp.MustCompile(`^([a-z2-7]{16}|[a-z2-7]{56})\.onion$`)
+
+// Submission is a service proposed through the public form, waiting for a
+// moderator to approve or reject it.
+type Submission struct {
+	gorm.Model
+	Name        string
+	Description string `gorm:"type:text"`
+	// URLs holds one URL per line.
+	URLs string `gorm:"type:text"`
+	// Tags is a comma separated list of tag names.
+	Tags       string
+	PublicKey  string `gorm:"type:text"`
+	Contact    string
+	Status     string `gorm:"size:16;index"`
+	Reason     string `gorm:"type:text"`
+	ServiceID  uint
+	Service    *models.Service `gorm:"association_autoupdate:false;association_autocreate:false"`
+	ReviewedAt *time.Time
+}
+
+// BeforeCreate puts new submissions in the moderation queue.
+func (s *Submission) BeforeCreate() {
+	if s.Status == "" {
+		s.Status = StatusPending
+	}
+}
+
+// Validate is called by qor/validations before the submission is saved.
+func (s *Submission) Validate(db *gorm.DB) {
+	if name := strings.TrimSpace(s.Name); name == "" || len(name) > 255 {
+		db.AddError(validations.NewError(s, "Name", "name can't be blank or longer than 255 characters"))
+	}
+	if len(s.URLList()) == 0 {
+		db.AddError(validations.NewError(s, "URLs", "at least one URL is required"))
+	}
+	for _, u := range s.URLList() {
+		if !IsOnionURL(u) {
+			db.AddError(validations.NewError(s, "URLs", fmt.Sprintf("%q is not an onion URL", u)))
+			continue
+		}
+		if db.NewRecord(s) && !db.Where("name = ?", u).First(&models.URL{}).RecordNotFound() {
+			db.AddError(validations.NewError(s, "URLs", fmt.Sprintf("%q is already listed", u)))
+		}
+	}
+	for _, tag := range s.TagList() {
+		if tag != slug.Make(tag) || len(tag) > 32 {
+			db.AddError(validations.NewError(s, "Tags", fmt.Sprintf("%q is not a valid tag name", tag)))
+		}
+	}
+	if strings.TrimSpace(s.PublicKey) != "" {
+		if _, err := service.ParseKey([]byte(s.PublicKey)); err != nil {
+			db.AddError(validations.NewError(s, "PublicKey", fmt.Sprintf("invalid PGP public key: %s", err)))
+		}
+	}
+}
+
+// URLList returns the submitted URLs, one per non-empty line.
+func (s Submission) URLList() []string {
+	var urls []string
+	for _, line := range strings.Split(s.URLs, "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			urls = append(urls, line)
+		}
+	}
+	return urls
+}
+
+// TagList returns the submitted tag names.
+func (s Submission) TagList() []string {
+	var tags []string
+	for _, tag := range strings.Split(s.Tags, ",") {
+		if tag = strings.TrimSpace(tag); tag != "" {
+			tags = append(tags, tag)
+		}
+	}
+	return tags
+}
+
+// ToService converts the submission to the oniontree data format.
+func (s Submission) ToService() service.Service {
+	svc := service.Service{
+		Name:        strings.TrimSpace(s.Name),
+		Description: strings.TrimSpace(s.Description),
+	}
+	svc.SetURLs(s.URLList()...)
+	if strings.TrimSpace(s.PublicKey) != "" {
+		if publicKey, err := service.ParseKey([]byte(s.PublicKey)); err == nil {
+			svc.AddPublicKeys(publicKey)
+		}
+	}
+	return svc
+}
+
+// Approve creates the submitted service and marks the submission approved.
+func (s *Submission) Approve(db *gorm.DB) (*models.Service, error) {
+	if s.Status != StatusPending {
+		return nil, fmt.Errorf("submission %d is already %s", s.ID, s.Status)
+	}
+	tx := db.Begin()
+	svc, err := models.CreateService(tx, s.ToService(), s.TagList()...)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	now := time.Now()
+	s.Status, s.ServiceID, s.ReviewedAt = StatusApproved, svc.ID, &now
+	if err := tx.Save(s).Error; err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	return svc, tx.Commit().Error
+}
+
+// Reject marks the submission rejected for reason.
+func (s *Submission) Reject(db *gorm.DB, reason string) error {
+	if s.Status != StatusPending {
+		return fmt.Errorf("submission %d is already %s", s.ID, s.Status)
+	}
+	now := time.Now()
+	s.Status, s.Reason, s.ReviewedAt = StatusRejected, reason, &now
+	return db.Save(s).Error
+}
+
+// IsOnionURL reports whether rawurl is an http(s) URL of a v2 or v3 onion
+// service.
+func IsOnionURL(rawurl string) bool {
+	u, err := url.Parse(rawurl)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		return false
+	}
+	return onionHost.MatchString(strings.ToLower(u.Hostname()))
+}
@@ -0,0 +1,55 @@
+package webhook
+
+import (
+	"strings"
+
+	"github.com/qor/admin"
+	"github.com/qor/qor"
+	"github.com/qor/qor/resource"
+	"github.com/qor/qor/utils"
+
+	"github.com/x0rzkov/oniontree-backend/pkg/auth"
+)
+
+// ConfigureAdmin adds webhooks and their delivery log to Admin.
+func (d *Dispatcher) ConfigureAdmin(Admin *admin.Admin) {
+	hooks := Admin.AddResource(&Webhook{}, &admin.Config{
+		Menu:       []string{"Webhooks"},
+		Permission: auth.Permission(auth.RoleMaintainer, auth.RoleMaintainer),
+	})
+	hooks.IndexAttrs("ID", "Name", "URL", "Events", "Active")
+	hooks.Meta(&admin.Meta{
+		Name:   "Events",
+		Config: &admin.SelectManyConfig{Collection: Events},
+		Valuer: func(record interface{}, context *qor.Context) interface{} {
+			return record.(*Webhook).EventList()
+		},
+		Setter: func(record interface{}, metaValue *resource.MetaValue, context *qor.Context) {
+			record.(*Webhook).Events = strings.Join(utils.ToArray(metaValue.Value), ",")
+		},
+	})
+
+	deliveries := Admin.AddResource(&Delivery{}, &admin.Config{
+		Menu:       []string{"Webhooks"},
+		Permission: auth.ReadOnly(auth.RoleMaintainer),
+	})
+	deliveries.IndexAttrs("ID", "CreatedAt", "Webhook", "Event", "Attempts", "StatusCode", "Delivered", "NextAttemptAt")
+	deliveries.ShowAttrs("Webhook", "Event", "Attempts", "StatusCode", "Delivered", "NextAttemptAt", "Error", "Payload", "Response")
+	deliveries.Meta(&admin.Meta{Name: "Payload", Type: "text"})
+	deliveries.Meta(&admin.Meta{Name: "Response", Type: "text"})
+	deliveries.Filter(&admin.Filter{Name: "Event", Config: &admin.SelectOneConfig{Collection: Events}})
+	deliveries.Filter(&admin.Filter{Name: "Delivered"})
+	deliveries.Action(&admin.Action{
+		Name: "Redeliver",
+		Handler: func(argument *admin.ActionArgument) error {
+			for _, record := range argument.FindSelectedRecords() {
+				if err := d.Redeliver(record.(*Delivery).ID); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+		Modes:      []string{"show", "menu_item", "batch"},
+		Permission: auth.ActionPermission(auth.RoleMaintainer),
+	})
+}
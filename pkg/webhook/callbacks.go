@@ -0,0 +1,180 @@
+package webhook
+
+import (
+	"github.com/jinzhu/gorm"
+
+	"github.com/x0rzkov/oniontree-backend/pkg/models"
+)
+
+const previousStateKey = "webhook:previous_state"
+
+// ServiceData is the payload data of service.* and tag.* events.
+type ServiceData struct {
+	ID          uint     `json:"id"`
+	Name        string   `json:"name"`
+	Slug        string   `json:"slug"`
+	Description string   `json:"description,omitempty"`
+	URLs        []string `json:"urls"`
+	Tags        []string `json:"tags"`
+}
+
+// TagData is the payload data of tag.added and tag.removed events.
+type TagData struct {
+	Tag     string      `json:"tag"`
+	Service ServiceData `json:"service"`
+}
+
+// URLData is the payload data of url.healthy and url.unhealthy events.
+type URLData struct {
+	URL     string      `json:"url"`
+	Healthy bool        `json:"healthy"`
+	Service ServiceData `json:"service"`
+}
+
+// RegisterCallbacks hooks the dispatcher into db, so that every change to
+// services, URLs and tags made through GORM emits the matching event. The
+// deliveries of events are logged in the transaction of the change, so that
+// they are only sent once the outermost transaction is committed, and never
+// if it is rolled back. The callbacks of a dispatcher registered before are
+// replaced, so that the server takes over the logging of deliveries from the
+// commands.
+func (d *Dispatcher) RegisterCallbacks(db *gorm.DB) {
+	if db.Callback().Create().Get("webhook:after_create") != nil {
+		db.Callback().Create().Replace("webhook:after_create", d.afterCreate)
+		db.Callback().Update().Replace("webhook:before_update", d.beforeUpdate)
+		db.Callback().Update().Replace("webhook:after_update", d.afterUpdate)
+		db.Callback().Delete().Replace("webhook:after_delete", d.afterDelete)
+		return
+	}
+	db.Callback().Create().After("gorm:commit_or_rollback_transaction").Register("webhook:after_create", d.afterCreate)
+	db.Callback().Update().Before("gorm:begin_transaction").Register("webhook:before_update", d.beforeUpdate)
+	db.Callback().Update().After("gorm:commit_or_rollback_transaction").Register("webhook:after_update", d.afterUpdate)
+	db.Callback().Delete().After("gorm:commit_or_rollback_transaction").Register("webhook:after_delete", d.afterDelete)
+}
+
+func (d *Dispatcher) afterCreate(scope *gorm.Scope) {
+	if scope.HasError() {
+		return
+	}
+	if svc, ok := scope.Value.(*models.Service); ok {
+		db := scope.NewDB()
+		d.emit(db, ServiceCreated, loadServiceData(db, svc.ID))
+	}
+}
+
+func (d *Dispatcher) beforeUpdate(scope *gorm.Scope) {
+	if scope.PrimaryKeyZero() {
+		return
+	}
+	db := scope.NewDB()
+	switch v := scope.Value.(type) {
+	case *models.Service:
+		scope.InstanceSet(previousStateKey, serviceTagNames(db, v.ID))
+	case *models.URL:
+		var previous models.URL
+		if err := db.First(&previous, v.ID).Error; err == nil {
+			scope.InstanceSet(previousStateKey, previous.Healthy)
+		}
+	}
+}
+
+func (d *Dispatcher) afterUpdate(scope *gorm.Scope) {
+	if scope.HasError() || scope.PrimaryKeyZero() {
+		return
+	}
+	previous, hasPrevious := scope.InstanceGet(previousStateKey)
+	db := scope.NewDB()
+
+	switch v := scope.Value.(type) {
+	case *models.Service:
+		data := loadServiceData(db, v.ID)
+		d.emit(db, ServiceUpdated, data)
+		if !hasPrevious {
+			return
+		}
+		added, removed := diffNames(previous.([]string), data.Tags)
+		for _, tag := range added {
+			d.emit(db, TagAdded, TagData{Tag: tag, Service: data})
+		}
+		for _, tag := range removed {
+			d.emit(db, TagRemoved, TagData{Tag: tag, Service: data})
+		}
+	case *models.URL:
+		if !hasPrevious {
+			return
+		}
+		var current models.URL
+		if err := db.First(&current, v.ID).Error; err != nil || current.Healthy == previous.(bool) {
+			return
+		}
+		event := URLUnhealthy
+		if current.Healthy {
+			event = URLHealthy
+		}
+		d.emit(db, event, URLData{
+			URL:     current.Name,
+			Healthy: current.Healthy,
+			Service: loadServiceData(db, current.ServiceID),
+		})
+	}
+}
+
+func (d *Dispatcher) afterDelete(scope *gorm.Scope) {
+	if scope.HasError() || scope.PrimaryKeyZero() {
+		return
+	}
+	if svc, ok := scope.Value.(*models.Service); ok {
+		db := scope.NewDB()
+		d.emit(db, ServiceDeleted, loadServiceData(db.Unscoped(), svc.ID))
+	}
+}
+
+func loadServiceData(db *gorm.DB, id uint) ServiceData {
+	var svc models.Service
+	db.Preload("URLs").Preload("Tags").First(&svc, id)
+
+	data := ServiceData{
+		ID:          svc.ID,
+		Name:        svc.Name,
+		Slug:        svc.Slug,
+		Description: svc.Description,
+		URLs:        []string{},
+		Tags:        []string{},
+	}
+	for _, u := range svc.URLs {
+		data.URLs = append(data.URLs, u.Name)
+	}
+	for _, t := range svc.Tags {
+		data.Tags = append(data.Tags, t.Name)
+	}
+	return data
+}
+
+func serviceTagNames(db *gorm.DB, id uint) []string {
+	var tags []models.Tag
+	db.Model(&models.Service{Model: gorm.Model{ID: id}}).Related(&tags, "Tags")
+	names := []string{}
+	for _, t := range tags {
+		names = append(names, t.Name)
+	}
+	return names
+}
+
+func diffNames(before, after []string) (added, removed []string) {
+	seen := map[string]bool{}
+	for _, name := range before {
+		seen[name] = true
+	}
+	for _, name := range after {
+		if !seen[name] {
+			added = append(added, name)
+		}
+		delete(seen, name)
+	}
+	for _, name := range before {
+		if seen[name] {
+			removed = append(removed, name)
+		}
+	}
+	return added, removed
+}
@@ -0,0 +1,346 @@
+package webhook
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// SignatureHeader carries the hex encoded HMAC-SHA256 of the request body.
+	SignatureHeader = "X-OnionTree-Signature"
+	EventHeader     = "X-OnionTree-Event"
+	DeliveryHeader  = "X-OnionTree-Delivery"
+
+	signaturePrefix = "sha256="
+	maxResponseSize = 4096
+
+	// pollInterval is how often deliveries logged by other transactions
+	// or processes are looked for.
+	pollInterval = 10 * time.Second
+)
+
+// Options tune delivery retries.
+type Options struct {
+	// MaxAttempts is the number of times a delivery is tried before giving up.
+	MaxAttempts int
+	// BaseDelay is the wait before the first retry, doubled on every attempt.
+	BaseDelay time.Duration
+	// MaxDelay caps the exponential backoff.
+	MaxDelay time.Duration
+	// Timeout bounds a single HTTP request.
+	Timeout time.Duration
+}
+
+var DefaultOptions = Options{
+	MaxAttempts: 6,
+	BaseDelay:   10 * time.Second,
+	MaxDelay:    time.Hour,
+	Timeout:     15 * time.Second,
+}
+
+// Dispatcher fans events out to the subscribed webhooks and keeps a delivery
+// log in the database. Deliveries are logged in the transaction of the change
+// they announce, and sent once it is committed.
+type Dispatcher struct {
+	db     *gorm.DB
+	client *http.Client
+	opts   Options
+	// wake tells the loop that deliveries were logged
+	wake    chan struct{}
+	retries chan uint
+	quit    chan struct{}
+
+	mu sync.Mutex
+	// inFlight are the deliveries being attempted
+	inFlight map[uint]bool
+}
+
+func New(db *gorm.DB, opts Options) *Dispatcher {
+	if opts.MaxAttempts <= 0 {
+		opts.MaxAttempts = DefaultOptions.MaxAttempts
+	}
+	if opts.BaseDelay <= 0 {
+		opts.BaseDelay = DefaultOptions.BaseDelay
+	}
+	if opts.MaxDelay <= 0 {
+		opts.MaxDelay = DefaultOptions.MaxDelay
+	}
+	if opts.Timeout <= 0 {
+		opts.Timeout = DefaultOptions.Timeout
+	}
+	return &Dispatcher{
+		db:       db,
+		client:   &http.Client{Timeout: opts.Timeout},
+		opts:     opts,
+		wake:     make(chan struct{}, 1),
+		retries:  make(chan uint, 256),
+		quit:     make(chan struct{}),
+		inFlight: map[uint]bool{},
+	}
+}
+
+// Start resumes deliveries left pending by a previous run and starts
+// processing emitted events.
+func (d *Dispatcher) Start() {
+	var pending []Delivery
+	if err := d.db.Where("delivered = ? AND attempts < ?", false, d.opts.MaxAttempts).Find(&pending).Error; err != nil {
+		log.Errorf("webhook: loading pending deliveries: %s", err)
+	}
+	for _, delivery := range pending {
+		delay := time.Duration(0)
+		if delivery.NextAttemptAt != nil {
+			delay = time.Until(*delivery.NextAttemptAt)
+		}
+		d.schedule(delivery.ID, delay)
+	}
+	go d.loop()
+}
+
+// Stop stops processing events, deliveries still in flight are resumed by
+// the next Start.
+func (d *Dispatcher) Stop() {
+	close(d.quit)
+}
+
+// Emit logs a delivery of event to every active webhook subscribed to it,
+// which the dispatcher sends once started.
+func (d *Dispatcher) Emit(event string, data interface{}) {
+	d.emit(d.db, event, data)
+}
+
+// emit logs the deliveries of event through db, so that they are only sent
+// if the transaction of db, if any, is committed. It never blocks on the
+// dispatcher.
+func (d *Dispatcher) emit(db *gorm.DB, event string, data interface{}) {
+	payload := Payload{Event: event, CreatedAt: time.Now().UTC(), Data: data}
+	var webhooks []Webhook
+	if err := db.Where("active = ?", true).Find(&webhooks).Error; err != nil {
+		log.Errorf("webhook: loading webhooks: %s", err)
+		return
+	}
+
+	body, err := json.Marshal(payload)
+	if err != nil {
+		log.Errorf("webhook: encoding %s payload: %s", payload.Event, err)
+		return
+	}
+
+	logged := false
+	for _, w := range webhooks {
+		if !w.Subscribed(payload.Event) {
+			continue
+		}
+		delivery := &Delivery{
+			WebhookID: w.ID,
+			Event:     payload.Event,
+			Payload:   string(body),
+		}
+		if err := db.Create(delivery).Error; err != nil {
+			log.Errorf("webhook: logging delivery to %q: %s", w.Name, err)
+			continue
+		}
+		logged = true
+	}
+	if logged {
+		select {
+		case d.wake <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// Redeliver sends a logged delivery again, regardless of its previous outcome.
+func (d *Dispatcher) Redeliver(id uint) error {
+	err := d.db.Model(&Delivery{}).Where("id = ?", id).Updates(map[string]interface{}{
+		"delivered": false,
+		"attempts":  0,
+	}).Error
+	if err != nil {
+		return err
+	}
+	d.schedule(id, 0)
+	return nil
+}
+
+func (d *Dispatcher) loop() {
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-d.wake:
+			d.sendLogged()
+		case <-ticker.C:
+			d.sendLogged()
+		case id := <-d.retries:
+			d.start(id)
+		case <-d.quit:
+			return
+		}
+	}
+}
+
+// sendLogged starts sending the deliveries never attempted. Those of a
+// transaction not committed yet are found by a later call.
+func (d *Dispatcher) sendLogged() {
+	var ids []uint
+	err := d.db.Model(&Delivery{}).
+		Where("delivered = ? AND attempts = ? AND next_attempt_at IS NULL", false, 0).
+		Pluck("id", &ids).Error
+	if err != nil {
+		log.Errorf("webhook: loading logged deliveries: %s", err)
+		return
+	}
+	for _, id := range ids {
+		d.start(id)
+	}
+}
+
+// start attempts the delivery id, unless it is being attempted already,
+// and schedules its retry if it fails.
+func (d *Dispatcher) start(id uint) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.inFlight[id] {
+		return
+	}
+	d.inFlight[id] = true
+	go func() {
+		retry, delay := d.attempt(id)
+		d.mu.Lock()
+		delete(d.inFlight, id)
+		d.mu.Unlock()
+		if retry {
+			d.schedule(id, delay)
+		}
+	}()
+}
+
+// attempt sends the delivery id, and reports whether and when it is to be
+// retried.
+func (d *Dispatcher) attempt(id uint) (retry bool, delay time.Duration) {
+	var delivery Delivery
+	if err := d.db.Preload("Webhook").First(&delivery, id).Error; err != nil {
+		log.Errorf("webhook: loading delivery %d: %s", id, err)
+		return false, 0
+	}
+	if delivery.Delivered {
+		return false, 0
+	}
+
+	delivery.Attempts++
+	status, response, err := d.send(delivery)
+	delivery.StatusCode, delivery.Response = status, response
+	delivery.NextAttemptAt = nil
+	delivery.Error = ""
+	if err != nil {
+		delivery.Error = err.Error()
+	} else {
+		delivery.Delivered = true
+	}
+
+	if !delivery.Delivered && delivery.Attempts < d.opts.MaxAttempts {
+		delay = d.backoff(delivery.Attempts)
+		next := time.Now().Add(delay)
+		delivery.NextAttemptAt = &next
+	}
+
+	if err := d.db.Model(&delivery).Updates(map[string]interface{}{
+		"attempts":        delivery.Attempts,
+		"status_code":     delivery.StatusCode,
+		"response":        delivery.Response,
+		"error":           delivery.Error,
+		"delivered":       delivery.Delivered,
+		"next_attempt_at": delivery.NextAttemptAt,
+	}).Error; err != nil {
+		log.Errorf("webhook: updating delivery %d: %s", id, err)
+	}
+
+	switch {
+	case delivery.Delivered:
+		log.Debugf("webhook: delivered %s to %q", delivery.Event, delivery.Webhook.Name)
+	case delivery.NextAttemptAt != nil:
+		log.Warnf("webhook: delivering %s to %q failed (attempt %d), retrying in %s: %s",
+			delivery.Event, delivery.Webhook.Name, delivery.Attempts, delay, delivery.Error)
+		return true, delay
+	default:
+		log.Errorf("webhook: giving up delivering %s to %q after %d attempts: %s",
+			delivery.Event, delivery.Webhook.Name, delivery.Attempts, delivery.Error)
+	}
+	return false, 0
+}
+
+func (d *Dispatcher) send(delivery Delivery) (int, string, error) {
+	body := []byte(delivery.Payload)
+	req, err := http.NewRequest(http.MethodPost, delivery.Webhook.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, "", err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "oniontree-webhook")
+	req.Header.Set(EventHeader, delivery.Event)
+	req.Header.Set(DeliveryHeader, fmt.Sprint(delivery.ID))
+	req.Header.Set(SignatureHeader, Sign(delivery.Webhook.Secret, body))
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return 0, "", err
+	}
+	defer resp.Body.Close()
+
+	response, _ := ioutil.ReadAll(io.LimitReader(resp.Body, maxResponseSize))
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, string(response), fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return resp.StatusCode, string(response), nil
+}
+
+func (d *Dispatcher) schedule(id uint, delay time.Duration) {
+	if delay < 0 {
+		delay = 0
+	}
+	time.AfterFunc(delay, func() {
+		select {
+		case d.retries <- id:
+		case <-d.quit:
+		}
+	})
+}
+
+func (d *Dispatcher) backoff(attempt int) time.Duration {
+	delay := d.opts.BaseDelay
+	for i := 1; i < attempt; i++ {
+		delay *= 2
+		if delay >= d.opts.MaxDelay {
+			return d.opts.MaxDelay
+		}
+	}
+	return delay
+}
+
+// Sign returns the signature header value for body.
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return signaturePrefix + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify reports whether signature is a valid signature of body.
+func Verify(secret string, body []byte, signature string) bool {
+	if !strings.HasPrefix(signature, signaturePrefix) {
+		return false
+	}
+	return hmac.Equal([]byte(Sign(secret, body)), []byte(signature))
+}
@@ -0,0 +1,214 @@
+package webhook
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	_ "github.com/jinzhu/gorm/dialects/sqlite"
+
+	"github.com/x0rzkov/oniontree-backend/pkg/models"
+)
+
+func TestSignVerify(t *testing.T) {
+	body := []byte(`{"event":"service.created"}`)
+	signature := Sign("secret", body)
+	// echo -n "$body" | openssl dgst -sha256 -hmac secret
+	if expected := "sha256=beadc532ac6aa452b37ce7d8ea413c1fdc2b3e64dff25908bae92430af50c01a"; signature != expected {
+		t.Fatalf("Sign = %q, expected %q", signature, expected)
+	}
+	for _, c := range []struct {
+		secret    string
+		body      string
+		signature string
+		valid     bool
+	}{
+		{"secret", string(body), signature, true},
+		{"other", string(body), signature, false},
+		{"secret", `{"event":"service.deleted"}`, signature, false},
+		{"secret", string(body), signature[len(signaturePrefix):], false},
+		{"secret", string(body), "", false},
+	} {
+		if valid := Verify(c.secret, []byte(c.body), c.signature); valid != c.valid {
+			t.Errorf("Verify(%q, %q, %q) = %v", c.secret, c.body, c.signature, valid)
+		}
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	d := New(nil, Options{BaseDelay: time.Second, MaxDelay: 10 * time.Second})
+	for attempt, delay := range []time.Duration{1: time.Second, 2: 2 * time.Second, 3: 4 * time.Second, 4: 8 * time.Second, 5: 10 * time.Second, 10: 10 * time.Second, 100: 10 * time.Second} {
+		if delay == 0 {
+			continue
+		}
+		if got := d.backoff(attempt); got != delay {
+			t.Errorf("backoff(%d) = %s, expected %s", attempt, got, delay)
+		}
+	}
+}
+
+func TestDiffNames(t *testing.T) {
+	for _, c := range []struct {
+		before, after, added, removed []string
+	}{
+		{nil, nil, nil, nil},
+		{[]string{"a"}, []string{"a"}, nil, nil},
+		{nil, []string{"a", "b"}, []string{"a", "b"}, nil},
+		{[]string{"a", "b"}, nil, nil, []string{"a", "b"}},
+		{[]string{"a", "b"}, []string{"b", "c"}, []string{"c"}, []string{"a"}},
+	} {
+		added, removed := diffNames(c.before, c.after)
+		if !reflect.DeepEqual(added, c.added) || !reflect.DeepEqual(removed, c.removed) {
+			t.Errorf("diffNames(%q, %q) = %q, %q, expected %q, %q", c.before, c.after, added, removed, c.added, c.removed)
+		}
+	}
+}
+
+// openDB returns an in-memory database limited to a single connection, as
+// database.Open limits SQLite, with the callbacks of d registered.
+func openDB(t *testing.T, d *Dispatcher) *gorm.DB {
+	db, err := gorm.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.DB().SetMaxOpenConns(1)
+	if err := db.AutoMigrate(append(append([]interface{}{}, models.Tables...), Tables...)...).Error; err != nil {
+		t.Fatal(err)
+	}
+	d.db = db
+	d.RegisterCallbacks(db)
+	return db
+}
+
+func countDeliveries(t *testing.T, db *gorm.DB) int {
+	var count int
+	if err := db.Model(&Delivery{}).Count(&count).Error; err != nil {
+		t.Fatal(err)
+	}
+	return count
+}
+
+func TestEmitInTransaction(t *testing.T) {
+	d := New(nil, Options{})
+	db := openDB(t, d)
+	defer db.Close()
+	if err := db.Create(&Webhook{Name: "all", URL: "http://127.0.0.1:1", Active: true}).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	// more events than the dispatcher ever buffered, on the connection
+	// the transaction holds
+	const services = 300
+	create := func(tx *gorm.DB) {
+		for i := 0; i < services; i++ {
+			if err := tx.Create(&models.Service{Name: "service"}).Error; err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	tx := db.Begin()
+	create(tx)
+	if err := tx.Rollback().Error; err != nil {
+		t.Fatal(err)
+	}
+	if count := countDeliveries(t, db); count != 0 {
+		t.Errorf("%d deliveries logged by a rolled back transaction", count)
+	}
+
+	tx = db.Begin()
+	create(tx)
+	if err := tx.Commit().Error; err != nil {
+		t.Fatal(err)
+	}
+	if count := countDeliveries(t, db); count != services {
+		t.Errorf("%d deliveries logged, expected %d", count, services)
+	}
+}
+
+func TestRegisterCallbacksTwice(t *testing.T) {
+	// the dispatcher of a command, then that of the server
+	command := New(nil, Options{})
+	db := openDB(t, command)
+	defer db.Close()
+	server := New(db, Options{})
+	server.RegisterCallbacks(db)
+	if err := db.Create(&Webhook{Name: "all", URL: "http://127.0.0.1:1", Active: true}).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	if err := db.Create(&models.Service{Name: "service"}).Error; err != nil {
+		t.Fatal(err)
+	}
+	if count := countDeliveries(t, db); count != 1 {
+		t.Errorf("%d deliveries logged, expected 1", count)
+	}
+	select {
+	case <-server.wake:
+	default:
+		t.Error("the dispatcher registered last wasn't woken")
+	}
+	select {
+	case <-command.wake:
+		t.Error("the replaced dispatcher was woken")
+	default:
+	}
+}
+
+func TestDeliver(t *testing.T) {
+	received := make(chan *http.Request, 1)
+	bodies := make(chan []byte, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		received <- r
+		bodies <- body
+	}))
+	defer server.Close()
+
+	d := New(nil, Options{})
+	db := openDB(t, d)
+	defer db.Close()
+	if err := db.Create(&Webhook{Name: "tags", URL: server.URL, Secret: "secret", Events: TagAdded, Active: true}).Error; err != nil {
+		t.Fatal(err)
+	}
+	d.Start()
+	defer d.Stop()
+
+	svc := &models.Service{Name: "service"}
+	if err := db.Create(svc).Error; err != nil {
+		t.Fatal(err)
+	}
+	svc.Tags = []*models.Tag{{Name: "market"}}
+	if err := db.Save(svc).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case r := <-received:
+		body := <-bodies
+		if event := r.Header.Get(EventHeader); event != TagAdded {
+			t.Errorf("%s = %q, expected %q", EventHeader, event, TagAdded)
+		}
+		if !Verify("secret", body, r.Header.Get(SignatureHeader)) {
+			t.Errorf("invalid signature %q", r.Header.Get(SignatureHeader))
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("nothing delivered")
+	}
+
+	var delivery Delivery
+	deadline := time.Now().Add(5 * time.Second)
+	for !delivery.Delivered && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+		if err := db.Last(&delivery).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	if !delivery.Delivered || delivery.Attempts != 1 {
+		t.Errorf("delivery = %+v, expected delivered on the first attempt", delivery)
+	}
+}
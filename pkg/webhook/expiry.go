@@ -0,0 +1,87 @@
+package webhook
+
+import (
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/crypto/openpgp"
+
+	"github.com/x0rzkov/oniontree-backend/pkg/models"
+)
+
+// KeyData is the payload data of key.expiring events.
+type KeyData struct {
+	ID          string      `json:"id"`
+	UserID      string      `json:"user_id"`
+	Fingerprint string      `json:"fingerprint"`
+	ExpiresAt   time.Time   `json:"expires_at"`
+	Service     ServiceData `json:"service"`
+}
+
+// KeyExpiry returns the earliest expiration time of the keys found in the
+// armored keyring, ok is false if none of them expires.
+func KeyExpiry(armored string) (expiresAt time.Time, ok bool, err error) {
+	entities, err := openpgp.ReadArmoredKeyRing(strings.NewReader(armored))
+	if err != nil {
+		return time.Time{}, false, err
+	}
+	for _, e := range entities {
+		for _, ident := range e.Identities {
+			sig := ident.SelfSignature
+			if sig == nil || sig.KeyLifetimeSecs == nil || *sig.KeyLifetimeSecs == 0 {
+				continue
+			}
+			t := e.PrimaryKey.CreationTime.Add(time.Duration(*sig.KeyLifetimeSecs) * time.Second)
+			if !ok || t.Before(expiresAt) {
+				expiresAt, ok = t, true
+			}
+		}
+	}
+	return expiresAt, ok, nil
+}
+
+// WatchKeyExpiry checks public keys every interval and emits key.expiring
+// for keys expiring within window. Each key is reported once per process.
+func (d *Dispatcher) WatchKeyExpiry(interval, window time.Duration) {
+	notified := map[string]bool{}
+
+	check := func() {
+		var keys []models.PublicKey
+		if err := d.db.Find(&keys).Error; err != nil {
+			log.Errorf("webhook: loading public keys: %s", err)
+			return
+		}
+		for _, key := range keys {
+			expiresAt, ok, err := KeyExpiry(key.Value)
+			if err != nil || !ok || time.Until(expiresAt) > window {
+				continue
+			}
+			id := key.Fingerprint + expiresAt.String()
+			if notified[id] {
+				continue
+			}
+			notified[id] = true
+			d.Emit(KeyExpiring, KeyData{
+				ID:          key.UID,
+				UserID:      key.UserID,
+				Fingerprint: key.Fingerprint,
+				ExpiresAt:   expiresAt,
+				Service:     loadServiceData(d.db, key.ServiceID),
+			})
+		}
+	}
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			check()
+			select {
+			case <-ticker.C:
+			case <-d.quit:
+				return
+			}
+		}
+	}()
+}
@@ -0,0 +1,95 @@
+package webhook
+
+import (
+	"strings"
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+// Lifecycle events a webhook can subscribe to.
+const (
+	ServiceCreated = "service.created"
+	ServiceUpdated = "service.updated"
+	ServiceDeleted = "service.deleted"
+	URLUnhealthy   = "url.unhealthy"
+	URLHealthy     = "url.healthy"
+	KeyExpiring    = "key.expiring"
+	TagAdded       = "tag.added"
+	TagRemoved     = "tag.removed"
+)
+
+// Events lists every event name, in the order they are shown in the admin.
+var Events = []string{
+	ServiceCreated,
+	ServiceUpdated,
+	ServiceDeleted,
+	URLUnhealthy,
+	URLHealthy,
+	KeyExpiring,
+	TagAdded,
+	TagRemoved,
+}
+
+// Tables lists every model owned by this package.
+var Tables = []interface{}{
+	&Webhook{},
+	&Delivery{},
+}
+
+// Webhook is an outgoing HTTP endpoint notified about lifecycle events.
+type Webhook struct {
+	gorm.Model
+	Name   string `json:"name"`
+	URL    string `gorm:"size:255" json:"url"`
+	Secret string `json:"-"`
+	// Events is a comma separated list of subscribed events, empty means all.
+	Events string `json:"events"`
+	Active bool   `json:"active"`
+}
+
+// Subscribed reports whether the webhook wants to receive event.
+func (w Webhook) Subscribed(event string) bool {
+	if strings.TrimSpace(w.Events) == "" {
+		return true
+	}
+	for _, e := range w.EventList() {
+		if e == event {
+			return true
+		}
+	}
+	return false
+}
+
+// EventList returns the subscribed events as a slice.
+func (w Webhook) EventList() []string {
+	var events []string
+	for _, e := range strings.Split(w.Events, ",") {
+		if e = strings.TrimSpace(e); e != "" {
+			events = append(events, e)
+		}
+	}
+	return events
+}
+
+// Delivery records a single payload sent, or being sent, to a webhook.
+type Delivery struct {
+	gorm.Model
+	WebhookID     uint       `json:"webhook_id"`
+	Webhook       Webhook    `json:"-"`
+	Event         string     `json:"event"`
+	Payload       string     `gorm:"type:text" json:"payload"`
+	Attempts      int        `json:"attempts"`
+	StatusCode    int        `json:"status_code"`
+	Response      string     `gorm:"type:text" json:"response"`
+	Error         string     `gorm:"type:text" json:"error"`
+	Delivered     bool       `json:"delivered"`
+	NextAttemptAt *time.Time `json:"next_attempt_at"`
+}
+
+// Payload is the JSON document POSTed to webhooks.
+type Payload struct {
+	Event     string      `json:"event"`
+	CreatedAt time.Time   `json:"created_at"`
+	Data      interface{} `json:"data"`
+}